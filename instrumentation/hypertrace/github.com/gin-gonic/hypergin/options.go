@@ -1,17 +1,20 @@
 package hypergin // import "github.com/hypertrace/goagent/instrumentation/hypertrace/github.com/gin-gonic/hypergin"
 
 import (
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/exclusion"
 	"github.com/hypertrace/goagent/sdk/filter"
 	"github.com/hypertrace/goagent/sdk/instrumentation/net/http"
 )
 
 type options struct {
-	Filter filter.Filter
+	Filter        filter.Filter
+	Exclusions    exclusion.Rules
+	PanicRecovery sdk.PanicRecovery
 }
 
 func (o *options) toSDKOptions() *http.Options {
-	opts := (http.Options)(*o)
-	return &opts
+	return &http.Options{Filter: o.Filter, Exclusions: o.Exclusions, PanicRecovery: o.PanicRecovery}
 }
 
 type Option func(o *options)
@@ -21,3 +24,20 @@ func WithFilter(f filter.Filter) Option {
 		o.Filter = f
 	}
 }
+
+// WithExclusions sets the rules of the requests for which the span is not created or
+// the data is not captured, e.g. exclusion.DefaultRules(exclusion.SkipSpan) for the
+// usual health probes.
+func WithExclusions(rules ...exclusion.Rule) Option {
+	return func(o *options) {
+		o.Exclusions = append(o.Exclusions, rules...)
+	}
+}
+
+// WithPanicRecovery records the panics of the handlers on the span, either panicking
+// again with sdk.PanicRecoveryRecord or responding with a 500 with sdk.PanicRecoveryRespond.
+func WithPanicRecovery(r sdk.PanicRecovery) Option {
+	return func(o *options) {
+		o.PanicRecovery = r
+	}
+}
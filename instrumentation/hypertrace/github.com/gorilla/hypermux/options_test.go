@@ -3,6 +3,7 @@ package hypermux // import "github.com/hypertrace/goagent/instrumentation/hypert
 import (
 	"testing"
 
+	"github.com/hypertrace/goagent/sdk/exclusion"
 	"github.com/hypertrace/goagent/sdk/filter"
 	"github.com/stretchr/testify/assert"
 )
@@ -13,3 +14,9 @@ func TestOptionsToSDK(t *testing.T) {
 	}
 	assert.Equal(t, filter.NoopFilter{}, o.toSDKOptions().Filter)
 }
+
+func TestWithExclusions(t *testing.T) {
+	o := &options{}
+	WithExclusions(exclusion.Rule{Path: "/healthz", Action: exclusion.SkipSpan})(o)
+	assert.Equal(t, exclusion.Rules{{Path: "/healthz", Action: exclusion.SkipSpan}}, o.toSDKOptions().Exclusions)
+}
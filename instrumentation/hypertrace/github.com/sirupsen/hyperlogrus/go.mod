@@ -0,0 +1,19 @@
+module github.com/hypertrace/goagent/instrumentation/hypertrace/github.com/sirupsen/hyperlogrus
+
+go 1.22.0
+
+toolchain go1.23.5
+
+replace github.com/hypertrace/goagent => ../../../../..
+
+replace github.com/hypertrace/goagent/instrumentation/opentelemetry/github.com/sirupsen/hyperlogrus => ../../../../../instrumentation/opentelemetry/github.com/sirupsen/hyperlogrus
+
+require github.com/hypertrace/goagent/instrumentation/opentelemetry/github.com/sirupsen/hyperlogrus v0.0.0-00010101000000-000000000000
+
+require (
+	github.com/hypertrace/goagent v0.0.0-00010101000000-000000000000 // indirect
+	github.com/sirupsen/logrus v1.9.3 // indirect
+	go.opentelemetry.io/otel v1.34.0 // indirect
+	go.opentelemetry.io/otel/trace v1.34.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+)
@@ -0,0 +1,19 @@
+package hyperlogrus // import "github.com/hypertrace/goagent/instrumentation/hypertrace/github.com/sirupsen/hyperlogrus"
+
+import (
+	otellogrus "github.com/hypertrace/goagent/instrumentation/opentelemetry/github.com/sirupsen/hyperlogrus"
+)
+
+// Hook adds the trace_id, span_id and trace_flags of the span in the entry context to the
+// entry fields.
+type Hook = otellogrus.Hook
+
+// Option configures the Hook.
+type Option = otellogrus.Option
+
+// NewHook returns a Hook correlating the log entries with the traces.
+var NewHook = otellogrus.NewHook
+
+// WithErrorEvents mirrors the entries of level error and above onto the span in the
+// context as events.
+var WithErrorEvents = otellogrus.WithErrorEvents
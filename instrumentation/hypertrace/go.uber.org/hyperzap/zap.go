@@ -0,0 +1,20 @@
+package hyperzap // import "github.com/hypertrace/goagent/instrumentation/hypertrace/go.uber.org/hyperzap"
+
+import (
+	otelzap "github.com/hypertrace/goagent/instrumentation/opentelemetry/go.uber.org/hyperzap"
+)
+
+// Option configures the core returned by WrapCore.
+type Option = otelzap.Option
+
+// Context returns a field adding the trace_id, span_id and trace_flags of the span in the
+// context to the log entry.
+var Context = otelzap.Context
+
+// WrapCore wraps a zapcore.Core so the entries logged with a Context field are mirrored
+// onto their span according to the options.
+var WrapCore = otelzap.WrapCore
+
+// WithErrorEvents mirrors the entries of level error and above onto the span of their
+// Context field as events.
+var WithErrorEvents = otelzap.WithErrorEvents
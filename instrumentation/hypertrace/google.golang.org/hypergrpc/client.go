@@ -9,10 +9,34 @@ import (
 
 // UnaryClientInterceptor returns a grpc.UnaryClientInterceptor suitable
 // for use in a grpc.Dial call.
-func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+func UnaryClientInterceptor(opts ...Option) grpc.UnaryClientInterceptor {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
 	return sdkgrpc.WrapUnaryClientInterceptor(
-		otelgrpc.UnaryClientInterceptor(),
+		otelgrpc.UnaryClientInterceptor(o.interceptorOptions()...),
+		opentelemetry.SpanFromContext,
+		o.toSDKOptions(),
+		map[string]string{},
+		opentelemetry.NewRpcOperationMetricsHandler(),
+	)
+}
+
+// StreamClientInterceptor returns a grpc.StreamClientInterceptor suitable
+// for use in a grpc.Dial call.
+func StreamClientInterceptor(opts ...Option) grpc.StreamClientInterceptor {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return sdkgrpc.WrapStreamClientInterceptor(
+		otelgrpc.StreamClientInterceptor(o.interceptorOptions()...),
 		opentelemetry.SpanFromContext,
+		o.toSDKOptions(),
 		map[string]string{},
+		opentelemetry.NewRpcOperationMetricsHandler(),
 	)
 }
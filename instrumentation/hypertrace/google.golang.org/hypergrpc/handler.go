@@ -0,0 +1,77 @@
+package hypergrpc // import "github.com/hypertrace/goagent/instrumentation/hypertrace/google.golang.org/hypergrpc"
+
+import (
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry"
+	sdkgrpc "github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/stats"
+)
+
+// NewServerHandler returns a stats.Handler suitable for use in a grpc.NewServer call
+// through grpc.StatsHandler. Blocking requests with a filter requires adding the
+// FilterUnaryServerInterceptor and FilterStreamServerInterceptor to the server.
+func NewServerHandler(opts ...Option) stats.Handler {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return sdkgrpc.WrapStatsHandler(
+		otelgrpc.NewServerHandler(o.handlerOptions()...),
+		opentelemetry.SpanFromContext,
+		o.toSDKOptions(),
+	)
+}
+
+// FilterUnaryServerInterceptor returns a grpc.UnaryServerInterceptor rejecting the
+// requests blocked by the filter of the server handler.
+func FilterUnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return sdkgrpc.FilterUnaryServerInterceptor()
+}
+
+// FilterStreamServerInterceptor returns a grpc.StreamServerInterceptor rejecting the
+// requests blocked by the filter of the server handler.
+func FilterStreamServerInterceptor() grpc.StreamServerInterceptor {
+	return sdkgrpc.FilterStreamServerInterceptor()
+}
+
+// NewClientHandler returns a stats.Handler suitable for use in a grpc.NewClient call
+// through grpc.WithStatsHandler. Each attempt of the RPCs, including the retries, is
+// recorded in its own span, the attempts are numbered when UnaryClientAttemptsInterceptor
+// and StreamClientAttemptsInterceptor are added to the client.
+func NewClientHandler(opts ...Option) stats.Handler {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return sdkgrpc.WrapStatsHandler(
+		otelgrpc.NewClientHandler(o.handlerOptions()...),
+		opentelemetry.SpanFromContext,
+		o.toSDKOptions(),
+	)
+}
+
+// UnaryClientAttemptsInterceptor returns a grpc.UnaryClientInterceptor numbering the
+// attempts of the RPCs recorded by the client handler.
+func UnaryClientAttemptsInterceptor() grpc.UnaryClientInterceptor {
+	return sdkgrpc.UnaryClientAttemptsInterceptor()
+}
+
+// StreamClientAttemptsInterceptor returns a grpc.StreamClientInterceptor numbering the
+// attempts of the RPCs recorded by the client handler.
+func StreamClientAttemptsInterceptor() grpc.StreamClientInterceptor {
+	return sdkgrpc.StreamClientAttemptsInterceptor()
+}
+
+// WrapClientConnStats wraps the client handler so it also records the connection events.
+// The connectivity state transitions are recorded by watching the ClientConn:
+//
+//	connStats := hypergrpc.WrapClientConnStats(hypergrpc.NewClientHandler())
+//	conn, err := grpc.NewClient(target, grpc.WithStatsHandler(connStats))
+//	...
+//	go connStats.Watch(ctx, conn)
+func WrapClientConnStats(delegate stats.Handler) *sdkgrpc.ClientConnStats {
+	return sdkgrpc.WrapClientConnStats(delegate, opentelemetry.StartSpan)
+}
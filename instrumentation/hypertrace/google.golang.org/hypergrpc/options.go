@@ -1,12 +1,21 @@
 package hypergrpc // import "github.com/hypertrace/goagent/instrumentation/hypertrace/google.golang.org/hypergrpc"
 
 import (
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry/google.golang.org/hypergrpc"
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/exclusion"
 	"github.com/hypertrace/goagent/sdk/filter"
 	"github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 )
 
 type options struct {
-	Filter filter.Filter
+	Filter             filter.Filter
+	MaxStreamMessages  int
+	DescriptorResolver grpc.DescriptorResolver
+	MarshalOptions     *grpc.MarshalOptions
+	Exclusions         exclusion.Rules
+	PanicRecovery      sdk.PanicRecovery
 }
 
 func (o *options) toSDKOptions() *grpc.Options {
@@ -22,3 +31,61 @@ func WithFilter(f filter.Filter) Option {
 		o.Filter = f
 	}
 }
+
+// WithMaxStreamMessages sets the number of messages recorded per direction in
+// streaming RPCs.
+func WithMaxStreamMessages(n int) Option {
+	return func(o *options) {
+		o.MaxStreamMessages = n
+	}
+}
+
+// WithDescriptorResolver sets the resolver of the descriptors used to decode the raw
+// frames of RPCs handled without generated types, e.g. by proxies.
+func WithDescriptorResolver(r grpc.DescriptorResolver) Option {
+	return func(o *options) {
+		o.DescriptorResolver = r
+	}
+}
+
+// WithMarshalOptions configures the serialization of the recorded bodies and the
+// fields redacted from them.
+func WithMarshalOptions(opts grpc.MarshalOptions) Option {
+	return func(o *options) {
+		o.MarshalOptions = &opts
+	}
+}
+
+// WithExclusions sets the rules of the RPCs for which the span is not created or the
+// data is not captured, e.g. exclusion.DefaultRules(exclusion.SkipSpan) for the health
+// checks and reflection calls.
+func WithExclusions(rules ...exclusion.Rule) Option {
+	return func(o *options) {
+		o.Exclusions = append(o.Exclusions, rules...)
+	}
+}
+
+// WithPanicRecovery records the panics of the server handlers on the span, either
+// panicking again with sdk.PanicRecoveryRecord or returning an Internal error with
+// sdk.PanicRecoveryRespond. It only applies to the server interceptors.
+func WithPanicRecovery(r sdk.PanicRecovery) Option {
+	return func(o *options) {
+		o.PanicRecovery = r
+	}
+}
+
+// interceptorOptions returns the options of the otelgrpc interceptors.
+func (o *options) interceptorOptions() []otelgrpc.Option {
+	if len(o.Exclusions) == 0 {
+		return nil
+	}
+	return []otelgrpc.Option{otelgrpc.WithInterceptorFilter(hypergrpc.ExclusionInterceptorFilter(o.Exclusions))} // nolint:staticcheck
+}
+
+// handlerOptions returns the options of the otelgrpc stats handlers.
+func (o *options) handlerOptions() []otelgrpc.Option {
+	if len(o.Exclusions) == 0 {
+		return nil
+	}
+	return []otelgrpc.Option{otelgrpc.WithFilter(hypergrpc.ExclusionFilter(o.Exclusions))}
+}
@@ -3,13 +3,43 @@ package hypergrpc // import "github.com/hypertrace/goagent/instrumentation/hyper
 import (
 	"testing"
 
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/exclusion"
 	"github.com/hypertrace/goagent/sdk/filter"
+	sdkgrpc "github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestOptionsToSDK(t *testing.T) {
+	resolver := sdkgrpc.NewRegistryDescriptorResolver(nil)
 	o := &options{
-		Filter: filter.NoopFilter{},
+		Filter:             filter.NoopFilter{},
+		MaxStreamMessages:  3,
+		DescriptorResolver: resolver,
 	}
 	assert.Equal(t, filter.NoopFilter{}, o.toSDKOptions().Filter)
+	assert.Equal(t, 3, o.toSDKOptions().MaxStreamMessages)
+	assert.Equal(t, resolver, o.toSDKOptions().DescriptorResolver)
+}
+
+func TestWithMarshalOptions(t *testing.T) {
+	o := &options{}
+	WithMarshalOptions(sdkgrpc.MarshalOptions{MaskedFields: []string{"acme.User.password"}})(o)
+	assert.Equal(t, []string{"acme.User.password"}, o.toSDKOptions().MarshalOptions.MaskedFields)
+}
+
+func TestWithExclusions(t *testing.T) {
+	o := &options{}
+	WithExclusions(exclusion.DefaultRules(exclusion.SkipSpan)...)(o)
+	assert.Equal(t, exclusion.DefaultRules(exclusion.SkipSpan), o.toSDKOptions().Exclusions)
+	assert.Len(t, o.interceptorOptions(), 1)
+	assert.Len(t, o.handlerOptions(), 1)
+
+	assert.Empty(t, (&options{}).handlerOptions())
+}
+
+func TestWithPanicRecovery(t *testing.T) {
+	o := &options{}
+	WithPanicRecovery(sdk.PanicRecoveryRespond)(o)
+	assert.Equal(t, sdk.PanicRecoveryRespond, o.toSDKOptions().PanicRecovery)
 }
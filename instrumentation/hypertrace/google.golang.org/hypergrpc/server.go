@@ -16,9 +16,27 @@ func UnaryServerInterceptor(opts ...Option) grpc.UnaryServerInterceptor {
 	}
 
 	return sdkgrpc.WrapUnaryServerInterceptor(
-		otelgrpc.UnaryServerInterceptor(),
+		otelgrpc.UnaryServerInterceptor(o.interceptorOptions()...),
 		opentelemetry.SpanFromContext,
 		o.toSDKOptions(),
 		map[string]string{},
+		opentelemetry.NewRpcOperationMetricsHandler(),
+	)
+}
+
+// StreamServerInterceptor returns a grpc.StreamServerInterceptor suitable
+// for use in a grpc.NewServer call.
+func StreamServerInterceptor(opts ...Option) grpc.StreamServerInterceptor {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return sdkgrpc.WrapStreamServerInterceptor(
+		otelgrpc.StreamServerInterceptor(o.interceptorOptions()...),
+		opentelemetry.SpanFromContext,
+		o.toSDKOptions(),
+		map[string]string{},
+		opentelemetry.NewRpcOperationMetricsHandler(),
 	)
 }
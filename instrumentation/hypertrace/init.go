@@ -9,3 +9,7 @@ import (
 var Init = opentelemetry.Init
 
 var RegisterService = opentelemetry.RegisterService
+
+// NewLogHandler returns a slog.Handler exporting the records through the logs pipeline
+// enabled by HT_LOGS_ENABLED.
+var NewLogHandler = opentelemetry.NewLogHandler
@@ -0,0 +1,19 @@
+package hyperslog // import "github.com/hypertrace/goagent/instrumentation/hypertrace/log/hyperslog"
+
+import (
+	otelslog "github.com/hypertrace/goagent/instrumentation/opentelemetry/log/hyperslog"
+)
+
+// Handler adds the trace_id, span_id and trace_flags of the span in the context to the
+// records before passing them to the wrapped handler.
+type Handler = otelslog.Handler
+
+// Option configures the Handler.
+type Option = otelslog.Option
+
+// NewHandler wraps a slog.Handler so the records it handles are correlated with the traces.
+var NewHandler = otelslog.NewHandler
+
+// WithErrorEvents mirrors the records of level error and above onto the span in the
+// context as events.
+var WithErrorEvents = otelslog.WithErrorEvents
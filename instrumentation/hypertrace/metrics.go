@@ -5,3 +5,17 @@ import (
 )
 
 var NewHttpOperationMetricsHandler = opentelemetry.NewHttpOperationMetricsHandler
+
+var NewHttpClientMetricsHandler = opentelemetry.NewHttpClientMetricsHandler
+
+var NewRpcOperationMetricsHandler = opentelemetry.NewRpcOperationMetricsHandler
+
+// SetDefaultMetricsOptions sets the options of the metrics recorded by the instrumentations,
+// e.g. the buckets of the histograms.
+var SetDefaultMetricsOptions = opentelemetry.SetDefaultMetricsOptions
+
+var (
+	WithDurationBuckets    = opentelemetry.WithDurationBuckets
+	WithSizeBuckets        = opentelemetry.WithSizeBuckets
+	WithMaxServerAddresses = opentelemetry.WithMaxServerAddresses
+)
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/hypertrace/goagent/instrumentation/opentelemetry"
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry/net/hyperhttp"
 	sdkhttp "github.com/hypertrace/goagent/sdk/instrumentation/net/http"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
@@ -17,8 +18,17 @@ func NewHandler(base http.Handler, operation string, opts ...Option) http.Handle
 
 	mh := opentelemetry.NewHttpOperationMetricsHandler(func(_ *http.Request) string { return operation })
 
+	sdkOpts := o.toSDKOptions()
+	sdkOpts.RouteTemplateGetter = func(_ *http.Request) string { return operation }
+
+	var otelOpts []otelhttp.Option
+	if len(o.Exclusions) > 0 {
+		otelOpts = append(otelOpts, otelhttp.WithFilter(hyperhttp.ExclusionFilter(o.Exclusions, sdkOpts.RouteTemplateGetter)))
+	}
+
 	return otelhttp.NewHandler(
-		sdkhttp.WrapHandler(base, opentelemetry.SpanFromContext, o.toSDKOptions(), map[string]string{}, mh),
+		sdkhttp.WrapHandler(base, opentelemetry.SpanFromContext, sdkOpts, map[string]string{}, mh),
 		operation,
+		otelOpts...,
 	)
 }
@@ -3,6 +3,8 @@ package hyperhttp
 import (
 	"testing"
 
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/exclusion"
 	"github.com/hypertrace/goagent/sdk/filter"
 	"github.com/stretchr/testify/assert"
 )
@@ -13,3 +15,15 @@ func TestOptionsToSDK(t *testing.T) {
 	}
 	assert.Equal(t, filter.NoopFilter{}, o.toSDKOptions().Filter)
 }
+
+func TestWithExclusions(t *testing.T) {
+	o := &options{}
+	WithExclusions(exclusion.Rule{Path: "/healthz", Action: exclusion.SkipSpan})(o)
+	assert.Equal(t, exclusion.Rules{{Path: "/healthz", Action: exclusion.SkipSpan}}, o.toSDKOptions().Exclusions)
+}
+
+func TestWithPanicRecovery(t *testing.T) {
+	o := &options{}
+	WithPanicRecovery(sdk.PanicRecoveryRespond)(o)
+	assert.Equal(t, sdk.PanicRecoveryRespond, o.toSDKOptions().PanicRecovery)
+}
@@ -0,0 +1,254 @@
+package opentelemetry // import "github.com/hypertrace/goagent/instrumentation/opentelemetry"
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	internalconfig "github.com/hypertrace/goagent/internal/config"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+)
+
+// Environment variables configuring the cloud metadata detectors.
+const (
+	// CloudMetadataTimeoutEnv is the maximum time a cloud detector waits for the metadata
+	// endpoints, as a duration e.g. "300ms".
+	CloudMetadataTimeoutEnv = "HT_CLOUD_METADATA_TIMEOUT"
+	// AWSMetadataURLEnv overrides the base URL of the EC2 instance metadata service.
+	AWSMetadataURLEnv = "HT_AWS_METADATA_URL"
+	// GCPMetadataURLEnv overrides the base URL of the GCE metadata server.
+	GCPMetadataURLEnv = "HT_GCP_METADATA_URL"
+	// AzureMetadataURLEnv overrides the base URL of the Azure instance metadata service.
+	AzureMetadataURLEnv = "HT_AZURE_METADATA_URL"
+)
+
+const defaultCloudMetadataTimeout = 500 * time.Millisecond
+
+// cloudDetector queries the metadata endpoints of a cloud provider once and caches the
+// attributes found so Init and RegisterService don't wait on them again.
+type cloudDetector struct {
+	urlEnv         string
+	defaultBaseURL string
+	detect         func(ctx context.Context, client *http.Client, baseURL string) ([]attribute.KeyValue, error)
+
+	once  sync.Once
+	attrs []attribute.KeyValue
+}
+
+func (d *cloudDetector) attributes() []attribute.KeyValue {
+	d.once.Do(func() {
+		baseURL := firstNonEmpty(os.Getenv(d.urlEnv), d.defaultBaseURL)
+
+		timeout := internalconfig.DurationEnv(CloudMetadataTimeoutEnv, defaultCloudMetadataTimeout)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		// not being on the cloud is not an error worth reporting
+		d.attrs, _ = d.detect(ctx, newMetadataClient(timeout), strings.TrimSuffix(baseURL, "/"))
+	})
+	return d.attrs
+}
+
+// newMetadataClient returns a client talking to the metadata endpoints directly, the
+// proxy settings being ignored so the requests (and the IMDSv2 token) never leave the
+// host, and the redirects not being followed.
+func newMetadataClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{Proxy: nil},
+		Timeout:   timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+var (
+	awsDetector = &cloudDetector{
+		urlEnv:         AWSMetadataURLEnv,
+		defaultBaseURL: "http://169.254.169.254",
+		detect:         detectAWS,
+	}
+	gcpDetector = &cloudDetector{
+		urlEnv:         GCPMetadataURLEnv,
+		defaultBaseURL: "http://metadata.google.internal",
+		detect:         detectGCP,
+	}
+	azureDetector = &cloudDetector{
+		urlEnv:         AzureMetadataURLEnv,
+		defaultBaseURL: "http://169.254.169.254",
+		detect:         detectAzure,
+	}
+)
+
+// getMetadata sends a metadata request and returns the response body.
+func getMetadata(ctx context.Context, client *http.Client, method, url string, headers map[string]string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d from %s", res.StatusCode, url)
+	}
+	return io.ReadAll(io.LimitReader(res.Body, 1<<20))
+}
+
+func appendIfNotEmpty(attrs []attribute.KeyValue, key attribute.Key, value string) []attribute.KeyValue {
+	if value == "" {
+		return attrs
+	}
+	return append(attrs, key.String(value))
+}
+
+// detectAWS reads the ECS task metadata when running on ECS, the EC2 instance identity
+// document through IMDSv2 otherwise.
+func detectAWS(ctx context.Context, client *http.Client, baseURL string) ([]attribute.KeyValue, error) {
+	if ecsURL := firstNonEmpty(os.Getenv("ECS_CONTAINER_METADATA_URI_V4"), os.Getenv("ECS_CONTAINER_METADATA_URI")); ecsURL != "" {
+		return detectECS(ctx, client, ecsURL)
+	}
+
+	token, err := getMetadata(ctx, client, http.MethodPut, baseURL+"/latest/api/token",
+		map[string]string{"X-aws-ec2-metadata-token-ttl-seconds": "60"})
+	if err != nil {
+		return nil, err
+	}
+	body, err := getMetadata(ctx, client, http.MethodGet, baseURL+"/latest/dynamic/instance-identity/document",
+		map[string]string{"X-aws-ec2-metadata-token": string(token)})
+	if err != nil {
+		return nil, err
+	}
+
+	var document struct {
+		AccountID        string `json:"accountId"`
+		AvailabilityZone string `json:"availabilityZone"`
+		Region           string `json:"region"`
+		InstanceID       string `json:"instanceId"`
+	}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return nil, err
+	}
+
+	platform := semconv.CloudPlatformAWSEC2
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		platform = semconv.CloudPlatformAWSEKS
+	}
+	attrs := []attribute.KeyValue{semconv.CloudProviderAWS, platform}
+	attrs = appendIfNotEmpty(attrs, semconv.CloudRegionKey, document.Region)
+	attrs = appendIfNotEmpty(attrs, semconv.CloudAvailabilityZoneKey, document.AvailabilityZone)
+	attrs = appendIfNotEmpty(attrs, semconv.CloudAccountIDKey, document.AccountID)
+	attrs = appendIfNotEmpty(attrs, semconv.HostIDKey, document.InstanceID)
+	return attrs, nil
+}
+
+// detectECS reads the task metadata, the region and the account being part of the cluster
+// ARN, i.e. arn:aws:ecs:<region>:<account>:cluster/<name>.
+func detectECS(ctx context.Context, client *http.Client, metadataURL string) ([]attribute.KeyValue, error) {
+	body, err := getMetadata(ctx, client, http.MethodGet, strings.TrimSuffix(metadataURL, "/")+"/task", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var task struct {
+		Cluster          string `json:"Cluster"`
+		AvailabilityZone string `json:"AvailabilityZone"`
+	}
+	if err := json.Unmarshal(body, &task); err != nil {
+		return nil, err
+	}
+
+	attrs := []attribute.KeyValue{semconv.CloudProviderAWS, semconv.CloudPlatformAWSECS}
+	if arn := strings.Split(task.Cluster, ":"); len(arn) >= 6 {
+		attrs = appendIfNotEmpty(attrs, semconv.CloudRegionKey, arn[3])
+		attrs = appendIfNotEmpty(attrs, semconv.CloudAccountIDKey, arn[4])
+	} else {
+		attrs = appendIfNotEmpty(attrs, semconv.CloudRegionKey, os.Getenv("AWS_REGION"))
+	}
+	attrs = appendIfNotEmpty(attrs, semconv.CloudAvailabilityZoneKey, task.AvailabilityZone)
+	return attrs, nil
+}
+
+// detectGCP queries the GCE metadata server, also available on GKE and Cloud Run.
+func detectGCP(ctx context.Context, client *http.Client, baseURL string) ([]attribute.KeyValue, error) {
+	get := func(path string) (string, error) {
+		body, err := getMetadata(ctx, client, http.MethodGet, baseURL+"/computeMetadata/v1/"+path,
+			map[string]string{"Metadata-Flavor": "Google"})
+		return strings.TrimSpace(string(body)), err
+	}
+
+	projectID, err := get("project/project-id")
+	if err != nil {
+		return nil, err
+	}
+
+	platform := semconv.CloudPlatformGCPComputeEngine
+	switch {
+	case os.Getenv("K_SERVICE") != "":
+		platform = semconv.CloudPlatformGCPCloudRun
+	case os.Getenv("KUBERNETES_SERVICE_HOST") != "":
+		platform = semconv.CloudPlatformGCPKubernetesEngine
+	}
+	attrs := []attribute.KeyValue{semconv.CloudProviderGCP, platform}
+	attrs = appendIfNotEmpty(attrs, semconv.CloudAccountIDKey, projectID)
+
+	// zone and region are resource names, e.g. projects/<number>/zones/<zone>
+	if zone, err := get("instance/zone"); err == nil && zone != "" {
+		zone = zone[strings.LastIndex(zone, "/")+1:]
+		attrs = appendIfNotEmpty(attrs, semconv.CloudAvailabilityZoneKey, zone)
+		if i := strings.LastIndex(zone, "-"); i > 0 {
+			attrs = appendIfNotEmpty(attrs, semconv.CloudRegionKey, zone[:i])
+		}
+	} else if region, err := get("instance/region"); err == nil {
+		attrs = appendIfNotEmpty(attrs, semconv.CloudRegionKey, region[strings.LastIndex(region, "/")+1:])
+	}
+
+	if instanceID, err := get("instance/id"); err == nil {
+		attrs = appendIfNotEmpty(attrs, semconv.HostIDKey, instanceID)
+	}
+	return attrs, nil
+}
+
+// detectAzure queries the compute metadata of the Azure instance metadata service.
+func detectAzure(ctx context.Context, client *http.Client, baseURL string) ([]attribute.KeyValue, error) {
+	body, err := getMetadata(ctx, client, http.MethodGet, baseURL+"/metadata/instance/compute?api-version=2021-12-13&format=json",
+		map[string]string{"Metadata": "true"})
+	if err != nil {
+		return nil, err
+	}
+
+	var compute struct {
+		Location       string `json:"location"`
+		Zone           string `json:"zone"`
+		SubscriptionID string `json:"subscriptionId"`
+		VMID           string `json:"vmId"`
+	}
+	if err := json.Unmarshal(body, &compute); err != nil {
+		return nil, err
+	}
+
+	platform := semconv.CloudPlatformAzureVM
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		platform = semconv.CloudPlatformAzureAKS
+	}
+	attrs := []attribute.KeyValue{semconv.CloudProviderAzure, platform}
+	attrs = appendIfNotEmpty(attrs, semconv.CloudRegionKey, compute.Location)
+	attrs = appendIfNotEmpty(attrs, semconv.CloudAvailabilityZoneKey, compute.Zone)
+	attrs = appendIfNotEmpty(attrs, semconv.CloudAccountIDKey, compute.SubscriptionID)
+	attrs = appendIfNotEmpty(attrs, semconv.HostIDKey, compute.VMID)
+	return attrs, nil
+}
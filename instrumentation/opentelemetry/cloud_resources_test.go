@@ -0,0 +1,159 @@
+package opentelemetry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveMetadata points d to a local metadata endpoint and returns its request count.
+func serveMetadata(t *testing.T, d *cloudDetector, handler http.HandlerFunc) *int32 {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv(d.urlEnv, server.URL)
+	return &requests
+}
+
+func TestAWSDetectorUsesIMDSv2(t *testing.T) {
+	t.Setenv("ECS_CONTAINER_METADATA_URI_V4", "")
+	t.Setenv("ECS_CONTAINER_METADATA_URI", "")
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+
+	d := &cloudDetector{urlEnv: AWSMetadataURLEnv, detect: detectAWS}
+	requests := serveMetadata(t, d, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/latest/api/token":
+			assert.Equal(t, http.MethodPut, r.Method)
+			assert.Equal(t, "60", r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds"))
+			w.Write([]byte("test-token"))
+		case "/latest/dynamic/instance-identity/document":
+			if r.Header.Get("X-aws-ec2-metadata-token") != "test-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"accountId":"123456789012","availabilityZone":"us-west-2b","region":"us-west-2","instanceId":"i-1234567890abcdef0"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	expected := map[string]interface{}{
+		"cloud.provider":          "aws",
+		"cloud.platform":          "aws_ec2",
+		"cloud.region":            "us-west-2",
+		"cloud.availability_zone": "us-west-2b",
+		"cloud.account.id":        "123456789012",
+		"host.id":                 "i-1234567890abcdef0",
+	}
+	assert.Equal(t, expected, attributesMap(d.attributes()))
+
+	// the attributes are cached
+	assert.Equal(t, expected, attributesMap(d.attributes()))
+	assert.Equal(t, int32(2), atomic.LoadInt32(requests))
+}
+
+func TestAWSDetectorUsesECSTaskMetadata(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v4/abc/task", r.URL.Path)
+		w.Write([]byte(`{"Cluster":"arn:aws:ecs:eu-west-1:123456789012:cluster/default","AvailabilityZone":"eu-west-1a"}`))
+	}))
+	defer server.Close()
+	t.Setenv("ECS_CONTAINER_METADATA_URI_V4", server.URL+"/v4/abc")
+
+	d := &cloudDetector{urlEnv: AWSMetadataURLEnv, defaultBaseURL: "http://127.0.0.1:0", detect: detectAWS}
+	assert.Equal(t, map[string]interface{}{
+		"cloud.provider":          "aws",
+		"cloud.platform":          "aws_ecs",
+		"cloud.region":            "eu-west-1",
+		"cloud.availability_zone": "eu-west-1a",
+		"cloud.account.id":        "123456789012",
+	}, attributesMap(d.attributes()))
+}
+
+func TestGCPDetector(t *testing.T) {
+	t.Setenv("K_SERVICE", "checkout")
+
+	d := &cloudDetector{urlEnv: GCPMetadataURLEnv, detect: detectGCP}
+	serveMetadata(t, d, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/computeMetadata/v1/project/project-id":
+			w.Write([]byte("my-project"))
+		case "/computeMetadata/v1/instance/zone":
+			w.Write([]byte("projects/1234/zones/us-central1-c"))
+		case "/computeMetadata/v1/instance/id":
+			w.Write([]byte("4520031799277581759"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	assert.Equal(t, map[string]interface{}{
+		"cloud.provider":          "gcp",
+		"cloud.platform":          "gcp_cloud_run",
+		"cloud.region":            "us-central1",
+		"cloud.availability_zone": "us-central1-c",
+		"cloud.account.id":        "my-project",
+		"host.id":                 "4520031799277581759",
+	}, attributesMap(d.attributes()))
+}
+
+func TestAzureDetector(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+
+	d := &cloudDetector{urlEnv: AzureMetadataURLEnv, detect: detectAzure}
+	serveMetadata(t, d, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metadata/instance/compute" || r.Header.Get("Metadata") != "true" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"location":"westeurope","zone":"1","subscriptionId":"8d10da13-8125-4ba9-a717-bf7490507b3d","vmId":"02aab8a4-74ef-476e-8182-f6d2ba4166a6"}`))
+	})
+
+	assert.Equal(t, map[string]interface{}{
+		"cloud.provider":          "azure",
+		"cloud.platform":          "azure_vm",
+		"cloud.region":            "westeurope",
+		"cloud.availability_zone": "1",
+		"cloud.account.id":        "8d10da13-8125-4ba9-a717-bf7490507b3d",
+		"host.id":                 "02aab8a4-74ef-476e-8182-f6d2ba4166a6",
+	}, attributesMap(d.attributes()))
+}
+
+func TestCloudDetectorTimesOut(t *testing.T) {
+	t.Setenv(CloudMetadataTimeoutEnv, "50ms")
+
+	d := &cloudDetector{urlEnv: AzureMetadataURLEnv, detect: detectAzure}
+	serveMetadata(t, d, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	})
+
+	start := time.Now()
+	assert.Empty(t, d.attributes())
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+}
+
+func TestCloudDetectorDoesNotFollowRedirects(t *testing.T) {
+	d := &cloudDetector{urlEnv: AzureMetadataURLEnv, detect: detectAzure}
+	requests := serveMetadata(t, d, func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/elsewhere", http.StatusFound)
+	})
+
+	assert.Empty(t, d.attributes())
+	assert.Equal(t, int32(1), atomic.LoadInt32(requests))
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/hypertrace/goagent/instrumentation/opentelemetry"
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry/net/hyperhttp"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 
 	sdkhttp "github.com/hypertrace/goagent/sdk/instrumentation/net/http"
@@ -42,7 +43,17 @@ func (h *nextRequestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	h.c.Request = h.c.Request.WithContext(r.Context())
 	h.c.Writer = &wrappedResponseWriter{h.c.Writer, w}
+
+	// when the panic is recovered by the handler, the remaining handlers of the chain
+	// must not run, as gin.Recovery does.
+	panicked := true
+	defer func() {
+		if panicked {
+			h.c.Abort()
+		}
+	}()
 	h.c.Next()
+	panicked = false
 }
 
 // Wrap something that accepts an http.Handler, returns an http.Handler
@@ -80,13 +91,37 @@ func spanNameFormatter(operation string, r *http.Request) (spanName string) {
 	return routeWrapper.route
 }
 
+// getRouteTemplate returns the gin route template (e.g. /users/:id) appended to the
+// request context or an empty string if there is none.
+func getRouteTemplate(r *http.Request) string {
+	routeWrapper, ok := r.Context().Value(hyperGinKey).(ginRoute)
+	if !ok {
+		return ""
+	}
+
+	return routeWrapper.route
+}
+
 func Middleware(options *sdkhttp.Options) gin.HandlerFunc {
+	o := sdkhttp.Options{}
+	if options != nil {
+		o = *options
+	}
+	if o.RouteTemplateGetter == nil {
+		o.RouteTemplateGetter = getRouteTemplate
+	}
+
+	otelOpts := []otelhttp.Option{otelhttp.WithSpanNameFormatter(spanNameFormatter)}
+	if len(o.Exclusions) > 0 {
+		otelOpts = append(otelOpts, otelhttp.WithFilter(hyperhttp.ExclusionFilter(o.Exclusions, o.RouteTemplateGetter)))
+	}
+
 	return wrap(func(delegate http.Handler) http.Handler {
 		wrappedHandler, ok := delegate.(*nextRequestHandler)
 		ginOperationName := ""
 		// if we fail to extract the next request handler from delegate the route template won't be reported
 		if ok {
-			ginOperationName := wrappedHandler.c.FullPath()
+			ginOperationName = wrappedHandler.c.FullPath()
 			rc := wrappedHandler.c.Request.Context()
 			ctx := context.WithValue(rc, hyperGinKey, ginRoute{route: ginOperationName})
 			wrappedHandler.c.Request = wrappedHandler.c.Request.WithContext(ctx)
@@ -94,9 +129,9 @@ func Middleware(options *sdkhttp.Options) gin.HandlerFunc {
 
 		mh := opentelemetry.NewHttpOperationMetricsHandler(func(_ *http.Request) string { return ginOperationName })
 		return otelhttp.NewHandler(
-			sdkhttp.WrapHandler(delegate, opentelemetry.SpanFromContext, options, map[string]string{}, mh),
+			sdkhttp.WrapHandler(delegate, opentelemetry.SpanFromContext, &o, map[string]string{}, mh),
 			"",
-			otelhttp.WithSpanNameFormatter(spanNameFormatter),
+			otelOpts...,
 		)
 	})
 }
@@ -12,9 +12,12 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/hypertrace/goagent/instrumentation/hypertrace/net/hyperhttp"
 	"github.com/hypertrace/goagent/instrumentation/opentelemetry/internal/tracetesting"
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/exclusion"
 	sdkhttp "github.com/hypertrace/goagent/sdk/instrumentation/net/http"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -163,3 +166,61 @@ func TestTraceContextIsPropagated(t *testing.T) {
 		assert.Equal(t, traceId, span.SpanContext().TraceID().String())
 	}
 }
+
+func TestExclusions(t *testing.T) {
+	_, flusher := tracetesting.InitTracer()
+
+	r := gin.Default()
+	r.Use(Middleware(&sdkhttp.Options{Exclusions: exclusion.Rules{
+		{Path: "/healthz", Action: exclusion.SkipSpan},
+		{Route: "/internal/*", Action: exclusion.SkipDataCapture},
+	}}))
+	r.GET("/healthz", handler)
+	r.GET("/internal/:name", handler)
+
+	for _, url := range []string{"http://example.com/healthz", "http://example.com/internal/status"} {
+		req := httptest.NewRequest("GET", url, nil)
+		req.Header.Set("api_key", "abc123xyz")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, 200, w.Result().StatusCode)
+	}
+
+	spans := flusher()
+	require.Equal(t, 1, len(spans))
+	assert.Equal(t, "/internal/:name", spans[0].Name())
+
+	attrs := tracetesting.LookupAttributes(spans[0].Attributes())
+	assert.False(t, attrs.Has("http.request.header.api_key"))
+	assert.False(t, attrs.Has("http.response.body"))
+}
+
+func TestPanicIsRecordedAndRecovered(t *testing.T) {
+	_, flusher := tracetesting.InitTracer()
+
+	var nextCalled bool
+	r := gin.New()
+	r.Use(Middleware(&sdkhttp.Options{PanicRecovery: sdk.PanicRecoveryRespond}))
+	r.GET("/things/:thing_id", func(c *gin.Context) {
+		panic("boom")
+	}, func(c *gin.Context) {
+		nextCalled = true
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/things/123", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.False(t, nextCalled)
+
+	spans := flusher()
+	require.Equal(t, 1, len(spans))
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+
+	require.Equal(t, 1, len(spans[0].Events()))
+	event := spans[0].Events()[0]
+	assert.Equal(t, "exception", event.Name)
+	attrs := tracetesting.LookupAttributes(event.Attributes)
+	assert.Equal(t, "boom", attrs.Get("exception.message").AsString())
+	assert.Contains(t, attrs.Get("exception.stacktrace").AsString(), "gin_test.go")
+}
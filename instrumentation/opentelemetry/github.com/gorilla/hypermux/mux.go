@@ -5,6 +5,7 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/hypertrace/goagent/instrumentation/opentelemetry"
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry/net/hyperhttp"
 	sdkhttp "github.com/hypertrace/goagent/sdk/instrumentation/net/http"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
@@ -14,16 +15,7 @@ func spanNameFormatter(operation string, r *http.Request) string {
 }
 
 func getOperationNameFromRoute(r *http.Request) string {
-	route := mux.CurrentRoute(r)
-	spanName := ""
-	if route != nil {
-		var err error
-		spanName, err = route.GetPathTemplate()
-		if err != nil {
-			spanName, _ = route.GetPathRegexp()
-		}
-	}
-
+	spanName := getRouteTemplate(r)
 	if spanName == "" {
 		// if somehow retrieving the path template or path regexp fails, we still
 		// want to use the method as fallback.
@@ -32,14 +24,42 @@ func getOperationNameFromRoute(r *http.Request) string {
 	return spanName
 }
 
+// getRouteTemplate returns the path template (or the path regexp) of the
+// matched route or an empty string if no route was matched.
+func getRouteTemplate(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return ""
+	}
+
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		template, _ = route.GetPathRegexp()
+	}
+	return template
+}
+
 // NewMiddleware sets up a handler to start tracing the incoming requests.
 func NewMiddleware(options *sdkhttp.Options) mux.MiddlewareFunc {
 	mh := opentelemetry.NewHttpOperationMetricsHandler(getOperationNameFromRoute)
+	o := sdkhttp.Options{}
+	if options != nil {
+		o = *options
+	}
+	if o.RouteTemplateGetter == nil {
+		o.RouteTemplateGetter = getRouteTemplate
+	}
+
+	otelOpts := []otelhttp.Option{otelhttp.WithSpanNameFormatter(spanNameFormatter)}
+	if len(o.Exclusions) > 0 {
+		otelOpts = append(otelOpts, otelhttp.WithFilter(hyperhttp.ExclusionFilter(o.Exclusions, o.RouteTemplateGetter)))
+	}
+
 	return func(delegate http.Handler) http.Handler {
 		return otelhttp.NewHandler(
-			sdkhttp.WrapHandler(delegate, opentelemetry.SpanFromContext, options, map[string]string{}, mh),
+			sdkhttp.WrapHandler(delegate, opentelemetry.SpanFromContext, &o, map[string]string{}, mh),
 			"",
-			otelhttp.WithSpanNameFormatter(spanNameFormatter),
+			otelOpts...,
 		)
 	}
 }
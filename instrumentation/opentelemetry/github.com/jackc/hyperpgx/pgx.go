@@ -41,6 +41,12 @@ type wrappedConn struct {
 	connAttrs map[string]string
 }
 
+// setError records err in the span, the stack trace starting at the caller of the
+// instrumented method rather than in this package.
+func setError(span sdk.Span, err error) {
+	span.SetError(err, sdk.WithCallerSkip(2))
+}
+
 var _ pgx.Row = (*wrappedRow)(nil)
 
 type wrappedRow struct {
@@ -51,7 +57,7 @@ type wrappedRow struct {
 func (r *wrappedRow) Scan(dest ...interface{}) error {
 	err := r.delegate.Scan(dest...)
 	if err != nil {
-		r.span.SetError(err)
+		setError(r.span, err)
 	}
 
 	return err
@@ -68,7 +74,7 @@ func (w *wrappedConn) Query(ctx context.Context, query string, optionsAndArgs ..
 
 	rows, err := w.delegate.Query(ctx, query, optionsAndArgs...)
 	if err != nil {
-		span.SetError(err)
+		setError(span, err)
 	}
 
 	return rows, err
@@ -97,7 +103,7 @@ func (w *wrappedConn) Exec(ctx context.Context, sql string, arguments ...interfa
 
 	res, err := w.delegate.Exec(ctx, sql, arguments...)
 	if err != nil {
-		span.SetError(err)
+		setError(span, err)
 	}
 
 	return res, err
@@ -118,7 +124,7 @@ func (w *wrappedConn) QueryFunc(ctx context.Context, sql string, args []interfac
 
 	res, err := w.delegate.QueryFunc(ctx, sql, args, scans, f)
 	if err != nil {
-		span.SetError(err)
+		setError(span, err)
 	}
 
 	return res, err
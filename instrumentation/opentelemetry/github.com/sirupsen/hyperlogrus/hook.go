@@ -0,0 +1,64 @@
+package hyperlogrus // import "github.com/hypertrace/goagent/instrumentation/opentelemetry/github.com/sirupsen/hyperlogrus"
+
+import (
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry/internal/logcorrelation"
+	"github.com/sirupsen/logrus"
+)
+
+type options struct {
+	errorEvents bool
+}
+
+// Option configures the Hook.
+type Option func(*options)
+
+// WithErrorEvents mirrors the entries of level error and above onto the span in the
+// context as events.
+func WithErrorEvents() Option {
+	return func(o *options) {
+		o.errorEvents = true
+	}
+}
+
+var _ logrus.Hook = (*Hook)(nil)
+
+// Hook adds the trace_id, span_id and trace_flags of the span in the entry context, set
+// with WithContext, to the entry fields, e.g.
+//
+//	logrus.AddHook(hyperlogrus.NewHook())
+//	logrus.WithContext(ctx).Info("processing order")
+type Hook struct {
+	opts options
+}
+
+// NewHook returns a Hook correlating the log entries with the traces.
+func NewHook(opts ...Option) *Hook {
+	h := &Hook{}
+	for _, opt := range opts {
+		opt(&h.opts)
+	}
+	return h
+}
+
+// Levels returns all the levels.
+func (h *Hook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire adds the trace context to the entry.
+func (h *Hook) Fire(entry *logrus.Entry) error {
+	sc, ok := logcorrelation.SpanContext(entry.Context)
+	if !ok {
+		return nil
+	}
+
+	// lower levels are more severe
+	if h.opts.errorEvents && entry.Level <= logrus.ErrorLevel {
+		logcorrelation.RecordLog(entry.Context, entry.Time, entry.Level.String(), entry.Message, entry.Data)
+	}
+
+	entry.Data[logcorrelation.TraceIDKey] = sc.TraceID().String()
+	entry.Data[logcorrelation.SpanIDKey] = sc.SpanID().String()
+	entry.Data[logcorrelation.TraceFlagsKey] = sc.TraceFlags().String()
+	return nil
+}
@@ -0,0 +1,73 @@
+package hyperlogrus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry/internal/tracetesting"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLogger(buf *bytes.Buffer, hook *Hook) *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(buf)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	logger.AddHook(hook)
+	return logger
+}
+
+func TestHookAddsTraceContext(t *testing.T) {
+	tracer, flusher := tracetesting.InitTracer()
+	buf := &bytes.Buffer{}
+	logger := newLogger(buf, NewHook())
+
+	ctx, span := tracer.Start(context.Background(), "test")
+	logger.WithContext(ctx).WithField("order_id", 1).Error("failed to process order")
+	span.End()
+
+	var entry map[string]interface{}
+	require.NoError(t, json.NewDecoder(buf).Decode(&entry))
+	assert.Equal(t, span.SpanContext().TraceID().String(), entry["trace_id"])
+	assert.Equal(t, span.SpanContext().SpanID().String(), entry["span_id"])
+	assert.Equal(t, "01", entry["trace_flags"])
+
+	// error logs aren't mirrored by default
+	spans := flusher()
+	require.Len(t, spans, 1)
+	assert.Empty(t, spans[0].Events())
+}
+
+func TestHookWithoutContext(t *testing.T) {
+	buf := &bytes.Buffer{}
+	newLogger(buf, NewHook()).Info("no span")
+
+	var entry map[string]interface{}
+	require.NoError(t, json.NewDecoder(buf).Decode(&entry))
+	assert.NotContains(t, entry, "trace_id")
+}
+
+func TestHookMirrorsErrorLogs(t *testing.T) {
+	tracer, flusher := tracetesting.InitTracer()
+	logger := newLogger(&bytes.Buffer{}, NewHook(WithErrorEvents()))
+
+	ctx, span := tracer.Start(context.Background(), "test")
+	logger.WithContext(ctx).Warn("retrying")
+	logger.WithContext(ctx).WithError(errors.New("out of stock")).Error("failed to process order")
+	span.End()
+
+	spans := flusher()
+	require.Len(t, spans, 1)
+	events := spans[0].Events()
+	require.Len(t, events, 1)
+	assert.Equal(t, "log", events[0].Name)
+
+	attrs := tracetesting.LookupAttributes(events[0].Attributes)
+	assert.Equal(t, "error", attrs.Get("log.severity").AsString())
+	assert.Equal(t, "failed to process order", attrs.Get("log.message").AsString())
+	assert.Equal(t, "out of stock", attrs.Get("error").AsString())
+}
@@ -0,0 +1,117 @@
+package hyperzap // import "github.com/hypertrace/goagent/instrumentation/opentelemetry/go.uber.org/hyperzap"
+
+import (
+	"context"
+
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry/internal/logcorrelation"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// traceContext marshals the trace context of the span in ctx inline.
+type traceContext struct {
+	ctx context.Context
+}
+
+func (tc traceContext) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	sc, ok := logcorrelation.SpanContext(tc.ctx)
+	if !ok {
+		return nil
+	}
+	enc.AddString(logcorrelation.TraceIDKey, sc.TraceID().String())
+	enc.AddString(logcorrelation.SpanIDKey, sc.SpanID().String())
+	enc.AddString(logcorrelation.TraceFlagsKey, sc.TraceFlags().String())
+	return nil
+}
+
+// Context returns a field adding the trace_id, span_id and trace_flags of the span in ctx
+// to the log entry, e.g.
+//
+//	logger.Info("processing order", hyperzap.Context(ctx))
+//
+// The field is skipped when there is no span in ctx.
+func Context(ctx context.Context) zap.Field {
+	if _, ok := logcorrelation.SpanContext(ctx); !ok {
+		return zap.Skip()
+	}
+	return zap.Inline(traceContext{ctx})
+}
+
+// contextFromFields returns the context of the last Context field in fields.
+func contextFromFields(fields []zapcore.Field) context.Context {
+	var ctx context.Context
+	for _, f := range fields {
+		if tc, ok := f.Interface.(traceContext); ok && f.Type == zapcore.InlineMarshalerType {
+			ctx = tc.ctx
+		}
+	}
+	return ctx
+}
+
+type options struct {
+	errorEvents bool
+}
+
+// Option configures the core returned by WrapCore.
+type Option func(*options)
+
+// WithErrorEvents mirrors the entries of level error and above onto the span of their
+// Context field as events.
+func WithErrorEvents() Option {
+	return func(o *options) {
+		o.errorEvents = true
+	}
+}
+
+var _ zapcore.Core = (*core)(nil)
+
+type core struct {
+	zapcore.Core
+	opts options
+	ctx  context.Context
+}
+
+// WrapCore wraps c so the entries logged with a Context field, or with a logger built with
+// one, are mirrored onto their span according to the options, e.g.
+//
+//	logger := zap.New(hyperzap.WrapCore(core, hyperzap.WithErrorEvents()))
+func WrapCore(c zapcore.Core, opts ...Option) zapcore.Core {
+	wrapped := &core{Core: c}
+	for _, opt := range opts {
+		opt(&wrapped.opts)
+	}
+	return wrapped
+}
+
+func (c *core) With(fields []zapcore.Field) zapcore.Core {
+	ctx := contextFromFields(fields)
+	if ctx == nil {
+		ctx = c.ctx
+	}
+	return &core{Core: c.Core.With(fields), opts: c.opts, ctx: ctx}
+}
+
+func (c *core) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return ce.AddCore(entry, c)
+	}
+	return ce
+}
+
+func (c *core) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	if c.opts.errorEvents && entry.Level >= zapcore.ErrorLevel {
+		ctx := contextFromFields(fields)
+		if ctx == nil {
+			ctx = c.ctx
+		}
+
+		enc := zapcore.NewMapObjectEncoder()
+		for _, f := range fields {
+			if _, ok := f.Interface.(traceContext); !ok {
+				f.AddTo(enc)
+			}
+		}
+		logcorrelation.RecordLog(ctx, entry.Time, entry.Level.CapitalString(), entry.Message, enc.Fields)
+	}
+	return c.Core.Write(entry, fields)
+}
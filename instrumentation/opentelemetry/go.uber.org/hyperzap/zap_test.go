@@ -0,0 +1,59 @@
+package hyperzap
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry/internal/tracetesting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestContextFieldAddsTraceContext(t *testing.T) {
+	tracer, _ := tracetesting.InitTracer()
+	observed, logs := observer.New(zapcore.InfoLevel)
+	logger := zap.New(observed)
+
+	ctx, span := tracer.Start(context.Background(), "test")
+	logger.Info("processing order", Context(ctx))
+	logger.Info("no span", Context(context.Background()))
+	span.End()
+
+	entries := logs.AllUntimed()
+	require.Len(t, entries, 2)
+	assert.Equal(t, map[string]interface{}{
+		"trace_id":    span.SpanContext().TraceID().String(),
+		"span_id":     span.SpanContext().SpanID().String(),
+		"trace_flags": "01",
+	}, entries[0].ContextMap())
+	assert.Empty(t, entries[1].ContextMap())
+}
+
+func TestWrapCoreMirrorsErrorLogs(t *testing.T) {
+	tracer, flusher := tracetesting.InitTracer()
+	observed, logs := observer.New(zapcore.InfoLevel)
+	logger := zap.New(WrapCore(observed, WithErrorEvents()))
+
+	ctx, span := tracer.Start(context.Background(), "test")
+	logger.Warn("retrying", Context(ctx))
+	logger.With(Context(ctx)).Error("failed to process order", zap.Error(errors.New("out of stock")))
+	span.End()
+
+	require.Len(t, logs.All(), 2)
+
+	spans := flusher()
+	require.Len(t, spans, 1)
+	events := spans[0].Events()
+	require.Len(t, events, 1)
+	assert.Equal(t, "log", events[0].Name)
+
+	attrs := tracetesting.LookupAttributes(events[0].Attributes)
+	assert.Equal(t, "ERROR", attrs.Get("log.severity").AsString())
+	assert.Equal(t, "failed to process order", attrs.Get("log.message").AsString())
+	assert.Equal(t, "out of stock", attrs.Get("error").AsString())
+	assert.False(t, attrs.Has("trace_id"))
+}
@@ -0,0 +1,58 @@
+package hypergrpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry/google.golang.org/hypergrpc/internal/helloworld"
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry/internal/tracetesting"
+	sdkgrpc "github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestClientHandlerRecordsAttempts(t *testing.T) {
+	_, flusher := tracetesting.InitTracer()
+
+	s := grpc.NewServer()
+	defer s.Stop()
+
+	helloworld.RegisterGreeterServer(s, &server{
+		reply: &helloworld.HelloReply{Message: "Hi Pupo"},
+	})
+
+	connStats := WrapClientConnStats(WrapStatsHandler(otelgrpc.NewClientHandler(), &sdkgrpc.Options{}))
+	conn, err := grpc.NewClient(
+		"passthrough:///bufnet",
+		grpc.WithContextDialer(createDialer(s)),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(connStats),
+		grpc.WithUnaryInterceptor(UnaryClientAttemptsInterceptor()),
+	)
+	require.NoError(t, err)
+
+	_, err = helloworld.NewGreeterClient(conn).SayHello(context.Background(), &helloworld.HelloRequest{Name: "Pupo"})
+	require.NoError(t, err)
+
+	spans := flusher()
+	require.Equal(t, 2, len(spans))
+
+	// the connection is established before the attempt ends
+	connectSpan, attemptSpan := spans[0], spans[1]
+
+	assert.Equal(t, "grpc.client.connection", connectSpan.Name())
+	connectAttrs := tracetesting.LookupAttributes(connectSpan.Attributes())
+	assert.Equal(t, "connect", connectAttrs.Get("rpc.grpc.connection.event").AsString())
+
+	assert.Equal(t, "helloworld.Greeter/SayHello", attemptSpan.Name())
+	attrs := tracetesting.LookupAttributes(attemptSpan.Attributes())
+	assert.Equal(t, int64(1), attrs.Get("rpc.grpc.attempt.number").AsInt64())
+	assert.False(t, attrs.Get("rpc.grpc.attempt.transparent_retry").AsBool())
+	assert.Equal(t, "bufconn", attrs.Get("rpc.grpc.attempt.peer.address").AsString())
+	assert.Equal(t, int64(0), attrs.Get("rpc.grpc.attempt.status_code").AsInt64())
+
+	require.NoError(t, conn.Close())
+}
@@ -4,10 +4,41 @@ import (
 	"github.com/hypertrace/goagent/instrumentation/opentelemetry"
 	sdkgrpc "github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/stats"
 )
 
 // WrapUnaryClientInterceptor returns a new unary client interceptor that will
 // complement existing OpenTelemetry instrumentation
 func WrapUnaryClientInterceptor(delegate grpc.UnaryClientInterceptor) grpc.UnaryClientInterceptor {
-	return sdkgrpc.WrapUnaryClientInterceptor(delegate, opentelemetry.SpanFromContext, map[string]string{})
+	return WrapUnaryClientInterceptorWithOptions(delegate, nil)
+}
+
+// WrapUnaryClientInterceptorWithOptions works like WrapUnaryClientInterceptor but
+// evaluates the filter of the options on the outgoing requests.
+func WrapUnaryClientInterceptorWithOptions(delegate grpc.UnaryClientInterceptor, options *sdkgrpc.Options) grpc.UnaryClientInterceptor {
+	return sdkgrpc.WrapUnaryClientInterceptor(delegate, opentelemetry.SpanFromContext, options, map[string]string{}, opentelemetry.NewRpcOperationMetricsHandler())
+}
+
+// WrapStreamClientInterceptor returns a new stream client interceptor that will
+// complement existing OpenTelemetry instrumentation
+func WrapStreamClientInterceptor(delegate grpc.StreamClientInterceptor, options *sdkgrpc.Options) grpc.StreamClientInterceptor {
+	return sdkgrpc.WrapStreamClientInterceptor(delegate, opentelemetry.SpanFromContext, options, map[string]string{}, opentelemetry.NewRpcOperationMetricsHandler())
+}
+
+// UnaryClientAttemptsInterceptor returns a unary client interceptor numbering the attempts
+// of the RPCs recorded by the client stats handler.
+func UnaryClientAttemptsInterceptor() grpc.UnaryClientInterceptor {
+	return sdkgrpc.UnaryClientAttemptsInterceptor()
+}
+
+// StreamClientAttemptsInterceptor returns a stream client interceptor numbering the attempts
+// of the RPCs recorded by the client stats handler.
+func StreamClientAttemptsInterceptor() grpc.StreamClientInterceptor {
+	return sdkgrpc.StreamClientAttemptsInterceptor()
+}
+
+// WrapClientConnStats wraps the stats handler of a client so it also records the connection
+// events, the connectivity state transitions are recorded once the ClientConn is watched.
+func WrapClientConnStats(delegate stats.Handler) *sdkgrpc.ClientConnStats {
+	return sdkgrpc.WrapClientConnStats(delegate, opentelemetry.StartSpan)
 }
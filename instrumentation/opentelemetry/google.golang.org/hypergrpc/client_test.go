@@ -6,6 +6,7 @@ import (
 
 	"github.com/hypertrace/goagent/instrumentation/opentelemetry/google.golang.org/hypergrpc/internal/helloworld"
 	"github.com/hypertrace/goagent/instrumentation/opentelemetry/internal/tracetesting"
+	sdkgrpc "github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc"
 	"github.com/stretchr/testify/assert"
 	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	otelcodes "go.opentelemetry.io/otel/codes"
@@ -36,8 +37,9 @@ func TestClientHelloWorldSuccess(t *testing.T) {
 		grpc.WithContextDialer(dialer),
 		grpc.WithInsecure(),
 		grpc.WithUnaryInterceptor(
-			WrapUnaryClientInterceptor(
+			WrapUnaryClientInterceptorWithOptions(
 				otelgrpc.UnaryClientInterceptor(),
+				&sdkgrpc.Options{},
 			),
 		),
 	)
@@ -0,0 +1,23 @@
+package hypergrpc // import "github.com/hypertrace/goagent/instrumentation/opentelemetry/google.golang.org/hypergrpc"
+
+import (
+	"github.com/hypertrace/goagent/sdk/exclusion"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc/stats"
+)
+
+// ExclusionFilter returns an otelgrpc filter for stats handlers skipping the span creation
+// for the RPCs matching a rule with the exclusion.SkipSpan action. The user agent isn't
+// available to otelgrpc filters so the rules with a user agent condition don't skip spans.
+func ExclusionFilter(rules exclusion.Rules) otelgrpc.Filter {
+	return func(info *stats.RPCTagInfo) bool {
+		return !rules.SkipsSpan(exclusion.Request{FullMethod: info.FullMethodName})
+	}
+}
+
+// ExclusionInterceptorFilter is the ExclusionFilter counterpart for the otelgrpc interceptors.
+func ExclusionInterceptorFilter(rules exclusion.Rules) otelgrpc.InterceptorFilter { // nolint:staticcheck
+	return func(info *otelgrpc.InterceptorInfo) bool { // nolint:staticcheck
+		return !rules.SkipsSpan(exclusion.Request{FullMethod: info.Method})
+	}
+}
@@ -0,0 +1,59 @@
+package hypergrpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry/google.golang.org/hypergrpc/internal/helloworld"
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry/internal/tracetesting"
+	"github.com/hypertrace/goagent/sdk/exclusion"
+	sdkgrpc "github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestServerHandlerExclusionSkipsSpan(t *testing.T) {
+	_, flusher := tracetesting.InitTracer()
+
+	rules := exclusion.Rules{{FullMethod: "/helloworld.Greeter/*", Action: exclusion.SkipSpan}}
+	s := grpc.NewServer(
+		grpc.StatsHandler(WrapStatsHandler(
+			otelgrpc.NewServerHandler(otelgrpc.WithFilter(ExclusionFilter(rules))),
+			&sdkgrpc.Options{Filter: blockingFilter{}, Exclusions: rules},
+		)),
+		grpc.UnaryInterceptor(FilterUnaryServerInterceptor()),
+	)
+	defer s.Stop()
+
+	helloworld.RegisterGreeterServer(s, &server{
+		reply: &helloworld.HelloReply{Message: "Hi Pupo"},
+	})
+
+	ctx := context.Background()
+	conn, err := grpc.DialContext(
+		ctx,
+		"bufnet",
+		grpc.WithContextDialer(createDialer(s)),
+		grpc.WithInsecure(),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// the span is not exported but the filter still runs
+	_, err = helloworld.NewGreeterClient(conn).SayHello(ctx, &helloworld.HelloRequest{Name: "Pupo"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	s.GracefulStop()
+	assert.Empty(t, flusher())
+}
+
+func TestExclusionInterceptorFilter(t *testing.T) {
+	filter := ExclusionInterceptorFilter(exclusion.DefaultRules(exclusion.SkipSpan))
+
+	assert.False(t, filter(&otelgrpc.InterceptorInfo{Method: "/grpc.health.v1.Health/Check"})) // nolint:staticcheck
+	assert.True(t, filter(&otelgrpc.InterceptorInfo{Method: "/helloworld.Greeter/SayHello"}))  // nolint:staticcheck
+}
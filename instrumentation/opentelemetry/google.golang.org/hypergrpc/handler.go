@@ -0,0 +1,27 @@
+package hypergrpc // import "github.com/hypertrace/goagent/instrumentation/opentelemetry/google.golang.org/hypergrpc"
+
+import (
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry"
+	sdkgrpc "github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/stats"
+)
+
+// WrapStatsHandler returns a new stats handler that will complement existing
+// OpenTelemetry instrumentation. Blocking requests with the filter requires adding
+// FilterUnaryServerInterceptor and FilterStreamServerInterceptor to the server.
+func WrapStatsHandler(delegate stats.Handler, options *sdkgrpc.Options) stats.Handler {
+	return sdkgrpc.WrapStatsHandler(delegate, opentelemetry.SpanFromContext, options)
+}
+
+// FilterUnaryServerInterceptor rejects the unary RPCs blocked by the filter of the
+// stats handler.
+func FilterUnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return sdkgrpc.FilterUnaryServerInterceptor()
+}
+
+// FilterStreamServerInterceptor rejects the streaming RPCs blocked by the filter of
+// the stats handler.
+func FilterStreamServerInterceptor() grpc.StreamServerInterceptor {
+	return sdkgrpc.FilterStreamServerInterceptor()
+}
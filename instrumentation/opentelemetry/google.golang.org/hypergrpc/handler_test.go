@@ -0,0 +1,65 @@
+package hypergrpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry/google.golang.org/hypergrpc/internal/helloworld"
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry/internal/tracetesting"
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/filter/result"
+	sdkgrpc "github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type blockingFilter struct{}
+
+func (blockingFilter) Evaluate(sdk.Span) result.FilterResult {
+	return result.FilterResult{Block: true, ResponseStatusCode: 403}
+}
+
+func TestServerHandlerFilterBlocksRequest(t *testing.T) {
+	_, flusher := tracetesting.InitTracer()
+
+	s := grpc.NewServer(
+		grpc.StatsHandler(WrapStatsHandler(otelgrpc.NewServerHandler(), &sdkgrpc.Options{Filter: blockingFilter{}})),
+		grpc.UnaryInterceptor(FilterUnaryServerInterceptor()),
+	)
+	defer s.Stop()
+
+	helloworld.RegisterGreeterServer(s, &server{
+		reply: &helloworld.HelloReply{Message: "Hi Pupo"},
+	})
+
+	dialer := createDialer(s)
+
+	ctx := context.Background()
+	conn, err := grpc.DialContext(
+		ctx,
+		"bufnet",
+		grpc.WithContextDialer(dialer),
+		grpc.WithInsecure(),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = helloworld.NewGreeterClient(conn).SayHello(ctx, &helloworld.HelloRequest{Name: "Pupo"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// the stats handler ends the span after the status is sent to the client
+	s.GracefulStop()
+
+	spans := flusher()
+	require.Equal(t, 1, len(spans))
+
+	attrs := tracetesting.LookupAttributes(spans[0].Attributes())
+	assert.Equal(t, int64(codes.PermissionDenied), attrs.Get("rpc.grpc.status_code").AsInt64())
+	ok, err := jsonEqual(`{"name":"Pupo"}`, attrs.Get("rpc.request.body").AsString())
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
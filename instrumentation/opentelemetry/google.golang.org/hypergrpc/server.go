@@ -9,5 +9,11 @@ import (
 // WrapUnaryServerInterceptor returns a new unary server interceptor that will
 // complement existing OpenTelemetry instrumentation
 func WrapUnaryServerInterceptor(delegate grpc.UnaryServerInterceptor, options *sdkgrpc.Options) grpc.UnaryServerInterceptor {
-	return sdkgrpc.WrapUnaryServerInterceptor(delegate, opentelemetry.SpanFromContext, options, map[string]string{})
+	return sdkgrpc.WrapUnaryServerInterceptor(delegate, opentelemetry.SpanFromContext, options, map[string]string{}, opentelemetry.NewRpcOperationMetricsHandler())
+}
+
+// WrapStreamServerInterceptor returns a new stream server interceptor that will
+// complement existing OpenTelemetry instrumentation
+func WrapStreamServerInterceptor(delegate grpc.StreamServerInterceptor, options *sdkgrpc.Options) grpc.StreamServerInterceptor {
+	return sdkgrpc.WrapStreamServerInterceptor(delegate, opentelemetry.SpanFromContext, options, map[string]string{}, opentelemetry.NewRpcOperationMetricsHandler())
 }
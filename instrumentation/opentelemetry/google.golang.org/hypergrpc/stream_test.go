@@ -0,0 +1,120 @@
+package hypergrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry/google.golang.org/hypergrpc/internal/helloworld"
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry/internal/tracetesting"
+	sdkgrpc "github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// chatServiceDesc describes a bidirectional streaming service registered by hand as
+// the helloworld proto only defines unary RPCs.
+var chatServiceDesc = grpc.ServiceDesc{
+	ServiceName: "helloworld.Chat",
+	HandlerType: (*interface{})(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "Chat",
+			Handler: func(_ interface{}, stream grpc.ServerStream) error {
+				for {
+					req := &helloworld.HelloRequest{}
+					err := stream.RecvMsg(req)
+					if errors.Is(err, io.EOF) {
+						return nil
+					}
+					if err != nil {
+						return err
+					}
+					if err := stream.SendMsg(&helloworld.HelloReply{Message: "Hello " + req.GetName()}); err != nil {
+						return err
+					}
+				}
+			},
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+}
+
+func TestStreamHelloWorldSuccess(t *testing.T) {
+	_, flusher := tracetesting.InitTracer()
+
+	s := grpc.NewServer(
+		grpc.StreamInterceptor(
+			WrapStreamServerInterceptor(otelgrpc.StreamServerInterceptor(), &sdkgrpc.Options{}),
+		),
+	)
+	defer s.Stop()
+	s.RegisterService(&chatServiceDesc, struct{}{})
+
+	dialer := createDialer(s)
+
+	ctx := context.Background()
+	conn, err := grpc.DialContext(
+		ctx,
+		"bufnet",
+		grpc.WithContextDialer(dialer),
+		grpc.WithInsecure(),
+		grpc.WithStreamInterceptor(
+			WrapStreamClientInterceptor(otelgrpc.StreamClientInterceptor(), &sdkgrpc.Options{}),
+		),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx = metadata.NewOutgoingContext(ctx, metadata.Pairs("test_key_1", "test_value_1"))
+	stream, err := conn.NewStream(ctx, &chatServiceDesc.Streams[0], "/helloworld.Chat/Chat")
+	require.NoError(t, err)
+
+	for _, name := range []string{"Pupo", "Cuco"} {
+		require.NoError(t, stream.SendMsg(&helloworld.HelloRequest{Name: name}))
+	}
+	require.NoError(t, stream.CloseSend())
+	for {
+		err := stream.RecvMsg(&helloworld.HelloReply{})
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+	}
+
+	spans := flusher()
+	require.Equal(t, 2, len(spans))
+
+	for _, span := range spans {
+		assert.Equal(t, "helloworld.Chat/Chat", span.Name())
+
+		attrs := tracetesting.LookupAttributes(span.Attributes())
+		assert.Equal(t, "grpc", attrs.Get("rpc.system").AsString())
+		assert.Equal(t, "helloworld.Chat", attrs.Get("rpc.service").AsString())
+		assert.Equal(t, "Chat", attrs.Get("rpc.method").AsString())
+		assert.Equal(t, "test_value_1", attrs.Get("rpc.request.metadata.test_key_1").AsString())
+		assert.Equal(t, int64(2), attrs.Get("rpc.request.message_count").AsInt64())
+		assert.Equal(t, int64(2), attrs.Get("rpc.response.message_count").AsInt64())
+
+		ok, err := jsonEqual(`{"name":"Pupo"}`, attrs.Get("rpc.request.body").AsString())
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		events := map[string]int{}
+		for _, e := range span.Events() {
+			events[e.Name]++
+		}
+		assert.Equal(t, 2, events["rpc.request.message"])
+		assert.Equal(t, 2, events["rpc.response.message"])
+		assert.Equal(t, 1, events["rpc.request.half_close"])
+	}
+
+	assert.Equal(t, trace.SpanKindServer, spans[0].SpanKind())
+	assert.Equal(t, trace.SpanKindClient, spans[1].SpanKind())
+}
@@ -1,12 +1,146 @@
 package identifier
 
 import (
+	"fmt"
+	"log"
+	"os"
+	"sync/atomic"
+
 	"github.com/google/uuid"
+	"github.com/hypertrace/goagent/internal/config"
+	"github.com/hypertrace/goagent/sdk/container"
 	"go.opentelemetry.io/otel/attribute"
 )
 
-var ServiceInstanceIDAttr = attribute.StringValue(uuid.New().String())
-
 const ServiceInstanceIDKey = "service.instance.id"
 
-var ServiceInstanceKeyValue = attribute.KeyValue{Key: ServiceInstanceIDKey, Value: ServiceInstanceIDAttr}
+// Environment variables selecting the service instance ID.
+const (
+	// ServiceInstanceIDEnv sets the service instance ID explicitly.
+	ServiceInstanceIDEnv = "HT_SERVICE_INSTANCE_ID"
+	// ServiceInstanceIDStrategyEnv selects the strategy computing the service instance ID
+	// when it isn't set explicitly: "random" (default), "pod" or "host".
+	ServiceInstanceIDStrategyEnv = "HT_SERVICE_INSTANCE_ID_STRATEGY"
+	// ServiceInstanceIDSpanAttributeEnv keeps the service instance ID on every span on top
+	// of the resource when true.
+	ServiceInstanceIDSpanAttributeEnv = "HT_SERVICE_INSTANCE_ID_SPAN_ATTRIBUTE"
+)
+
+// Strategy computes the service instance ID, returning an empty string when it can't.
+type Strategy func() string
+
+// Static returns the given ID, e.g. the one set in the config.
+func Static(id string) Strategy {
+	return func() string {
+		return id
+	}
+}
+
+// Random returns a new UUID, hence the ID changes on every restart.
+func Random() Strategy {
+	return func() string {
+		return uuid.New().String()
+	}
+}
+
+// PodAndContainer returns <pod name>/<container ID>, which is stable across the restarts of
+// a container in the same pod. The pod name is read from the K8S_POD_NAME or POD_NAME
+// environment variables, the hostname being the pod name otherwise.
+func PodAndContainer() Strategy {
+	return func() string {
+		podName := os.Getenv("K8S_POD_NAME")
+		if podName == "" {
+			podName = os.Getenv("POD_NAME")
+		}
+		if podName == "" {
+			podName, _ = os.Hostname()
+		}
+
+		containerID, err := container.GetID()
+		if podName == "" || err != nil {
+			return ""
+		}
+		return podName + "/" + containerID
+	}
+}
+
+// HostAndPID returns <hostname>/<pid>.
+func HostAndPID() Strategy {
+	return func() string {
+		hostname, err := os.Hostname()
+		if err != nil || hostname == "" {
+			return ""
+		}
+		return fmt.Sprintf("%s/%d", hostname, os.Getpid())
+	}
+}
+
+var (
+	serviceInstanceKeyValue atomic.Pointer[attribute.KeyValue]
+	spanAttributeEnabled    atomic.Bool
+)
+
+func init() {
+	spanAttributeEnabled.Store(config.BoolEnv(ServiceInstanceIDSpanAttributeEnv, false))
+}
+
+func strategyFromEnv() Strategy {
+	if id := os.Getenv(ServiceInstanceIDEnv); id != "" {
+		return Static(id)
+	}
+
+	switch strategy := os.Getenv(ServiceInstanceIDStrategyEnv); strategy {
+	case "pod":
+		return PodAndContainer()
+	case "host":
+		return HostAndPID()
+	case "", "random":
+		return Random()
+	default:
+		log.Printf("unknown service instance ID strategy %q in %s\n", strategy, ServiceInstanceIDStrategyEnv)
+		return Random()
+	}
+}
+
+// SetStrategy computes the service instance ID with s, falling back to a random one when s
+// returns none. It should be called before the agent is initialized as the resource keeps
+// the ID set at that time.
+func SetStrategy(s Strategy) {
+	kv := newServiceInstanceKeyValue(s)
+	serviceInstanceKeyValue.Store(&kv)
+}
+
+// ServiceInstanceKeyValue returns the service.instance.id attribute. Unless SetStrategy was
+// called, the ID is computed on first use, i.e. when the agent is initialized, with the
+// strategy selected through the environment.
+func ServiceInstanceKeyValue() attribute.KeyValue {
+	if kv := serviceInstanceKeyValue.Load(); kv != nil {
+		return *kv
+	}
+
+	kv := newServiceInstanceKeyValue(strategyFromEnv())
+	if !serviceInstanceKeyValue.CompareAndSwap(nil, &kv) {
+		// set concurrently, the first ID stored is the one of the instance
+		return *serviceInstanceKeyValue.Load()
+	}
+	return kv
+}
+
+func newServiceInstanceKeyValue(s Strategy) attribute.KeyValue {
+	id := s()
+	if id == "" {
+		id = Random()()
+	}
+	return attribute.String(ServiceInstanceIDKey, id)
+}
+
+// SpanAttributeEnabled tells whether the service instance ID is added to every span for
+// the backends expecting it there rather than on the resource.
+func SpanAttributeEnabled() bool {
+	return spanAttributeEnabled.Load()
+}
+
+// SetSpanAttributeEnabled turns on or off the service instance ID span attribute.
+func SetSpanAttributeEnabled(enabled bool) {
+	spanAttributeEnabled.Store(enabled)
+}
@@ -0,0 +1,59 @@
+package identifier
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStrategyFromEnv(t *testing.T) {
+	t.Setenv(ServiceInstanceIDEnv, "checkout-1")
+	t.Setenv(ServiceInstanceIDStrategyEnv, "host")
+	assert.Equal(t, "checkout-1", strategyFromEnv()())
+
+	t.Setenv(ServiceInstanceIDEnv, "")
+	hostname, _ := os.Hostname()
+	assert.Equal(t, fmt.Sprintf("%s/%d", hostname, os.Getpid()), strategyFromEnv()())
+
+	t.Setenv(ServiceInstanceIDStrategyEnv, "random")
+	assert.NotEqual(t, strategyFromEnv()(), strategyFromEnv()())
+}
+
+func TestSetStrategy(t *testing.T) {
+	original := ServiceInstanceKeyValue()
+	defer serviceInstanceKeyValue.Store(&original)
+
+	SetStrategy(Static("checkout-1"))
+	kv := ServiceInstanceKeyValue()
+	assert.Equal(t, ServiceInstanceIDKey, string(kv.Key))
+	assert.Equal(t, "checkout-1", kv.Value.AsString())
+
+	// falls back to a random ID
+	SetStrategy(Static(""))
+	assert.Len(t, ServiceInstanceKeyValue().Value.AsString(), 36)
+}
+
+func TestServiceInstanceKeyValueIsComputedOnFirstUse(t *testing.T) {
+	original := ServiceInstanceKeyValue()
+	defer serviceInstanceKeyValue.Store(&original)
+
+	serviceInstanceKeyValue.Store(nil)
+	t.Setenv(ServiceInstanceIDEnv, "checkout-2")
+
+	assert.Equal(t, "checkout-2", ServiceInstanceKeyValue().Value.AsString())
+	// the ID is kept once computed
+	t.Setenv(ServiceInstanceIDEnv, "checkout-3")
+	assert.Equal(t, "checkout-2", ServiceInstanceKeyValue().Value.AsString())
+}
+
+func TestPodAndContainer(t *testing.T) {
+	t.Setenv("K8S_POD_NAME", "checkout-5d8f7")
+	t.Setenv("POD_NAME", "")
+
+	// the container ID isn't available outside of a container
+	if id := PodAndContainer()(); id != "" {
+		assert.Regexp(t, "^checkout-5d8f7/[0-9a-f-]+$", id)
+	}
+}
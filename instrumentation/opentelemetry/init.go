@@ -133,22 +133,15 @@ func makeMetricsExporterFactory(cfg *config.AgentConfig) func(opts ...ServiceOpt
 				otlpmetricgrpc.WithHeaders(serviceOpts.headers),
 			}
 
-			if !cfg.GetReporting().GetSecure().GetValue() {
+			transport := makeGRPCTransport(cfg.GetReporting())
+			if transport.insecure {
 				metricOpts = append(metricOpts, otlpmetricgrpc.WithInsecure())
 			}
-
-			certFile := cfg.GetReporting().GetCertFile().GetValue()
-			if len(certFile) > 0 {
-				if tlsCredentials, err := credentials.NewClientTLSFromFile(certFile, ""); err == nil {
-					metricOpts = append(metricOpts, otlpmetricgrpc.WithTLSCredentials(tlsCredentials))
-				} else {
-					log.Printf("error while creating tls credentials from cert path %s: %v", certFile, err)
-				}
+			if transport.credentials != nil {
+				metricOpts = append(metricOpts, otlpmetricgrpc.WithTLSCredentials(transport.credentials))
 			}
-
-			if cfg.Reporting.GetEnableGrpcLoadbalancing().GetValue() {
-				resolver.SetDefaultScheme("dns")
-				metricOpts = append(metricOpts, otlpmetricgrpc.WithServiceConfig(`{"loadBalancingConfig": [ { "round_robin": {} } ]}`))
+			if transport.serviceConfig != "" {
+				metricOpts = append(metricOpts, otlpmetricgrpc.WithServiceConfig(transport.serviceConfig))
 			}
 			return otlpmetricgrpc.New(context.Background(), metricOpts...)
 		}
@@ -188,13 +181,12 @@ func makeExporterFactory(cfg *config.AgentConfig) func(serviceOpts ...ServiceOpt
 			otlphttp.WithEndpoint(cfg.GetReporting().GetEndpoint().GetValue()),
 		}
 
-		if !cfg.GetReporting().GetSecure().GetValue() {
+		transport := makeHTTPTransport(cfg.GetReporting())
+		if transport.insecure {
 			standardOpts = append(standardOpts, otlphttp.WithInsecure())
 		}
-
-		certFile := cfg.GetReporting().GetCertFile().GetValue()
-		if len(certFile) > 0 {
-			standardOpts = append(standardOpts, otlphttp.WithTLSClientConfig(createTLSConfig(cfg.GetReporting())))
+		if transport.tlsConfig != nil {
+			standardOpts = append(standardOpts, otlphttp.WithTLSClientConfig(transport.tlsConfig))
 		}
 
 		return func(opts ...ServiceOption) (sdktrace.SpanExporter, error) {
@@ -216,22 +208,15 @@ func makeExporterFactory(cfg *config.AgentConfig) func(serviceOpts ...ServiceOpt
 			otlpgrpc.WithEndpoint(removeProtocolPrefixForOTLP(cfg.GetReporting().GetEndpoint().GetValue())),
 		}
 
-		if !cfg.GetReporting().GetSecure().GetValue() {
+		transport := makeGRPCTransport(cfg.GetReporting())
+		if transport.insecure {
 			standardOpts = append(standardOpts, otlpgrpc.WithInsecure())
 		}
-
-		certFile := cfg.GetReporting().GetCertFile().GetValue()
-		if len(certFile) > 0 {
-			if tlsCredentials, err := credentials.NewClientTLSFromFile(certFile, ""); err == nil {
-				standardOpts = append(standardOpts, otlpgrpc.WithTLSCredentials(tlsCredentials))
-			} else {
-				log.Printf("error while creating tls credentials from cert path %s: %v", certFile, err)
-			}
+		if transport.credentials != nil {
+			standardOpts = append(standardOpts, otlpgrpc.WithTLSCredentials(transport.credentials))
 		}
-
-		if cfg.Reporting.GetEnableGrpcLoadbalancing().GetValue() {
-			resolver.SetDefaultScheme("dns")
-			standardOpts = append(standardOpts, otlpgrpc.WithServiceConfig(`{"loadBalancingConfig": [ { "round_robin": {} } ]}`))
+		if transport.serviceConfig != "" {
+			standardOpts = append(standardOpts, otlpgrpc.WithServiceConfig(transport.serviceConfig))
 		}
 
 		return func(opts ...ServiceOption) (sdktrace.SpanExporter, error) {
@@ -254,6 +239,58 @@ func makeExporterFactory(cfg *config.AgentConfig) func(serviceOpts ...ServiceOpt
 	}
 }
 
+// grpcTransport holds the transport settings shared by the OTLP gRPC exporters.
+type grpcTransport struct {
+	insecure      bool
+	credentials   credentials.TransportCredentials
+	serviceConfig string
+}
+
+// makeGRPCTransport builds the transport settings of the OTLP gRPC exporters out of
+// the reporting config, making the gRPC resolver default to dns when load balancing
+// is enabled.
+func makeGRPCTransport(reportingCfg *config.Reporting) grpcTransport {
+	transport := grpcTransport{
+		insecure: !reportingCfg.GetSecure().GetValue(),
+	}
+
+	certFile := reportingCfg.GetCertFile().GetValue()
+	if len(certFile) > 0 {
+		if tlsCredentials, err := credentials.NewClientTLSFromFile(certFile, ""); err == nil {
+			transport.credentials = tlsCredentials
+		} else {
+			log.Printf("error while creating tls credentials from cert path %s: %v", certFile, err)
+		}
+	}
+
+	if reportingCfg.GetEnableGrpcLoadbalancing().GetValue() {
+		resolver.SetDefaultScheme("dns")
+		transport.serviceConfig = `{"loadBalancingConfig": [ { "round_robin": {} } ]}`
+	}
+
+	return transport
+}
+
+// httpTransport holds the transport settings shared by the OTLP HTTP exporters.
+type httpTransport struct {
+	insecure  bool
+	tlsConfig *tls.Config
+}
+
+// makeHTTPTransport builds the transport settings of the OTLP HTTP exporters out of
+// the reporting config, the TLS config being set only when a cert file is configured.
+func makeHTTPTransport(reportingCfg *config.Reporting) httpTransport {
+	transport := httpTransport{
+		insecure: !reportingCfg.GetSecure().GetValue(),
+	}
+
+	if len(reportingCfg.GetCertFile().GetValue()) > 0 {
+		transport.tlsConfig = createTLSConfig(reportingCfg)
+	}
+
+	return transport
+}
+
 func makeConfigFactory(cfg *config.AgentConfig) func() *config.AgentConfig {
 	return func() *config.AgentConfig {
 		return cfg
@@ -336,6 +373,8 @@ func InitWithSpanProcessorWrapperAndZap(cfg *config.AgentConfig, wrapper SpanPro
 		}
 	}
 
+	setServiceInstanceIDFromConfig(cfg)
+
 	if logger != nil {
 		_ = zap.ReplaceGlobals(logger.With(zap.String("service", "hypertrace")))
 
@@ -375,6 +414,9 @@ func InitWithSpanProcessorWrapperAndZap(cfg *config.AgentConfig, wrapper SpanPro
 		log.Fatal(err)
 	}
 
+	// Initialize logs
+	logsShutdownFn := initializeLogs(cfg, resources, opts...)
+
 	sampler := sdktrace.AlwaysSample()
 	tp := sdktrace.NewTracerProvider(
 		sdktrace.WithSampler(sampler),
@@ -417,17 +459,26 @@ func InitWithSpanProcessorWrapperAndZap(cfg *config.AgentConfig, wrapper SpanPro
 		}
 
 		metricsShutdownFn()
+		logsShutdownFn()
 		initialized = false
 		enabled = false
 		sdkconfig.ResetConfig()
 	}
 }
 
+// setServiceInstanceIDFromConfig makes the service.instance.id set in the resource attributes
+// the ID of the instance, so the spans carry the same one when the span attribute is enabled.
+func setServiceInstanceIDFromConfig(cfg *config.AgentConfig) {
+	if id := cfg.GetResourceAttributes()[identifier.ServiceInstanceIDKey]; id != "" {
+		identifier.SetStrategy(identifier.Static(id))
+	}
+}
+
 func createResources(resources map[string]string,
 	versionInfo []attribute.KeyValue) []attribute.KeyValue {
-	retValues := []attribute.KeyValue{
-		semconv.TelemetrySDKLanguageGo,
-	}
+	// detected attributes come first so the configured ones take precedence
+	retValues := detectResources()
+	retValues = append(retValues, semconv.TelemetrySDKLanguageGo, identifier.ServiceInstanceKeyValue())
 
 	retValues = append(retValues, versionInfo...)
 
@@ -506,7 +557,6 @@ func initializeMetrics(cfg *config.AgentConfig, versionInfoAttrs []attribute.Key
 	periodicReader := metric.NewPeriodicReader(metricsExporter)
 
 	resourceKvps := createResources(getResourceAttrsWithServiceName(cfg.ResourceAttributes, cfg.GetServiceName().GetValue()), versionInfoAttrs)
-	resourceKvps = append(resourceKvps, identifier.ServiceInstanceKeyValue)
 	metricResources, err := resource.New(context.Background(), resource.WithAttributes(resourceKvps...))
 	if err != nil {
 		log.Fatal(err)
@@ -515,6 +565,9 @@ func initializeMetrics(cfg *config.AgentConfig, versionInfoAttrs []attribute.Key
 	otel.SetMeterProvider(meterProvider)
 
 	metrics.InitializeSystemMetrics()
+	if metrics.RuntimeMetricsEnabled() {
+		metrics.InitializeRuntimeMetrics()
+	}
 	return func() {
 		err = meterProvider.Shutdown(context.Background())
 		if err != nil {
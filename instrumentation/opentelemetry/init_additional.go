@@ -23,6 +23,7 @@ func InitAsAdditional(cfg *config.AgentConfig) (trace.SpanProcessor, func()) {
 		return nil, func() {}
 	}
 	sdkconfig.InitConfig(cfg)
+	setServiceInstanceIDFromConfig(cfg)
 
 	exporterFactory = makeExporterFactory(cfg)
 	configFactory = makeConfigFactory(cfg)
@@ -12,6 +12,7 @@ import (
 
 	v1 "github.com/hypertrace/agent-config/gen/go/v1"
 	"github.com/hypertrace/goagent/config"
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry/identifier"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/otel"
@@ -90,7 +91,9 @@ func TestOtlpService(t *testing.T) {
 	_, s, _ := startSpan(context.Background(), "test_span", nil)
 	assert.False(t, s.IsNoop())
 	assert.NotEqual(t, noop.NewTracerProvider(), tp)
-	assert.Len(t, s.GetAttributes().GetValue("service.instance.id"), 36)
+	resourceID, ok := s.(*Span).Span.(sdktrace.ReadOnlySpan).Resource().Set().Value(identifier.ServiceInstanceIDKey)
+	assert.True(t, ok)
+	assert.Len(t, resourceID.AsString(), 36)
 	if err != nil {
 		log.Fatalf("Error while initializing service: %v", err)
 	}
@@ -369,6 +372,10 @@ func TestInitWithSpanProcessorWrapper(t *testing.T) {
 	cfg.DataCapture.HttpHeaders.Request = config.Bool(true)
 	cfg.Reporting.Endpoint = config.String(srv.URL)
 
+	// the compatibility span attribute keeps the ID on every span
+	identifier.SetSpanAttributeEnabled(true)
+	defer identifier.SetSpanAttributeEnabled(false)
+
 	wrapper := &mockSpanProcessorWrapper{}
 	shutdown := InitWithSpanProcessorWrapper(cfg, wrapper, versionInfoAttributes)
 	defer shutdown()
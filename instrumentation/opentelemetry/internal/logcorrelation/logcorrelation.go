@@ -0,0 +1,55 @@
+package logcorrelation
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Keys of the trace context added to the log records.
+const (
+	TraceIDKey    = "trace_id"
+	SpanIDKey     = "span_id"
+	TraceFlagsKey = "trace_flags"
+)
+
+// LogEventName is the name of the span events mirroring the error logs.
+const LogEventName = "log"
+
+// SpanContext returns the context of the span in ctx, false when there is none.
+func SpanContext(ctx context.Context) (trace.SpanContext, bool) {
+	if ctx == nil {
+		return trace.SpanContext{}, false
+	}
+	sc := trace.SpanFromContext(ctx).SpanContext()
+	return sc, sc.IsValid()
+}
+
+// RecordLog adds a log event to the span in ctx, if recording, with the severity, the message
+// and the fields of the log record.
+func RecordLog(ctx context.Context, ts time.Time, severity, message string, fields map[string]interface{}) {
+	if ctx == nil {
+		return
+	}
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+
+	attrs := []attribute.KeyValue{
+		attribute.String("log.severity", severity),
+		attribute.String("log.message", message),
+	}
+	for k, v := range fields {
+		switch v := v.(type) {
+		case error:
+			attrs = append(attrs, attribute.String(k, v.Error()))
+		default:
+			attrs = append(attrs, attribute.String(k, fmt.Sprint(v)))
+		}
+	}
+	span.AddEvent(LogEventName, trace.WithTimestamp(ts), trace.WithAttributes(attrs...))
+}
@@ -0,0 +1,283 @@
+//go:build linux
+
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cgroup v1 reports an unlimited memory as the largest page aligned int64.
+const cgroupV1UnlimitedMemory = 1 << 62
+
+// cgroupReader reads the stats of the cgroup the process runs in. With cgroup v2, dir
+// is the directory of the process cgroup, with cgroup v1 memoryDir and cpuDir are the
+// directories of the process cgroup in the memory and cpu hierarchies.
+type cgroupReader struct {
+	v2        bool
+	dir       string
+	memoryDir string
+	cpuDir    string
+}
+
+// newCgroupV2Reader returns a reader for the cgroup v2 directory, nil when the memory
+// usage can't be read from it, e.g. for the root cgroup.
+func newCgroupV2Reader(dir string) *cgroupReader {
+	if _, err := os.Stat(filepath.Join(dir, "memory.current")); err != nil {
+		return nil
+	}
+	return &cgroupReader{v2: true, dir: dir}
+}
+
+// newCgroupV1Reader returns a reader for the cgroup v1 memory and cpu directories, nil
+// when the memory usage can't be read from them.
+func newCgroupV1Reader(memoryDir, cpuDir string) *cgroupReader {
+	if _, err := os.Stat(filepath.Join(memoryDir, "memory.usage_in_bytes")); err != nil {
+		return nil
+	}
+	return &cgroupReader{memoryDir: memoryDir, cpuDir: cpuDir}
+}
+
+func newContainerMetrics() (containerMetrics, error) {
+	mountInfo, err := os.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	cgroups, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return nil, err
+	}
+
+	r := resolveCgroupReader(mountInfo, cgroups)
+	if r == nil {
+		return nil, nil
+	}
+	return r, nil
+}
+
+// cgroupMount is a cgroup hierarchy mounted at mountPoint, root being the path of the
+// cgroup mounted there within the hierarchy.
+type cgroupMount struct {
+	root       string
+	mountPoint string
+}
+
+// resolveCgroupReader returns a reader for the cgroup the process runs in, out of the
+// content of /proc/self/mountinfo and /proc/self/cgroup. It returns nil when the
+// cgroup isn't mounted or its memory usage can't be read.
+func resolveCgroupReader(mountInfo, cgroups []byte) *cgroupReader {
+	var v2Mount *cgroupMount
+	v1Mounts := map[string]*cgroupMount{}
+
+	// ref: https://man7.org/linux/man-pages/man5/proc_pid_mountinfo.5.html
+	scanner := bufio.NewScanner(bytes.NewReader(mountInfo))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		separator := -1
+		for i, field := range fields {
+			if field == "-" {
+				separator = i
+				break
+			}
+		}
+		if separator < 5 || len(fields) < separator+4 {
+			continue
+		}
+
+		mount := &cgroupMount{root: fields[3], mountPoint: fields[4]}
+		switch fields[separator+1] {
+		case "cgroup2":
+			v2Mount = mount
+		case "cgroup":
+			for _, option := range strings.Split(fields[separator+3], ",") {
+				if option == "memory" || option == "cpu" {
+					v1Mounts[option] = mount
+				}
+			}
+		}
+	}
+
+	v1Paths := map[string]string{}
+	v2Path := ""
+	// lines are formatted as "hierarchy-ID:controller-list:cgroup-path"
+	scanner = bufio.NewScanner(bytes.NewReader(cgroups))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[0] == "0" && parts[1] == "" {
+			v2Path = parts[2]
+			continue
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			v1Paths[controller] = parts[2]
+		}
+	}
+
+	if v2Mount != nil && v2Path != "" {
+		if dir, ok := cgroupDir(v2Mount, v2Path); ok {
+			if r := newCgroupV2Reader(dir); r != nil {
+				return r
+			}
+		}
+	}
+
+	memoryMount, ok := v1Mounts["memory"]
+	if !ok {
+		return nil
+	}
+	memoryDir, ok := cgroupDir(memoryMount, v1Paths["memory"])
+	if !ok {
+		return nil
+	}
+
+	cpuDir := ""
+	if cpuMount, ok := v1Mounts["cpu"]; ok {
+		cpuDir, _ = cgroupDir(cpuMount, v1Paths["cpu"])
+	}
+	return newCgroupV1Reader(memoryDir, cpuDir)
+}
+
+// cgroupDir returns the directory of the cgroup at path in the mounted hierarchy,
+// false when the cgroup isn't visible through the mount.
+func cgroupDir(mount *cgroupMount, path string) (string, bool) {
+	if path == "" {
+		return "", false
+	}
+	if mount.root == "/" {
+		return filepath.Join(mount.mountPoint, path), true
+	}
+	// the mounted cgroup is an ancestor of the process cgroup, e.g. in containers
+	// without a cgroup namespace
+	if path == mount.root || strings.HasPrefix(path, mount.root+"/") {
+		return filepath.Join(mount.mountPoint, strings.TrimPrefix(path, mount.root)), true
+	}
+	return "", false
+}
+
+func (r *cgroupReader) readStats() (*cgroupStats, error) {
+	if r.v2 {
+		return r.readV2Stats()
+	}
+	return r.readV1Stats()
+}
+
+// ref: https://docs.kernel.org/admin-guide/cgroup-v2.html
+func (r *cgroupReader) readV2Stats() (*cgroupStats, error) {
+	stats := &cgroupStats{}
+
+	usage, err := readUintFile(filepath.Join(r.dir, "memory.current"))
+	if err != nil {
+		return nil, err
+	}
+	stats.memoryUsage = float64(usage)
+
+	if limit, err := readFile(filepath.Join(r.dir, "memory.max")); err == nil && limit != "max" {
+		stats.memoryLimit = parseFloat(limit)
+	}
+
+	if cpuMax, err := readFile(filepath.Join(r.dir, "cpu.max")); err == nil {
+		// "$MAX $PERIOD", $MAX being "max" when there is no quota
+		if fields := strings.Fields(cpuMax); len(fields) == 2 && fields[0] != "max" {
+			stats.cpuLimit = cpuCores(parseFloat(fields[0]), parseFloat(fields[1]))
+		}
+	}
+
+	if cpuStat, err := readKeyValueFile(filepath.Join(r.dir, "cpu.stat")); err == nil {
+		stats.cpuPeriods = cpuStat["nr_periods"]
+		stats.cpuThrottledPeriods = cpuStat["nr_throttled"]
+		stats.cpuThrottledSeconds = float64(cpuStat["throttled_usec"]) / 1e6
+	}
+
+	return stats, nil
+}
+
+// ref: https://docs.kernel.org/admin-guide/cgroup-v1/index.html
+func (r *cgroupReader) readV1Stats() (*cgroupStats, error) {
+	stats := &cgroupStats{}
+
+	usage, err := readUintFile(filepath.Join(r.memoryDir, "memory.usage_in_bytes"))
+	if err != nil {
+		return nil, err
+	}
+	stats.memoryUsage = float64(usage)
+
+	if limit, err := readUintFile(filepath.Join(r.memoryDir, "memory.limit_in_bytes")); err == nil && limit < cgroupV1UnlimitedMemory {
+		stats.memoryLimit = float64(limit)
+	}
+
+	if r.cpuDir == "" {
+		// the cpu controller is not mounted
+		return stats, nil
+	}
+
+	// the quota is -1 when there is none
+	quota, err := readFile(filepath.Join(r.cpuDir, "cpu.cfs_quota_us"))
+	if err == nil && !strings.HasPrefix(quota, "-") {
+		if period, err := readFile(filepath.Join(r.cpuDir, "cpu.cfs_period_us")); err == nil {
+			stats.cpuLimit = cpuCores(parseFloat(quota), parseFloat(period))
+		}
+	}
+
+	if cpuStat, err := readKeyValueFile(filepath.Join(r.cpuDir, "cpu.stat")); err == nil {
+		stats.cpuPeriods = cpuStat["nr_periods"]
+		stats.cpuThrottledPeriods = cpuStat["nr_throttled"]
+		stats.cpuThrottledSeconds = float64(cpuStat["throttled_time"]) / 1e9
+	}
+
+	return stats, nil
+}
+
+func cpuCores(quota, period float64) float64 {
+	if period <= 0 {
+		return 0
+	}
+	return quota / period
+}
+
+func readFile(path string) (string, error) {
+	content, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+func readUintFile(path string) (uint64, error) {
+	content, err := readFile(path)
+	if err != nil {
+		return 0, err
+	}
+	value, err := strconv.ParseUint(content, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s file could not be parsed: %v", path, err)
+	}
+	return value, nil
+}
+
+// readKeyValueFile reads the flat keyed files like cpu.stat, made of "key value" lines.
+func readKeyValueFile(path string) (map[string]int64, error) {
+	content, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]int64{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if value, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+			values[fields[0]] = value
+		}
+	}
+	return values, scanner.Err()
+}
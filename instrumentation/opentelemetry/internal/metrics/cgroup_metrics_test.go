@@ -0,0 +1,141 @@
+//go:build linux
+
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestReadCgroupV2Stats(t *testing.T) {
+	r := newCgroupV2Reader("testdata/cgroupv2")
+	require.NotNil(t, r)
+	assert.True(t, r.v2)
+
+	stats, err := r.readStats()
+	require.NoError(t, err)
+
+	assert.Equal(t, 268435456.0, stats.memoryUsage)
+	assert.Equal(t, 536870912.0, stats.memoryLimit)
+	assert.Equal(t, 0.5, stats.memoryUtilization())
+	assert.Equal(t, 1.5, stats.cpuLimit)
+	assert.Equal(t, int64(1200), stats.cpuPeriods)
+	assert.Equal(t, int64(37), stats.cpuThrottledPeriods)
+	assert.Equal(t, 2.5, stats.cpuThrottledSeconds)
+}
+
+func TestReadCgroupV2StatsWithoutLimits(t *testing.T) {
+	stats, err := newCgroupV2Reader("testdata/cgroupv2-unlimited").readStats()
+	require.NoError(t, err)
+
+	assert.Equal(t, 104857600.0, stats.memoryUsage)
+	assert.Zero(t, stats.memoryLimit)
+	assert.Zero(t, stats.memoryUtilization())
+	assert.Zero(t, stats.cpuLimit)
+	assert.Zero(t, stats.cpuThrottledPeriods)
+}
+
+func TestReadCgroupV1Stats(t *testing.T) {
+	r := newCgroupV1Reader("testdata/cgroupv1/memory", "testdata/cgroupv1/cpu")
+	require.NotNil(t, r)
+	assert.False(t, r.v2)
+
+	stats, err := r.readStats()
+	require.NoError(t, err)
+
+	assert.Equal(t, 134217728.0, stats.memoryUsage)
+	assert.Equal(t, 268435456.0, stats.memoryLimit)
+	assert.Equal(t, 0.5, stats.cpuLimit)
+	assert.Equal(t, int64(500), stats.cpuPeriods)
+	assert.Equal(t, int64(20), stats.cpuThrottledPeriods)
+	assert.Equal(t, 1.5, stats.cpuThrottledSeconds)
+}
+
+func TestNewCgroupReaderWithoutCgroup(t *testing.T) {
+	assert.Nil(t, newCgroupV2Reader(t.TempDir()))
+	assert.Nil(t, newCgroupV1Reader(t.TempDir(), t.TempDir()))
+}
+
+func TestResolveCgroupV2Reader(t *testing.T) {
+	testdata, err := filepath.Abs("testdata")
+	require.NoError(t, err)
+
+	mountInfo := fmt.Sprintf("30 24 0:26 / %s rw,nosuid - cgroup2 cgroup2 rw\n", testdata)
+
+	r := resolveCgroupReader([]byte(mountInfo), []byte("0::/cgroupv2\n"))
+	require.NotNil(t, r)
+	assert.True(t, r.v2)
+	assert.Equal(t, filepath.Join(testdata, "cgroupv2"), r.dir)
+
+	// the root cgroup has no memory.current
+	assert.Nil(t, resolveCgroupReader([]byte(mountInfo), []byte("0::/\n")))
+
+	// the cgroup mounted in a container without cgroup namespace is the process one
+	mountInfo = fmt.Sprintf("30 24 0:26 /kubepods/pod1 %s rw,nosuid - cgroup2 cgroup2 rw\n", filepath.Join(testdata, "cgroupv2"))
+	r = resolveCgroupReader([]byte(mountInfo), []byte("0::/kubepods/pod1\n"))
+	require.NotNil(t, r)
+	assert.Equal(t, filepath.Join(testdata, "cgroupv2"), r.dir)
+
+	// the process cgroup isn't visible through the mount
+	assert.Nil(t, resolveCgroupReader([]byte(mountInfo), []byte("0::/system.slice\n")))
+}
+
+func TestResolveCgroupV1Reader(t *testing.T) {
+	testdata, err := filepath.Abs("testdata")
+	require.NoError(t, err)
+
+	mountInfo := fmt.Sprintf(`32 24 0:28 / /sys/fs/cgroup rw,relatime - tmpfs tmpfs rw,mode=755
+33 32 0:29 / %s rw,relatime - cgroup cgroup rw,cpu,cpuacct
+36 32 0:32 / %s rw,relatime - cgroup cgroup rw,memory
+`, testdata, testdata)
+	cgroups := `4:memory:/cgroupv1/memory
+1:cpu,cpuacct:/cgroupv1/cpu
+0::/
+`
+
+	r := resolveCgroupReader([]byte(mountInfo), []byte(cgroups))
+	require.NotNil(t, r)
+	assert.False(t, r.v2)
+	assert.Equal(t, filepath.Join(testdata, "cgroupv1", "memory"), r.memoryDir)
+	assert.Equal(t, filepath.Join(testdata, "cgroupv1", "cpu"), r.cpuDir)
+
+	stats, err := r.readStats()
+	require.NoError(t, err)
+	assert.Equal(t, 134217728.0, stats.memoryUsage)
+	assert.Equal(t, 0.5, stats.cpuLimit)
+
+	// the memory usage of the process cgroup can't be read
+	assert.Nil(t, resolveCgroupReader([]byte(mountInfo), []byte("4:memory:/\n")))
+}
+
+func TestSetUpContainerMetricRecorder(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter(meterName)
+	require.NoError(t, setUpContainerMetricRecorder(meter, newCgroupV2Reader("testdata/cgroupv2")))
+
+	rm := metricdata.ResourceMetrics{}
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+
+	collected := map[string]metricdata.Aggregation{}
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		collected[m.Name] = m.Data
+	}
+
+	utilization := collected["hypertrace.agent.container.memory.utilization"].(metricdata.Gauge[float64])
+	assert.Equal(t, 0.5, utilization.DataPoints[0].Value)
+
+	throttled := collected["hypertrace.agent.container.cpu.throttled.periods"].(metricdata.Sum[int64])
+	assert.True(t, throttled.IsMonotonic)
+	assert.Equal(t, int64(37), throttled.DataPoints[0].Value)
+
+	throttledTime := collected["hypertrace.agent.container.cpu.throttled.time"].(metricdata.Sum[float64])
+	assert.Equal(t, 2.5, throttledTime.DataPoints[0].Value)
+}
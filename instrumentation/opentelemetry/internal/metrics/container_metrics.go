@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+// containerMetrics reads the resource usage of the container the process runs in.
+type containerMetrics interface {
+	readStats() (*cgroupStats, error)
+}
+
+// cgroupStats holds the usage of the process cgroup against its limits. The limits
+// are 0 when the cgroup is not limited.
+type cgroupStats struct {
+	memoryUsage         float64
+	memoryLimit         float64
+	cpuLimit            float64
+	cpuPeriods          int64
+	cpuThrottledPeriods int64
+	cpuThrottledSeconds float64
+}
+
+// memoryUtilization returns the ratio of the memory limit in use, 0 when the memory is not limited.
+func (s *cgroupStats) memoryUtilization() float64 {
+	if s.memoryLimit <= 0 {
+		return 0
+	}
+	return s.memoryUsage / s.memoryLimit
+}
+
+func setUpContainerMetricRecorder(meter metric.Meter, cm containerMetrics) error {
+	if meter == nil {
+		return fmt.Errorf("error while setting up container metric recorder: meter is nil")
+	}
+
+	memoryUsage, err := meter.Float64ObservableGauge("hypertrace.agent.container.memory.usage",
+		metric.WithDescription("Memory used by the container"), metric.WithUnit("By"))
+	if err != nil {
+		return fmt.Errorf("error while setting up container memory usage metric gauge: %v", err)
+	}
+	memoryLimit, err := meter.Float64ObservableGauge("hypertrace.agent.container.memory.limit",
+		metric.WithDescription("Memory limit of the container"), metric.WithUnit("By"))
+	if err != nil {
+		return fmt.Errorf("error while setting up container memory limit metric gauge: %v", err)
+	}
+	memoryUtilization, err := meter.Float64ObservableGauge("hypertrace.agent.container.memory.utilization",
+		metric.WithDescription("Ratio of the container memory limit in use"), metric.WithUnit("1"))
+	if err != nil {
+		return fmt.Errorf("error while setting up container memory utilization metric gauge: %v", err)
+	}
+	cpuLimit, err := meter.Float64ObservableGauge("hypertrace.agent.container.cpu.limit",
+		metric.WithDescription("CPU quota of the container in cores"))
+	if err != nil {
+		return fmt.Errorf("error while setting up container cpu limit metric gauge: %v", err)
+	}
+	cpuPeriods, err := meter.Int64ObservableCounter("hypertrace.agent.container.cpu.periods",
+		metric.WithDescription("Number of CPU enforcement periods elapsed"))
+	if err != nil {
+		return fmt.Errorf("error while setting up container cpu periods metric counter: %v", err)
+	}
+	cpuThrottledPeriods, err := meter.Int64ObservableCounter("hypertrace.agent.container.cpu.throttled.periods",
+		metric.WithDescription("Number of CPU enforcement periods the container was throttled in"))
+	if err != nil {
+		return fmt.Errorf("error while setting up container cpu throttled periods metric counter: %v", err)
+	}
+	cpuThrottledTime, err := meter.Float64ObservableCounter("hypertrace.agent.container.cpu.throttled.time",
+		metric.WithDescription("Total time the container was throttled for"), metric.WithUnit("s"))
+	if err != nil {
+		return fmt.Errorf("error while setting up container cpu throttled time metric counter: %v", err)
+	}
+
+	_, err = meter.RegisterCallback(
+		func(ctx context.Context, result metric.Observer) error {
+			stats, err := cm.readStats()
+			if err != nil {
+				return err
+			}
+			result.ObserveFloat64(memoryUsage, stats.memoryUsage)
+			if stats.memoryLimit > 0 {
+				result.ObserveFloat64(memoryLimit, stats.memoryLimit)
+				result.ObserveFloat64(memoryUtilization, stats.memoryUtilization())
+			}
+			if stats.cpuLimit > 0 {
+				result.ObserveFloat64(cpuLimit, stats.cpuLimit)
+			}
+			result.ObserveInt64(cpuPeriods, stats.cpuPeriods)
+			result.ObserveInt64(cpuThrottledPeriods, stats.cpuThrottledPeriods)
+			result.ObserveFloat64(cpuThrottledTime, stats.cpuThrottledSeconds)
+			return nil
+		},
+		memoryUsage, memoryLimit, memoryUtilization, cpuLimit, cpuPeriods, cpuThrottledPeriods, cpuThrottledTime,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register container metrics callback: %v", err)
+	}
+	return nil
+}
@@ -23,6 +23,26 @@ func InitializeSystemMetrics() {
 	if err != nil {
 		log.Printf("error initializing metrics, failed to setup metric recorder: %v\n", err)
 	}
+
+	cm, err := newContainerMetrics()
+	if err != nil || cm == nil {
+		// not running in a cgroup we can read
+		return
+	}
+	err = setUpContainerMetricRecorder(meter, cm)
+	if err != nil {
+		log.Printf("error initializing metrics, failed to setup container metric recorder: %v\n", err)
+	}
+}
+
+// InitializeRuntimeMetrics registers the Go runtime metrics read from runtime/metrics
+// on the global meter provider.
+func InitializeRuntimeMetrics() {
+	meter := otel.GetMeterProvider().Meter(meterName)
+	err := setUpRuntimeMetricRecorder(meter)
+	if err != nil {
+		log.Printf("error initializing runtime metrics: %v\n", err)
+	}
 }
 
 func setUpMetricRecorder(meter metric.Meter) error {
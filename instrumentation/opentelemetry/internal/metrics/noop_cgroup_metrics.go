@@ -0,0 +1,7 @@
+//go:build !linux
+
+package metrics
+
+func newContainerMetrics() (containerMetrics, error) {
+	return nil, nil
+}
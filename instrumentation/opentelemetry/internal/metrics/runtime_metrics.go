@@ -0,0 +1,257 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"runtime/metrics"
+	"sync"
+
+	"github.com/hypertrace/goagent/internal/config"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// RuntimeMetricsEnabledEnv is the environment variable turning the Go runtime metrics
+// on or off. They are reported by default whenever the agent metrics are enabled.
+const RuntimeMetricsEnabledEnv = "HT_TELEMETRY_RUNTIME_METRICS_ENABLED"
+
+// runtime/metrics samples read on every collection. The GC pauses are read from
+// /sched/pauses/total/gc:seconds when the runtime provides it, /gc/pauses:seconds
+// being deprecated since go1.22.
+const (
+	goroutinesSample     = "/sched/goroutines:goroutines"
+	heapObjectsSample    = "/gc/heap/objects:objects"
+	heapBytesSample      = "/memory/classes/heap/objects:bytes"
+	heapGoalSample       = "/gc/heap/goal:bytes"
+	gcCyclesSample       = "/gc/cycles/total:gc-cycles"
+	gcPausesSample       = "/sched/pauses/total/gc:seconds"
+	legacyGCPausesSample = "/gc/pauses:seconds"
+	schedLatenciesSample = "/sched/latencies:seconds"
+	memoryLimitSample    = "/gc/gomemlimit:bytes"
+	gomaxprocsSample     = "/sched/gomaxprocs:threads"
+)
+
+// quantiles reported for the runtime histograms. OpenTelemetry has no observable
+// histogram instrument so the distributions are summarized by these quantiles, 1
+// standing for the maximum.
+var quantiles = []float64{0.5, 0.9, 0.99, 1}
+
+var quantileAttributes = func() []attribute.Set {
+	sets := make([]attribute.Set, len(quantiles))
+	for i, q := range quantiles {
+		sets[i] = attribute.NewSet(attribute.Float64("quantile", q))
+	}
+	return sets
+}()
+
+// RuntimeMetricsEnabled tells whether the Go runtime metrics should be reported
+// according to RuntimeMetricsEnabledEnv.
+func RuntimeMetricsEnabled() bool {
+	return config.BoolEnv(RuntimeMetricsEnabledEnv, true)
+}
+
+// runtimeReader reads the runtime/metrics samples once per collection.
+type runtimeReader struct {
+	mux     sync.Mutex
+	samples []metrics.Sample
+	indexes map[string]int
+}
+
+func newRuntimeReader() *runtimeReader {
+	supported := map[string]bool{}
+	for _, desc := range metrics.All() {
+		supported[desc.Name] = true
+	}
+
+	pausesSample := gcPausesSample
+	if !supported[pausesSample] {
+		pausesSample = legacyGCPausesSample
+	}
+
+	r := &runtimeReader{indexes: map[string]int{}}
+	for _, name := range []string{
+		goroutinesSample, heapObjectsSample, heapBytesSample, heapGoalSample, gcCyclesSample,
+		pausesSample, schedLatenciesSample, memoryLimitSample, gomaxprocsSample,
+	} {
+		if !supported[name] {
+			continue
+		}
+		r.indexes[name] = len(r.samples)
+		r.samples = append(r.samples, metrics.Sample{Name: name})
+	}
+	// both pause samples are looked up by the current name
+	if idx, ok := r.indexes[legacyGCPausesSample]; ok {
+		r.indexes[gcPausesSample] = idx
+	}
+	return r
+}
+
+func (r *runtimeReader) read() {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	metrics.Read(r.samples)
+}
+
+// uint64Value returns the value of a scalar sample and whether it is available.
+func (r *runtimeReader) uint64Value(name string) (int64, bool) {
+	idx, ok := r.indexes[name]
+	if !ok || r.samples[idx].Value.Kind() != metrics.KindUint64 {
+		return 0, false
+	}
+	v := r.samples[idx].Value.Uint64()
+	if v > math.MaxInt64 {
+		v = math.MaxInt64
+	}
+	return int64(v), true
+}
+
+// histogram returns the distribution of a histogram sample, nil when it is not available.
+func (r *runtimeReader) histogram(name string) *metrics.Float64Histogram {
+	idx, ok := r.indexes[name]
+	if !ok || r.samples[idx].Value.Kind() != metrics.KindFloat64Histogram {
+		return nil
+	}
+	return r.samples[idx].Value.Float64Histogram()
+}
+
+// histogramCount returns the total number of observations in h.
+func histogramCount(h *metrics.Float64Histogram) int64 {
+	var count uint64
+	for _, c := range h.Counts {
+		count += c
+	}
+	if count > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(count)
+}
+
+// histogramQuantile returns the upper boundary of the bucket holding the q quantile of h,
+// the lower boundary when the upper one is infinite.
+func histogramQuantile(h *metrics.Float64Histogram, q float64) float64 {
+	total := histogramCount(h)
+	if total == 0 {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(q * float64(total)))
+	if rank == 0 {
+		rank = 1
+	}
+
+	var seen uint64
+	for i, c := range h.Counts {
+		seen += c
+		if seen < rank {
+			continue
+		}
+		// bucket i is [Buckets[i], Buckets[i+1])
+		if upper := h.Buckets[i+1]; !math.IsInf(upper, 1) {
+			return upper
+		}
+		return h.Buckets[i]
+	}
+	return 0
+}
+
+func setUpRuntimeMetricRecorder(meter metric.Meter) error {
+	if meter == nil {
+		return fmt.Errorf("error while setting up runtime metric recorder: meter is nil")
+	}
+
+	goroutines, err := meter.Int64ObservableGauge("hypertrace.agent.runtime.goroutines",
+		metric.WithDescription("Number of live goroutines"))
+	if err != nil {
+		return fmt.Errorf("error while setting up goroutines metric gauge: %v", err)
+	}
+	heapObjects, err := meter.Int64ObservableGauge("hypertrace.agent.runtime.heap.objects",
+		metric.WithDescription("Number of objects, live or unswept, occupying heap memory"))
+	if err != nil {
+		return fmt.Errorf("error while setting up heap objects metric gauge: %v", err)
+	}
+	heapBytes, err := meter.Int64ObservableGauge("hypertrace.agent.runtime.heap.bytes",
+		metric.WithDescription("Memory occupied by live objects and dead objects that have not yet been freed"),
+		metric.WithUnit("By"))
+	if err != nil {
+		return fmt.Errorf("error while setting up heap bytes metric gauge: %v", err)
+	}
+	heapGoal, err := meter.Int64ObservableGauge("hypertrace.agent.runtime.heap.goal",
+		metric.WithDescription("Heap size target for the end of the GC cycle"),
+		metric.WithUnit("By"))
+	if err != nil {
+		return fmt.Errorf("error while setting up heap goal metric gauge: %v", err)
+	}
+	gcCycles, err := meter.Int64ObservableCounter("hypertrace.agent.runtime.gc.cycles",
+		metric.WithDescription("Number of completed GC cycles"))
+	if err != nil {
+		return fmt.Errorf("error while setting up gc cycles metric counter: %v", err)
+	}
+	gcPauses, err := meter.Int64ObservableCounter("hypertrace.agent.runtime.gc.pause.count",
+		metric.WithDescription("Number of stop-the-world pauses caused by the GC"))
+	if err != nil {
+		return fmt.Errorf("error while setting up gc pause count metric counter: %v", err)
+	}
+	gcPause, err := meter.Float64ObservableGauge("hypertrace.agent.runtime.gc.pause",
+		metric.WithDescription("Quantiles of the stop-the-world pause latencies caused by the GC"),
+		metric.WithUnit("s"))
+	if err != nil {
+		return fmt.Errorf("error while setting up gc pause metric gauge: %v", err)
+	}
+	schedLatency, err := meter.Float64ObservableGauge("hypertrace.agent.runtime.sched.latency",
+		metric.WithDescription("Quantiles of the time goroutines spent runnable before running"),
+		metric.WithUnit("s"))
+	if err != nil {
+		return fmt.Errorf("error while setting up scheduler latency metric gauge: %v", err)
+	}
+	memoryLimit, err := meter.Int64ObservableGauge("hypertrace.agent.runtime.memory.limit",
+		metric.WithDescription("Go runtime memory limit configured by GOMEMLIMIT or debug.SetMemoryLimit"),
+		metric.WithUnit("By"))
+	if err != nil {
+		return fmt.Errorf("error while setting up memory limit metric gauge: %v", err)
+	}
+	gomaxprocs, err := meter.Int64ObservableGauge("hypertrace.agent.runtime.gomaxprocs",
+		metric.WithDescription("Current GOMAXPROCS setting"))
+	if err != nil {
+		return fmt.Errorf("error while setting up gomaxprocs metric gauge: %v", err)
+	}
+
+	reader := newRuntimeReader()
+	observeInt64 := func(result metric.Observer, o metric.Int64Observable, name string) {
+		if v, ok := reader.uint64Value(name); ok {
+			result.ObserveInt64(o, v)
+		}
+	}
+	observeQuantiles := func(result metric.Observer, o metric.Float64Observable, h *metrics.Float64Histogram) {
+		for i, q := range quantiles {
+			result.ObserveFloat64(o, histogramQuantile(h, q), metric.WithAttributeSet(quantileAttributes[i]))
+		}
+	}
+
+	_, err = meter.RegisterCallback(
+		func(ctx context.Context, result metric.Observer) error {
+			reader.read()
+			observeInt64(result, goroutines, goroutinesSample)
+			observeInt64(result, heapObjects, heapObjectsSample)
+			observeInt64(result, heapBytes, heapBytesSample)
+			observeInt64(result, heapGoal, heapGoalSample)
+			observeInt64(result, gcCycles, gcCyclesSample)
+			observeInt64(result, memoryLimit, memoryLimitSample)
+			observeInt64(result, gomaxprocs, gomaxprocsSample)
+			if h := reader.histogram(gcPausesSample); h != nil {
+				result.ObserveInt64(gcPauses, histogramCount(h))
+				observeQuantiles(result, gcPause, h)
+			}
+			if h := reader.histogram(schedLatenciesSample); h != nil {
+				observeQuantiles(result, schedLatency, h)
+			}
+			return nil
+		},
+		goroutines, heapObjects, heapBytes, heapGoal, gcCycles, gcPauses, gcPause,
+		schedLatency, memoryLimit, gomaxprocs,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register runtime metrics callback: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"context"
+	"math"
+	"runtime"
+	"runtime/metrics"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestRuntimeMetricsEnabled(t *testing.T) {
+	t.Setenv(RuntimeMetricsEnabledEnv, "")
+	assert.True(t, RuntimeMetricsEnabled())
+
+	t.Setenv(RuntimeMetricsEnabledEnv, "false")
+	assert.False(t, RuntimeMetricsEnabled())
+
+	t.Setenv(RuntimeMetricsEnabledEnv, "not-a-bool")
+	assert.True(t, RuntimeMetricsEnabled())
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	h := &metrics.Float64Histogram{
+		Counts:  []uint64{5, 4, 0, 1},
+		Buckets: []float64{0, 1, 2, 3, math.Inf(1)},
+	}
+
+	assert.Equal(t, int64(10), histogramCount(h))
+	assert.Equal(t, 1.0, histogramQuantile(h, 0.5))
+	assert.Equal(t, 2.0, histogramQuantile(h, 0.9))
+	assert.Equal(t, 3.0, histogramQuantile(h, 1))
+	assert.Equal(t, 0.0, histogramQuantile(&metrics.Float64Histogram{
+		Counts:  []uint64{0},
+		Buckets: []float64{0, 1},
+	}, 0.5))
+}
+
+func TestSetUpRuntimeMetricRecorder(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter(meterName)
+	require.NoError(t, setUpRuntimeMetricRecorder(meter))
+
+	runtime.GC()
+
+	rm := metricdata.ResourceMetrics{}
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+	assert.Equal(t, meterName, rm.ScopeMetrics[0].Scope.Name)
+
+	collected := map[string]metricdata.Aggregation{}
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		collected[m.Name] = m.Data
+	}
+
+	goroutines := collected["hypertrace.agent.runtime.goroutines"].(metricdata.Gauge[int64])
+	assert.Greater(t, goroutines.DataPoints[0].Value, int64(0))
+
+	gomaxprocs := collected["hypertrace.agent.runtime.gomaxprocs"].(metricdata.Gauge[int64])
+	assert.Equal(t, int64(runtime.GOMAXPROCS(0)), gomaxprocs.DataPoints[0].Value)
+
+	gcCycles := collected["hypertrace.agent.runtime.gc.cycles"].(metricdata.Sum[int64])
+	assert.True(t, gcCycles.IsMonotonic)
+	assert.GreaterOrEqual(t, gcCycles.DataPoints[0].Value, int64(1))
+
+	gcPause := collected["hypertrace.agent.runtime.gc.pause"].(metricdata.Gauge[float64])
+	assert.Len(t, gcPause.DataPoints, len(quantiles))
+
+	for _, name := range []string{
+		"hypertrace.agent.runtime.heap.objects",
+		"hypertrace.agent.runtime.heap.bytes",
+		"hypertrace.agent.runtime.heap.goal",
+		"hypertrace.agent.runtime.gc.pause.count",
+		"hypertrace.agent.runtime.sched.latency",
+		"hypertrace.agent.runtime.memory.limit",
+	} {
+		assert.Contains(t, collected, name)
+	}
+}
@@ -0,0 +1,77 @@
+package hyperslog // import "github.com/hypertrace/goagent/instrumentation/opentelemetry/log/hyperslog"
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry/internal/logcorrelation"
+)
+
+type options struct {
+	errorEvents bool
+}
+
+// Option configures the Handler.
+type Option func(*options)
+
+// WithErrorEvents mirrors the records of level error and above onto the span in the
+// context as events.
+func WithErrorEvents() Option {
+	return func(o *options) {
+		o.errorEvents = true
+	}
+}
+
+var _ slog.Handler = (*Handler)(nil)
+
+// Handler adds the trace_id, span_id and trace_flags of the span in the context to the
+// records before passing them to the wrapped handler. The context is the one passed to the
+// logger, e.g. with slog.InfoContext.
+type Handler struct {
+	slog.Handler
+	opts options
+}
+
+// NewHandler wraps h so the records it handles are correlated with the traces.
+func NewHandler(h slog.Handler, opts ...Option) *Handler {
+	handler := &Handler{Handler: h}
+	for _, opt := range opts {
+		opt(&handler.opts)
+	}
+	return handler
+}
+
+// Handle adds the trace context to r.
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	sc, ok := logcorrelation.SpanContext(ctx)
+	if !ok {
+		return h.Handler.Handle(ctx, r)
+	}
+
+	if h.opts.errorEvents && r.Level >= slog.LevelError {
+		fields := map[string]interface{}{}
+		r.Attrs(func(attr slog.Attr) bool {
+			fields[attr.Key] = attr.Value.Resolve().Any()
+			return true
+		})
+		logcorrelation.RecordLog(ctx, r.Time, r.Level.String(), r.Message, fields)
+	}
+
+	r = r.Clone()
+	r.AddAttrs(
+		slog.String(logcorrelation.TraceIDKey, sc.TraceID().String()),
+		slog.String(logcorrelation.SpanIDKey, sc.SpanID().String()),
+		slog.String(logcorrelation.TraceFlagsKey, sc.TraceFlags().String()),
+	)
+	return h.Handler.Handle(ctx, r)
+}
+
+// WithAttrs returns a Handler wrapping the wrapped handler with attrs.
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &Handler{Handler: h.Handler.WithAttrs(attrs), opts: h.opts}
+}
+
+// WithGroup returns a Handler wrapping the wrapped handler with the group name.
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return &Handler{Handler: h.Handler.WithGroup(name), opts: h.opts}
+}
@@ -0,0 +1,67 @@
+package hyperslog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry/internal/tracetesting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlerAddsTraceContext(t *testing.T) {
+	tracer, flusher := tracetesting.InitTracer()
+	buf := &bytes.Buffer{}
+	logger := slog.New(NewHandler(slog.NewJSONHandler(buf, nil))).With("component", "checkout")
+
+	ctx, span := tracer.Start(context.Background(), "test")
+	logger.InfoContext(ctx, "processing order", "order_id", 1)
+	logger.ErrorContext(ctx, "failed to process order", "error", errors.New("out of stock"))
+	span.End()
+
+	var record map[string]interface{}
+	require.NoError(t, json.NewDecoder(buf).Decode(&record))
+	assert.Equal(t, span.SpanContext().TraceID().String(), record["trace_id"])
+	assert.Equal(t, span.SpanContext().SpanID().String(), record["span_id"])
+	assert.Equal(t, "01", record["trace_flags"])
+	assert.Equal(t, "checkout", record["component"])
+
+	// error logs aren't mirrored by default
+	spans := flusher()
+	require.Len(t, spans, 1)
+	assert.Empty(t, spans[0].Events())
+}
+
+func TestHandlerWithoutSpan(t *testing.T) {
+	buf := &bytes.Buffer{}
+	slog.New(NewHandler(slog.NewJSONHandler(buf, nil))).InfoContext(context.Background(), "no span")
+
+	var record map[string]interface{}
+	require.NoError(t, json.NewDecoder(buf).Decode(&record))
+	assert.NotContains(t, record, "trace_id")
+}
+
+func TestHandlerMirrorsErrorLogs(t *testing.T) {
+	tracer, flusher := tracetesting.InitTracer()
+	logger := slog.New(NewHandler(slog.NewTextHandler(&bytes.Buffer{}, nil), WithErrorEvents()))
+
+	ctx, span := tracer.Start(context.Background(), "test")
+	logger.WarnContext(ctx, "retrying")
+	logger.ErrorContext(ctx, "failed to process order", "error", errors.New("out of stock"))
+	span.End()
+
+	spans := flusher()
+	require.Len(t, spans, 1)
+	events := spans[0].Events()
+	require.Len(t, events, 1)
+	assert.Equal(t, "log", events[0].Name)
+
+	attrs := tracetesting.LookupAttributes(events[0].Attributes)
+	assert.Equal(t, "ERROR", attrs.Get("log.severity").AsString())
+	assert.Equal(t, "failed to process order", attrs.Get("log.message").AsString())
+	assert.Equal(t, "out of stock", attrs.Get("error").AsString())
+}
@@ -0,0 +1,189 @@
+package opentelemetry // import "github.com/hypertrace/goagent/instrumentation/opentelemetry"
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	config "github.com/hypertrace/agent-config/gen/go/v1"
+	internalconfig "github.com/hypertrace/goagent/internal/config"
+	"go.opentelemetry.io/contrib/bridges/otelslog"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutlog"
+	"go.opentelemetry.io/otel/log/global"
+	"go.opentelemetry.io/otel/log/noop"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// Environment variables configuring the logs pipeline.
+const (
+	// LogsEnabledEnv turns on the export of the logs written through the LoggerProvider.
+	LogsEnabledEnv = "HT_LOGS_ENABLED"
+	// LogsEndpointEnv overrides the endpoint the logs are exported to, the reporting
+	// endpoint being used by default.
+	LogsEndpointEnv = "HT_LOGS_ENDPOINT"
+	// LogsFileEnv makes the logs be written as JSON to the given file instead of being
+	// exported to an endpoint.
+	LogsFileEnv = "HT_LOGS_FILE"
+)
+
+func logsEnabled() bool {
+	return internalconfig.BoolEnv(LogsEnabledEnv, false)
+}
+
+// makeLogsExporterFactory returns the factory of the logs exporter matching the trace
+// reporter type, nil when the reporter can't receive logs.
+func makeLogsExporterFactory(cfg *config.AgentConfig) func(opts ...ServiceOption) (sdklog.Exporter, error) {
+	if file := os.Getenv(LogsFileEnv); file != "" {
+		return func(_ ...ServiceOption) (sdklog.Exporter, error) {
+			f, err := os.OpenFile(filepath.Clean(file), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+			if err != nil {
+				return nil, err
+			}
+			exporter, err := stdoutlog.New(stdoutlog.WithWriter(f))
+			if err != nil {
+				f.Close()
+				return nil, err
+			}
+			return &fileLogExporter{Exporter: exporter, file: f}, nil
+		}
+	}
+
+	endpoint := os.Getenv(LogsEndpointEnv)
+	if len(endpoint) == 0 {
+		endpoint = cfg.GetReporting().GetEndpoint().GetValue()
+	}
+
+	switch cfg.GetReporting().GetTraceReporterType() {
+	case config.TraceReporterType_LOGGING:
+		return func(_ ...ServiceOption) (sdklog.Exporter, error) {
+			return stdoutlog.New(stdoutlog.WithPrettyPrint())
+		}
+
+	case config.TraceReporterType_ZIPKIN:
+		// zipkin does not support logs, an OTLP endpoint has to be set explicitly
+		if len(os.Getenv(LogsEndpointEnv)) == 0 {
+			return nil
+		}
+		return makeOTLPGRPCLogsExporterFactory(cfg, endpoint)
+
+	case config.TraceReporterType_OTLP_HTTP:
+		standardOpts := []otlploghttp.Option{
+			otlploghttp.WithEndpoint(endpoint),
+		}
+
+		transport := makeHTTPTransport(cfg.GetReporting())
+		if transport.insecure {
+			standardOpts = append(standardOpts, otlploghttp.WithInsecure())
+		}
+		if transport.tlsConfig != nil {
+			standardOpts = append(standardOpts, otlploghttp.WithTLSClientConfig(transport.tlsConfig))
+		}
+
+		return func(opts ...ServiceOption) (sdklog.Exporter, error) {
+			serviceOpts := &ServiceOptions{
+				headers: make(map[string]string),
+			}
+			for _, opt := range opts {
+				opt(serviceOpts)
+			}
+
+			finalOpts := append([]otlploghttp.Option{}, standardOpts...)
+			finalOpts = append(finalOpts, otlploghttp.WithHeaders(serviceOpts.headers))
+
+			return otlploghttp.New(context.Background(), finalOpts...)
+		}
+
+	default:
+		return makeOTLPGRPCLogsExporterFactory(cfg, endpoint)
+	}
+}
+
+func makeOTLPGRPCLogsExporterFactory(cfg *config.AgentConfig, endpoint string) func(opts ...ServiceOption) (sdklog.Exporter, error) {
+	standardOpts := []otlploggrpc.Option{
+		otlploggrpc.WithEndpoint(removeProtocolPrefixForOTLP(endpoint)),
+	}
+
+	transport := makeGRPCTransport(cfg.GetReporting())
+	if transport.insecure {
+		standardOpts = append(standardOpts, otlploggrpc.WithInsecure())
+	}
+	if transport.credentials != nil {
+		standardOpts = append(standardOpts, otlploggrpc.WithTLSCredentials(transport.credentials))
+	}
+	if transport.serviceConfig != "" {
+		standardOpts = append(standardOpts, otlploggrpc.WithServiceConfig(transport.serviceConfig))
+	}
+
+	return func(opts ...ServiceOption) (sdklog.Exporter, error) {
+		serviceOpts := &ServiceOptions{
+			headers: make(map[string]string),
+		}
+		for _, opt := range opts {
+			opt(serviceOpts)
+		}
+
+		finalOpts := append([]otlploggrpc.Option{}, standardOpts...)
+		finalOpts = append(finalOpts, otlploggrpc.WithHeaders(serviceOpts.headers))
+
+		return otlploggrpc.New(context.Background(), finalOpts...)
+	}
+}
+
+// fileLogExporter closes the file the logs are written to on shutdown.
+type fileLogExporter struct {
+	*stdoutlog.Exporter
+	file *os.File
+}
+
+func (e *fileLogExporter) Shutdown(ctx context.Context) error {
+	err := e.Exporter.Shutdown(ctx)
+	if closeErr := e.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// initializeLogs sets up the global LoggerProvider batching the logs to the exporter, the
+// logs sharing the resource of the traces.
+func initializeLogs(cfg *config.AgentConfig, resources *resource.Resource, opts ...ServiceOption) func() {
+	if !logsEnabled() {
+		return func() {}
+	}
+
+	logsExporterFactory := makeLogsExporterFactory(cfg)
+	if logsExporterFactory == nil {
+		log.Printf("logs are not exported as the %s reporter does not support them and %s is not set\n",
+			cfg.GetReporting().GetTraceReporterType(), LogsEndpointEnv)
+		return func() {}
+	}
+
+	exporter, err := logsExporterFactory(opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	loggerProvider := sdklog.NewLoggerProvider(
+		sdklog.WithProcessor(sdklog.NewBatchProcessor(exporter)),
+		sdklog.WithResource(resources),
+	)
+	global.SetLoggerProvider(loggerProvider)
+
+	return func() {
+		err := loggerProvider.Shutdown(context.Background())
+		if err != nil {
+			log.Printf("an error while calling logger provider shutdown: %v", err)
+		}
+		global.SetLoggerProvider(noop.NewLoggerProvider())
+	}
+}
+
+// NewLogHandler returns a slog.Handler writing the records, along with the trace context
+// of the span in the context they are logged with, to the LoggerProvider set up by Init.
+func NewLogHandler(name string) slog.Handler {
+	return otelslog.NewHandler(name)
+}
@@ -0,0 +1,51 @@
+package opentelemetry
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	config "github.com/hypertrace/agent-config/gen/go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestLogsAreWrittenToFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "logs.json")
+	t.Setenv(LogsEnabledEnv, "true")
+	t.Setenv(LogsFileEnv, file)
+
+	res := resource.NewSchemaless(attribute.String("service.name", "checkout"))
+	shutdown := initializeLogs(config.Load(), res)
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x01},
+		SpanID:     trace.SpanID{0x02},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+	slog.New(NewLogHandler("test")).InfoContext(ctx, "processing order", "order_id", 42)
+
+	shutdown()
+
+	content, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "processing order")
+	assert.Contains(t, string(content), "order_id")
+	assert.Contains(t, string(content), sc.TraceID().String())
+	assert.Contains(t, string(content), "checkout")
+}
+
+func TestLogsExporterFactoryIsNilForZipkin(t *testing.T) {
+	cfg := config.Load()
+	cfg.Reporting.TraceReporterType = config.TraceReporterType_ZIPKIN
+	assert.Nil(t, makeLogsExporterFactory(cfg))
+
+	t.Setenv(LogsEndpointEnv, "localhost:4317")
+	assert.NotNil(t, makeLogsExporterFactory(cfg))
+}
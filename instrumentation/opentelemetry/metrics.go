@@ -1,11 +1,20 @@
 package opentelemetry // import "github.com/hypertrace/goagent/instrumentation/opentelemetry"
 
 import (
+	"context"
+	"errors"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/version"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
 	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
 )
@@ -17,18 +26,103 @@ const (
 	// created for that one for some reason.(annotated with hypertrace to avoid a duplicate if otel go ever implement
 	// their own)
 	requestCountCounterName = "hypertrace.http.server.request_count" // Incoming request count total
+	// Unlike the otelhttp ones, the following metrics are labelled by route and status class.
+	activeRequestsCounterName = "hypertrace.http.server.active_requests"
+	durationHistogramName     = "hypertrace.http.server.duration"
+	requestSizeHistogramName  = "hypertrace.http.server.request.body.size"
+	responseSizeHistogramName = "hypertrace.http.server.response.body.size"
+	httpRouteKey              = attribute.Key("http.route")
+	httpStatusClassKey        = attribute.Key("http.status_class")
 )
 
+// MetricsOption configures the histograms of the metrics handlers.
+type MetricsOption func(*metricsOptions)
+
+type metricsOptions struct {
+	durationBuckets    []float64
+	sizeBuckets        []float64
+	maxServerAddresses int
+}
+
+// WithDurationBuckets sets the bucket boundaries, in milliseconds, of the duration histograms.
+func WithDurationBuckets(bounds ...float64) MetricsOption {
+	return func(o *metricsOptions) {
+		o.durationBuckets = bounds
+	}
+}
+
+// WithSizeBuckets sets the bucket boundaries, in bytes, of the size histograms.
+func WithSizeBuckets(bounds ...float64) MetricsOption {
+	return func(o *metricsOptions) {
+		o.sizeBuckets = bounds
+	}
+}
+
+// WithMaxServerAddresses sets the number of distinct server addresses labelling the client metrics,
+// the requests to other servers being labelled as "_OTHER". Defaults to 100.
+func WithMaxServerAddresses(n int) MetricsOption {
+	return func(o *metricsOptions) {
+		o.maxServerAddresses = n
+	}
+}
+
+var (
+	defaultMetricsOptionsMux sync.RWMutex
+	defaultMetricsOptions    []MetricsOption
+)
+
+// SetDefaultMetricsOptions sets the options applied to every metrics handler created afterwards,
+// including the ones created by the instrumentations, before the options they are given.
+func SetDefaultMetricsOptions(opts ...MetricsOption) {
+	defaultMetricsOptionsMux.Lock()
+	defer defaultMetricsOptionsMux.Unlock()
+	defaultMetricsOptions = opts
+}
+
+func newMetricsOptions(opts []MetricsOption) *metricsOptions {
+	defaultMetricsOptionsMux.RLock()
+	defer defaultMetricsOptionsMux.RUnlock()
+
+	o := &metricsOptions{maxServerAddresses: defaultMaxServerAddresses}
+	for _, opt := range append(defaultMetricsOptions, opts...) {
+		opt(o)
+	}
+	return o
+}
+
+func (o *metricsOptions) durationHistogramOptions(description string) []metric.Float64HistogramOption {
+	opts := []metric.Float64HistogramOption{metric.WithDescription(description), metric.WithUnit("ms")}
+	if len(o.durationBuckets) > 0 {
+		opts = append(opts, metric.WithExplicitBucketBoundaries(o.durationBuckets...))
+	}
+	return opts
+}
+
+func (o *metricsOptions) sizeHistogramOptions(description string) []metric.Int64HistogramOption {
+	opts := []metric.Int64HistogramOption{metric.WithDescription(description), metric.WithUnit("By")}
+	if len(o.sizeBuckets) > 0 {
+		opts = append(opts, metric.WithExplicitBucketBoundaries(o.sizeBuckets...))
+	}
+	return opts
+}
+
 type HttpOperationMetricsHandler struct {
-	operationNameGetter func(*http.Request) string
-	requestCountCounter metric.Int64Counter
+	operationNameGetter   func(*http.Request) string
+	requestCountCounter   metric.Int64Counter
+	activeRequestsCounter metric.Int64UpDownCounter
+	durationHistogram     metric.Float64Histogram
+	requestSizeHistogram  metric.Int64Histogram
+	responseSizeHistogram metric.Int64Histogram
 }
 
-var _ sdk.HttpOperationMetricsHandler = (*HttpOperationMetricsHandler)(nil)
+var _ sdk.HttpServerMetricsHandler = (*HttpOperationMetricsHandler)(nil)
 
-func NewHttpOperationMetricsHandler(nameGetter func(*http.Request) string) sdk.HttpOperationMetricsHandler {
+// NewHttpOperationMetricsHandler returns the metrics handler of HTTP servers, nameGetter returning
+// the route template of the requests, e.g. "/users/{id}", or an empty string when unknown.
+func NewHttpOperationMetricsHandler(nameGetter func(*http.Request) string, opts ...MetricsOption) sdk.HttpOperationMetricsHandler {
 	mp := otel.GetMeterProvider()
 	meter := mp.Meter(meterName, metric.WithInstrumentationVersion(otelhttp.SemVersion()))
+	o := newMetricsOptions(opts)
 
 	// Set up net http metrics
 	// RequestCount Counter
@@ -37,9 +131,34 @@ func NewHttpOperationMetricsHandler(nameGetter func(*http.Request) string) sdk.H
 		otel.Handle(err)
 	}
 
+	activeRequestsCounter, err := meter.Int64UpDownCounter(activeRequestsCounterName,
+		metric.WithDescription("Number of requests being handled."), metric.WithUnit("{request}"))
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	durationHistogram, err := meter.Float64Histogram(durationHistogramName, o.durationHistogramOptions("Duration of the requests.")...)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	requestSizeHistogram, err := meter.Int64Histogram(requestSizeHistogramName, o.sizeHistogramOptions("Size of the request bodies.")...)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	responseSizeHistogram, err := meter.Int64Histogram(responseSizeHistogramName, o.sizeHistogramOptions("Size of the response bodies.")...)
+	if err != nil {
+		otel.Handle(err)
+	}
+
 	return &HttpOperationMetricsHandler{
-		operationNameGetter: nameGetter,
-		requestCountCounter: requestCountCounter,
+		operationNameGetter:   nameGetter,
+		requestCountCounter:   requestCountCounter,
+		activeRequestsCounter: activeRequestsCounter,
+		durationHistogram:     durationHistogram,
+		requestSizeHistogram:  requestSizeHistogram,
+		responseSizeHistogram: responseSizeHistogram,
 	}
 }
 
@@ -51,3 +170,285 @@ func (mh *HttpOperationMetricsHandler) AddToRequestCount(n int64, r *http.Reques
 	attributes := append(labeler.Get(), semconv.HTTPServerMetricAttributesFromHTTPRequest(operationName, r)...)
 	mh.requestCountCounter.Add(ctx, n, metric.WithAttributes(attributes...))
 }
+
+func (mh *HttpOperationMetricsHandler) AddToActiveRequests(n int64, r *http.Request) {
+	mh.activeRequestsCounter.Add(r.Context(), n, metric.WithAttributes(mh.routeAttributes(r)...))
+}
+
+// RecordHttpOperation records the duration and the body sizes of the request. The measurements are
+// made with the request context so the exemplars link to the trace of the request.
+func (mh *HttpOperationMetricsHandler) RecordHttpOperation(r *http.Request, op sdk.HttpOperation) {
+	ctx := r.Context()
+	labeler, _ := otelhttp.LabelerFromContext(ctx)
+	attributes := append(labeler.Get(), mh.routeAttributes(r)...)
+	attributes = append(attributes, httpStatusClassKey.String(statusClass(op.StatusCode)))
+	attrs := metric.WithAttributes(attributes...)
+
+	mh.durationHistogram.Record(ctx, float64(op.Duration)/float64(time.Millisecond), attrs)
+	mh.requestSizeHistogram.Record(ctx, op.RequestSize, attrs)
+	mh.responseSizeHistogram.Record(ctx, op.ResponseSize, attrs)
+}
+
+func (mh *HttpOperationMetricsHandler) routeAttributes(r *http.Request) []attribute.KeyValue {
+	attributes := []attribute.KeyValue{semconv.HTTPMethodKey.String(r.Method)}
+	if route := mh.operationNameGetter(r); route != "" {
+		attributes = append(attributes, httpRouteKey.String(route))
+	}
+	return attributes
+}
+
+// statusClass returns the class of the status code, e.g. "2xx", which keeps the cardinality
+// of the metrics low.
+func statusClass(statusCode int) string {
+	if statusCode < 100 || statusCode > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(statusCode/100) + "xx"
+}
+
+// Client HTTP metrics.
+const (
+	clientRequestCountCounterName   = "hypertrace.http.client.request_count"
+	clientDurationHistogramName     = "hypertrace.http.client.duration"
+	clientResponseSizeHistogramName = "hypertrace.http.client.response.body.size"
+	clientErrorsCounterName         = "hypertrace.http.client.errors"
+	serverAddressKey                = attribute.Key("server.address")
+	errorTypeKey                    = attribute.Key("error.type")
+	defaultMaxServerAddresses       = 100
+	otherValue                      = "_OTHER"
+)
+
+// knownMethods are the methods labelling the metrics as is, other ones being labelled as
+// "_OTHER" as they are client provided.
+var knownMethods = map[string]struct{}{
+	http.MethodGet: {}, http.MethodHead: {}, http.MethodPost: {}, http.MethodPut: {}, http.MethodPatch: {},
+	http.MethodDelete: {}, http.MethodConnect: {}, http.MethodOptions: {}, http.MethodTrace: {},
+}
+
+// valueLimiter bounds the number of distinct values of an attribute, the values seen once the
+// limit is reached being replaced by "_OTHER".
+type valueLimiter struct {
+	max    int
+	mux    sync.Mutex
+	values map[string]struct{}
+}
+
+func newValueLimiter(max int) *valueLimiter {
+	return &valueLimiter{max: max, values: make(map[string]struct{})}
+}
+
+func (l *valueLimiter) limit(value string) string {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if _, ok := l.values[value]; ok {
+		return value
+	}
+	if len(l.values) >= l.max {
+		return otherValue
+	}
+	l.values[value] = struct{}{}
+	return value
+}
+
+type HttpClientMetricsHandler struct {
+	serverAddresses       *valueLimiter
+	requestCountCounter   metric.Int64Counter
+	durationHistogram     metric.Float64Histogram
+	responseSizeHistogram metric.Int64Histogram
+	errorsCounter         metric.Int64Counter
+}
+
+var _ sdk.HttpClientMetricsHandler = (*HttpClientMetricsHandler)(nil)
+
+// NewHttpClientMetricsHandler returns the metrics handler of HTTP clients. The metrics are labelled
+// by the server address but never by the URL.
+func NewHttpClientMetricsHandler(opts ...MetricsOption) sdk.HttpClientMetricsHandler {
+	mp := otel.GetMeterProvider()
+	meter := mp.Meter(meterName, metric.WithInstrumentationVersion(otelhttp.SemVersion()))
+	o := newMetricsOptions(opts)
+
+	requestCountCounter, err := meter.Int64Counter(clientRequestCountCounterName,
+		metric.WithDescription("Number of requests sent."), metric.WithUnit("{request}"))
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	durationHistogram, err := meter.Float64Histogram(clientDurationHistogramName,
+		o.durationHistogramOptions("Duration of the requests until the response headers are received.")...)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	responseSizeHistogram, err := meter.Int64Histogram(clientResponseSizeHistogramName,
+		o.sizeHistogramOptions("Size of the response bodies.")...)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	errorsCounter, err := meter.Int64Counter(clientErrorsCounterName,
+		metric.WithDescription("Number of requests failed or answered with an error status."), metric.WithUnit("{request}"))
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	return &HttpClientMetricsHandler{
+		serverAddresses:       newValueLimiter(o.maxServerAddresses),
+		requestCountCounter:   requestCountCounter,
+		durationHistogram:     durationHistogram,
+		responseSizeHistogram: responseSizeHistogram,
+		errorsCounter:         errorsCounter,
+	}
+}
+
+func (mh *HttpClientMetricsHandler) RecordHttpClientOperation(req *http.Request, op sdk.HttpClientOperation) {
+	ctx := req.Context()
+	attributes := mh.attributes(req, op.StatusCode)
+	attrs := metric.WithAttributes(attributes...)
+
+	mh.requestCountCounter.Add(ctx, 1, attrs)
+	mh.durationHistogram.Record(ctx, float64(op.Duration)/float64(time.Millisecond), attrs)
+
+	if errorType := clientErrorType(op); errorType != "" {
+		mh.errorsCounter.Add(ctx, 1, metric.WithAttributes(append(attributes, errorTypeKey.String(errorType))...))
+	}
+}
+
+func (mh *HttpClientMetricsHandler) RecordHttpClientResponseSize(req *http.Request, statusCode int, size int64) {
+	mh.responseSizeHistogram.Record(req.Context(), size, metric.WithAttributes(mh.attributes(req, statusCode)...))
+}
+
+func (mh *HttpClientMetricsHandler) attributes(req *http.Request, statusCode int) []attribute.KeyValue {
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	if _, ok := knownMethods[method]; !ok {
+		method = otherValue
+	}
+
+	host := req.Host
+	if req.URL != nil && req.URL.Host != "" {
+		host = req.URL.Host
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	return []attribute.KeyValue{
+		serverAddressKey.String(mh.serverAddresses.limit(strings.ToLower(host))),
+		semconv.HTTPMethodKey.String(method),
+		httpStatusClassKey.String(statusClass(statusCode)),
+	}
+}
+
+// clientErrorType returns the type of the error of the request, empty when it succeeded.
+func clientErrorType(op sdk.HttpClientOperation) string {
+	if op.Err != nil {
+		var netErr net.Error
+		switch {
+		case errors.Is(op.Err, context.Canceled):
+			return "canceled"
+		case errors.Is(op.Err, context.DeadlineExceeded), errors.As(op.Err, &netErr) && netErr.Timeout():
+			return "timeout"
+		default:
+			return "transport"
+		}
+	}
+
+	if op.StatusCode >= http.StatusBadRequest {
+		return statusClass(op.StatusCode)
+	}
+	return ""
+}
+
+// RPC metrics.
+const (
+	rpcMeterName = "goagent.hypertrace.org/grpc"
+	// The RPC metrics are annotated with hypertrace to avoid clashing with the ones of otelgrpc, which
+	// are recorded by the stats handlers and only partially by the interceptors.
+	rpcServerRequestCountName = "hypertrace.rpc.server.request_count"
+	rpcServerDurationName     = "hypertrace.rpc.server.duration"
+	rpcServerRequestSizeName  = "hypertrace.rpc.server.request.size"
+	rpcServerResponseSizeName = "hypertrace.rpc.server.response.size"
+	rpcClientRequestCountName = "hypertrace.rpc.client.request_count"
+	rpcClientDurationName     = "hypertrace.rpc.client.duration"
+	rpcClientRequestSizeName  = "hypertrace.rpc.client.request.size"
+	rpcClientResponseSizeName = "hypertrace.rpc.client.response.size"
+)
+
+// rpcInstruments are the instruments of one side, client or server, of the RPCs.
+type rpcInstruments struct {
+	requestCount metric.Int64Counter
+	duration     metric.Float64Histogram
+	requestSize  metric.Int64Histogram
+	responseSize metric.Int64Histogram
+}
+
+func newRPCInstruments(meter metric.Meter, o *metricsOptions, requestCountName, durationName, requestSizeName, responseSizeName string) rpcInstruments {
+	var (
+		i   rpcInstruments
+		err error
+	)
+
+	if i.requestCount, err = meter.Int64Counter(requestCountName, metric.WithDescription("Number of RPCs."), metric.WithUnit("{request}")); err != nil {
+		otel.Handle(err)
+	}
+	if i.duration, err = meter.Float64Histogram(durationName, o.durationHistogramOptions("Duration of the RPCs.")...); err != nil {
+		otel.Handle(err)
+	}
+	if i.requestSize, err = meter.Int64Histogram(requestSizeName, o.sizeHistogramOptions("Total size of the request messages of the RPCs.")...); err != nil {
+		otel.Handle(err)
+	}
+	if i.responseSize, err = meter.Int64Histogram(responseSizeName, o.sizeHistogramOptions("Total size of the response messages of the RPCs.")...); err != nil {
+		otel.Handle(err)
+	}
+	return i
+}
+
+type RpcOperationMetricsHandler struct {
+	server rpcInstruments
+	client rpcInstruments
+}
+
+var _ sdk.RpcOperationMetricsHandler = (*RpcOperationMetricsHandler)(nil)
+
+func NewRpcOperationMetricsHandler(opts ...MetricsOption) sdk.RpcOperationMetricsHandler {
+	meter := otel.GetMeterProvider().Meter(rpcMeterName, metric.WithInstrumentationVersion(version.Version))
+	o := newMetricsOptions(opts)
+
+	return &RpcOperationMetricsHandler{
+		server: newRPCInstruments(meter, o, rpcServerRequestCountName, rpcServerDurationName, rpcServerRequestSizeName, rpcServerResponseSizeName),
+		client: newRPCInstruments(meter, o, rpcClientRequestCountName, rpcClientDurationName, rpcClientRequestSizeName, rpcClientResponseSizeName),
+	}
+}
+
+func (mh *RpcOperationMetricsHandler) RecordRpcOperation(ctx context.Context, op sdk.RpcOperation) {
+	instruments := mh.server
+	if op.IsClient {
+		instruments = mh.client
+	}
+
+	service, method := parseFullMethod(op.FullMethod)
+	attrs := metric.WithAttributes(
+		semconv.RPCSystemKey.String("grpc"),
+		semconv.RPCServiceKey.String(service),
+		semconv.RPCMethodKey.String(method),
+		semconv.RPCGRPCStatusCodeKey.Int(op.StatusCode),
+	)
+
+	instruments.requestCount.Add(ctx, 1, attrs)
+	instruments.duration.Record(ctx, float64(op.Duration)/float64(time.Millisecond), attrs)
+	instruments.requestSize.Record(ctx, op.RequestSize, attrs)
+	instruments.responseSize.Record(ctx, op.ResponseSize, attrs)
+}
+
+// parseFullMethod splits a full method name like "/helloworld.Greeter/SayHello" into
+// its service and method names.
+func parseFullMethod(fullMethod string) (string, string) {
+	name := strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return name, ""
+}
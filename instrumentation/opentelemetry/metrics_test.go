@@ -0,0 +1,201 @@
+package opentelemetry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// initMeterProvider sets a meter provider whose metrics are collected by the returned reader.
+func initMeterProvider(t *testing.T) *sdkmetric.ManualReader {
+	reader := sdkmetric.NewManualReader()
+	defaultProvider := otel.GetMeterProvider()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	t.Cleanup(func() { otel.SetMeterProvider(defaultProvider) })
+	return reader
+}
+
+func collectMetrics(t *testing.T, reader *sdkmetric.ManualReader) map[string]metricdata.Metrics {
+	rm := metricdata.ResourceMetrics{}
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+
+	metrics := map[string]metricdata.Metrics{}
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		metrics[m.Name] = m
+	}
+	return metrics
+}
+
+func TestHttpOperationMetricsHandler(t *testing.T) {
+	reader := initMeterProvider(t)
+
+	mh := NewHttpOperationMetricsHandler(
+		func(*http.Request) string { return "/users/{id}" },
+		WithDurationBuckets(10, 100),
+		WithSizeBuckets(64, 1024),
+	).(sdk.HttpServerMetricsHandler)
+
+	traceID := trace.TraceID{0x01}
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     trace.SpanID{0x01},
+		TraceFlags: trace.FlagsSampled,
+	}))
+	r := httptest.NewRequest(http.MethodGet, "http://localhost/users/1", nil).WithContext(ctx)
+
+	mh.AddToActiveRequests(1, r)
+	mh.RecordHttpOperation(r, sdk.HttpOperation{
+		StatusCode:   http.StatusNotFound,
+		Duration:     50 * time.Millisecond,
+		RequestSize:  0,
+		ResponseSize: 100,
+	})
+
+	metrics := collectMetrics(t, reader)
+
+	active := metrics["hypertrace.http.server.active_requests"].Data.(metricdata.Sum[int64]).DataPoints
+	require.Len(t, active, 1)
+	assert.Equal(t, int64(1), active[0].Value)
+	assert.Equal(t, attribute.NewSet(
+		attribute.String("http.method", "GET"),
+		attribute.String("http.route", "/users/{id}"),
+	), active[0].Attributes)
+
+	duration := metrics["hypertrace.http.server.duration"].Data.(metricdata.Histogram[float64]).DataPoints
+	require.Len(t, duration, 1)
+	assert.Equal(t, []float64{10, 100}, duration[0].Bounds)
+	assert.Equal(t, []uint64{0, 1, 0}, duration[0].BucketCounts)
+	status, _ := duration[0].Attributes.Value("http.status_class")
+	assert.Equal(t, "4xx", status.AsString())
+	require.Len(t, duration[0].Exemplars, 1)
+	assert.Equal(t, traceID[:], duration[0].Exemplars[0].TraceID)
+
+	responseSize := metrics["hypertrace.http.server.response.body.size"].Data.(metricdata.Histogram[int64]).DataPoints
+	require.Len(t, responseSize, 1)
+	assert.Equal(t, []float64{64, 1024}, responseSize[0].Bounds)
+	assert.Equal(t, int64(100), responseSize[0].Sum)
+}
+
+func TestDefaultMetricsOptions(t *testing.T) {
+	SetDefaultMetricsOptions(WithDurationBuckets(1, 2), WithSizeBuckets(8))
+	defer SetDefaultMetricsOptions()
+
+	o := newMetricsOptions([]MetricsOption{WithSizeBuckets(16)})
+	assert.Equal(t, []float64{1, 2}, o.durationBuckets)
+	assert.Equal(t, []float64{16}, o.sizeBuckets)
+}
+
+func TestHttpClientMetricsHandler(t *testing.T) {
+	reader := initMeterProvider(t)
+
+	mh := NewHttpClientMetricsHandler(WithMaxServerAddresses(1))
+
+	req := httptest.NewRequest(http.MethodGet, "http://API.example.com:8080/users/1", nil)
+	mh.RecordHttpClientOperation(req, sdk.HttpClientOperation{StatusCode: http.StatusServiceUnavailable, Duration: time.Millisecond})
+	mh.RecordHttpClientResponseSize(req, http.StatusServiceUnavailable, 42)
+
+	// the second server exceeds the limit of addresses
+	req = httptest.NewRequest("PURGE", "http://other.example.com/users/2", nil)
+	mh.RecordHttpClientOperation(req, sdk.HttpClientOperation{Err: context.DeadlineExceeded})
+
+	metrics := collectMetrics(t, reader)
+
+	count := metrics["hypertrace.http.client.request_count"].Data.(metricdata.Sum[int64]).DataPoints
+	require.Len(t, count, 2)
+	sets := []attribute.Set{count[0].Attributes, count[1].Attributes}
+	assert.Contains(t, sets, attribute.NewSet(
+		attribute.String("server.address", "api.example.com"),
+		attribute.String("http.method", "GET"),
+		attribute.String("http.status_class", "5xx"),
+	))
+	assert.Contains(t, sets, attribute.NewSet(
+		attribute.String("server.address", "_OTHER"),
+		attribute.String("http.method", "_OTHER"),
+		attribute.String("http.status_class", "unknown"),
+	))
+
+	errorTypes := map[string]int64{}
+	for _, dp := range metrics["hypertrace.http.client.errors"].Data.(metricdata.Sum[int64]).DataPoints {
+		errorType, _ := dp.Attributes.Value("error.type")
+		errorTypes[errorType.AsString()] = dp.Value
+	}
+	assert.Equal(t, map[string]int64{"5xx": 1, "timeout": 1}, errorTypes)
+
+	responseSize := metrics["hypertrace.http.client.response.body.size"].Data.(metricdata.Histogram[int64]).DataPoints
+	require.Len(t, responseSize, 1)
+	assert.Equal(t, int64(42), responseSize[0].Sum)
+}
+
+func TestStatusClass(t *testing.T) {
+	assert.Equal(t, "2xx", statusClass(204))
+	assert.Equal(t, "5xx", statusClass(503))
+	assert.Equal(t, "unknown", statusClass(0))
+}
+
+func TestRpcOperationMetricsHandler(t *testing.T) {
+	reader := initMeterProvider(t)
+
+	mh := NewRpcOperationMetricsHandler()
+	mh.RecordRpcOperation(context.Background(), sdk.RpcOperation{
+		FullMethod:   "/helloworld.Greeter/SayHello",
+		StatusCode:   5,
+		Duration:     1500 * time.Microsecond,
+		RequestSize:  6,
+		ResponseSize: 12,
+	})
+	mh.RecordRpcOperation(context.Background(), sdk.RpcOperation{
+		FullMethod: "/helloworld.Greeter/SayHello",
+		IsClient:   true,
+	})
+
+	metrics := collectMetrics(t, reader)
+	assert.Len(t, metrics, 8)
+
+	count := metrics["hypertrace.rpc.server.request_count"].Data.(metricdata.Sum[int64]).DataPoints
+	require.Len(t, count, 1)
+	assert.Equal(t, int64(1), count[0].Value)
+	assert.Equal(t, attribute.NewSet(
+		attribute.String("rpc.system", "grpc"),
+		attribute.String("rpc.service", "helloworld.Greeter"),
+		attribute.String("rpc.method", "SayHello"),
+		attribute.Int("rpc.grpc.status_code", 5),
+	), count[0].Attributes)
+
+	duration := metrics["hypertrace.rpc.server.duration"].Data.(metricdata.Histogram[float64]).DataPoints
+	require.Len(t, duration, 1)
+	assert.Equal(t, 1.5, duration[0].Sum)
+
+	requestSize := metrics["hypertrace.rpc.server.request.size"].Data.(metricdata.Histogram[int64]).DataPoints
+	require.Len(t, requestSize, 1)
+	assert.Equal(t, int64(6), requestSize[0].Sum)
+
+	responseSize := metrics["hypertrace.rpc.server.response.size"].Data.(metricdata.Histogram[int64]).DataPoints
+	require.Len(t, responseSize, 1)
+	assert.Equal(t, int64(12), responseSize[0].Sum)
+
+	clientCount := metrics["hypertrace.rpc.client.request_count"].Data.(metricdata.Sum[int64]).DataPoints
+	require.Len(t, clientCount, 1)
+	assert.Equal(t, int64(1), clientCount[0].Value)
+}
+
+func TestParseFullMethod(t *testing.T) {
+	service, method := parseFullMethod("/helloworld.Greeter/SayHello")
+	assert.Equal(t, "helloworld.Greeter", service)
+	assert.Equal(t, "SayHello", method)
+
+	service, method = parseFullMethod("malformed")
+	assert.Equal(t, "malformed", service)
+	assert.Equal(t, "", method)
+}
@@ -0,0 +1,21 @@
+package hyperhttp // import "github.com/hypertrace/goagent/instrumentation/opentelemetry/net/hyperhttp"
+
+import (
+	"net/http"
+
+	"github.com/hypertrace/goagent/sdk/exclusion"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// ExclusionFilter returns an otelhttp filter skipping the span creation for the requests
+// matching a rule with the exclusion.SkipSpan action. routeTemplateGetter can be nil when
+// the route template is not known.
+func ExclusionFilter(rules exclusion.Rules, routeTemplateGetter func(*http.Request) string) otelhttp.Filter {
+	return func(r *http.Request) bool {
+		route := ""
+		if routeTemplateGetter != nil {
+			route = routeTemplateGetter(r)
+		}
+		return !rules.SkipsSpan(exclusion.HTTPRequest(r, route))
+	}
+}
@@ -10,6 +10,10 @@ import (
 // WrapHandler returns a new round tripper instrumented that relies on the
 // needs to be used with OTel instrumentation.
 func WrapHandler(delegate http.Handler, options *sdkhttp.Options) http.Handler {
-	mh := opentelemetry.NewHttpOperationMetricsHandler(func(_ *http.Request) string { return "" })
+	routeTemplateGetter := func(_ *http.Request) string { return "" }
+	if options != nil && options.RouteTemplateGetter != nil {
+		routeTemplateGetter = options.RouteTemplateGetter
+	}
+	mh := opentelemetry.NewHttpOperationMetricsHandler(routeTemplateGetter)
 	return sdkhttp.WrapHandler(delegate, opentelemetry.SpanFromContext, options, map[string]string{}, mh)
 }
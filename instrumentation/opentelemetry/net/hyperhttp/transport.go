@@ -11,5 +11,11 @@ import (
 // and returns an instrumented RoundTripper that has to be used as base for the
 // OTel's RoundTripper.
 func WrapTransport(delegate http.RoundTripper) http.RoundTripper {
-	return sdkhttp.WrapTransport(delegate, opentelemetry.SpanFromContext, map[string]string{})
+	return WrapTransportWithOptions(delegate, nil)
+}
+
+// WrapTransportWithOptions works like WrapTransport but evaluates the filter of the
+// options on the outgoing requests.
+func WrapTransportWithOptions(delegate http.RoundTripper, options *sdkhttp.Options) http.RoundTripper {
+	return sdkhttp.WrapTransport(delegate, opentelemetry.SpanFromContext, options, map[string]string{}, opentelemetry.NewHttpClientMetricsHandler())
 }
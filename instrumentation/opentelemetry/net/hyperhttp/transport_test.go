@@ -14,6 +14,7 @@ import (
 	config "github.com/hypertrace/agent-config/gen/go/v1"
 	"github.com/hypertrace/goagent/instrumentation/opentelemetry/internal/tracetesting"
 	sdkconfig "github.com/hypertrace/goagent/sdk/config"
+	sdkhttp "github.com/hypertrace/goagent/sdk/instrumentation/net/http"
 	"go.opentelemetry.io/otel/propagation"
 
 	"github.com/stretchr/testify/assert"
@@ -52,7 +53,7 @@ func TestClientRequestIsSuccessfullyTraced(t *testing.T) {
 
 	client := &http.Client{
 		Transport: otelhttp.NewTransport(
-			WrapTransport(http.DefaultTransport),
+			WrapTransportWithOptions(http.DefaultTransport, &sdkhttp.Options{}),
 		),
 	}
 
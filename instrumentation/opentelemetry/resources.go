@@ -0,0 +1,152 @@
+package opentelemetry // import "github.com/hypertrace/goagent/instrumentation/opentelemetry"
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	internalconfig "github.com/hypertrace/goagent/internal/config"
+	"github.com/hypertrace/goagent/sdk/container"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+)
+
+// ResourceDetectorsEnv is the environment variable listing the comma separated resource
+// detectors run to populate the trace and metric resources, "none" disabling all of them.
+// All the detectors run when it is not set.
+const ResourceDetectorsEnv = "HT_RESOURCE_DETECTORS"
+
+var (
+	// podInfoDir is where the downward API volume exposing the pod fields is expected to be
+	// mounted, with the name, namespace and nodename files.
+	podInfoDir = "/etc/podinfo"
+
+	serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// resourceDetector returns the resource attributes it detects.
+type resourceDetector func() []attribute.KeyValue
+
+var resourceDetectors = map[string]resourceDetector{
+	"k8s":       detectK8s,
+	"host":      detectHost,
+	"os":        detectOS,
+	"process":   detectProcess,
+	"container": detectContainer,
+	"aws":       awsDetector.attributes,
+	"gcp":       gcpDetector.attributes,
+	"azure":     azureDetector.attributes,
+}
+
+// defaultResourceDetectors don't include the cloud ones as they query the network.
+var defaultResourceDetectors = []string{"k8s", "host", "os", "process", "container"}
+
+// enabledResourceDetectors returns the names of the detectors enabled by ResourceDetectorsEnv.
+func enabledResourceDetectors() []string {
+	var names []string
+	for _, name := range internalconfig.ListEnv(ResourceDetectorsEnv, defaultResourceDetectors) {
+		name = strings.ToLower(name)
+		switch {
+		case name == "none":
+		case resourceDetectors[name] == nil:
+			log.Printf("unknown resource detector %q in %s\n", name, ResourceDetectorsEnv)
+		default:
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// detectResources returns the attributes found by the enabled resource detectors.
+func detectResources() []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	for _, name := range enabledResourceDetectors() {
+		attrs = append(attrs, resourceDetectors[name]()...)
+	}
+	return attrs
+}
+
+// detectK8s reads the pod fields from the environment variables and files usually
+// populated through the downward API, e.g.
+//
+//	env:
+//	  - name: K8S_POD_NAME
+//	    valueFrom:
+//	      fieldRef:
+//	        fieldPath: metadata.name
+func detectK8s() []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	if podName := firstNonEmpty(
+		os.Getenv("K8S_POD_NAME"),
+		os.Getenv("POD_NAME"),
+		readTrimmedFile(filepath.Join(podInfoDir, "name")),
+	); podName != "" {
+		attrs = append(attrs, semconv.K8SPodNameKey.String(podName))
+	}
+	if namespace := firstNonEmpty(
+		os.Getenv("K8S_NAMESPACE_NAME"),
+		os.Getenv("POD_NAMESPACE"),
+		readTrimmedFile(filepath.Join(podInfoDir, "namespace")),
+		readTrimmedFile(serviceAccountNamespaceFile),
+	); namespace != "" {
+		attrs = append(attrs, semconv.K8SNamespaceNameKey.String(namespace))
+	}
+	if nodeName := firstNonEmpty(
+		os.Getenv("K8S_NODE_NAME"),
+		os.Getenv("NODE_NAME"),
+		readTrimmedFile(filepath.Join(podInfoDir, "nodename")),
+	); nodeName != "" {
+		attrs = append(attrs, semconv.K8SNodeNameKey.String(nodeName))
+	}
+	return attrs
+}
+
+func detectHost() []attribute.KeyValue {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		return nil
+	}
+	return []attribute.KeyValue{semconv.HostNameKey.String(hostname)}
+}
+
+func detectOS() []attribute.KeyValue {
+	return []attribute.KeyValue{semconv.OSTypeKey.String(runtime.GOOS)}
+}
+
+func detectProcess() []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		semconv.ProcessPIDKey.Int(os.Getpid()),
+		semconv.ProcessRuntimeVersionKey.String(runtime.Version()),
+	}
+	if executable, err := os.Executable(); err == nil {
+		attrs = append(attrs, semconv.ProcessExecutableNameKey.String(filepath.Base(executable)))
+	}
+	return attrs
+}
+
+func detectContainer() []attribute.KeyValue {
+	containerID, err := container.GetID()
+	if err != nil {
+		return nil
+	}
+	return []attribute.KeyValue{semconv.ContainerIDKey.String(containerID)}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func readTrimmedFile(path string) string {
+	content, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
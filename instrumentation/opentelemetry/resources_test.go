@@ -0,0 +1,76 @@
+package opentelemetry
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry/identifier"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func attributesMap(attrs []attribute.KeyValue) map[string]interface{} {
+	m := map[string]interface{}{}
+	for _, attr := range attrs {
+		m[string(attr.Key)] = attr.Value.AsInterface()
+	}
+	return m
+}
+
+func TestEnabledResourceDetectors(t *testing.T) {
+	// restored once the test is done
+	t.Setenv(ResourceDetectorsEnv, "")
+	os.Unsetenv(ResourceDetectorsEnv)
+	assert.Equal(t, defaultResourceDetectors, enabledResourceDetectors())
+
+	t.Setenv(ResourceDetectorsEnv, " host, OS ,unknown")
+	assert.Equal(t, []string{"host", "os"}, enabledResourceDetectors())
+
+	t.Setenv(ResourceDetectorsEnv, "none")
+	assert.Empty(t, enabledResourceDetectors())
+}
+
+func TestDetectK8s(t *testing.T) {
+	dir := t.TempDir()
+	defer func(original string) { podInfoDir = original }(podInfoDir)
+	podInfoDir = dir
+	defer func(original string) { serviceAccountNamespaceFile = original }(serviceAccountNamespaceFile)
+	serviceAccountNamespaceFile = filepath.Join(dir, "serviceaccount-namespace")
+
+	assert.Empty(t, detectK8s())
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "name"), []byte("checkout-5d8f7\n"), 0600))
+	require.NoError(t, os.WriteFile(serviceAccountNamespaceFile, []byte("shop"), 0600))
+	t.Setenv("K8S_NODE_NAME", "node-1")
+
+	assert.Equal(t, map[string]interface{}{
+		"k8s.pod.name":       "checkout-5d8f7",
+		"k8s.namespace.name": "shop",
+		"k8s.node.name":      "node-1",
+	}, attributesMap(detectK8s()))
+
+	// the environment takes precedence over the files
+	t.Setenv("K8S_POD_NAME", "checkout-abcde")
+	assert.Equal(t, "checkout-abcde", attributesMap(detectK8s())["k8s.pod.name"])
+}
+
+func TestCreateResourcesMergesDetectedAttributes(t *testing.T) {
+	t.Setenv(ResourceDetectorsEnv, "os,process")
+
+	attrs := attributesMap(createResources(map[string]string{"os.type": "custom"}, versionInfoAttributes))
+	assert.Equal(t, runtime.Version(), attrs["process.runtime.version"])
+	assert.Equal(t, int64(os.Getpid()), attrs["process.pid"])
+	assert.NotEmpty(t, attrs["process.executable.name"])
+	// configured attributes take precedence
+	assert.Equal(t, "custom", attrs["os.type"])
+	assert.Equal(t, "hypertrace", attrs["telemetry.sdk.name"])
+	assert.Equal(t, identifier.ServiceInstanceKeyValue().Value.AsString(), attrs["service.instance.id"])
+
+	t.Setenv(ResourceDetectorsEnv, "none")
+	attrs = attributesMap(createResources(nil, versionInfoAttributes))
+	assert.NotContains(t, attrs, "process.pid")
+	assert.NotContains(t, attrs, "os.type")
+}
@@ -92,8 +92,13 @@ func (s *Span) SetAttribute(key string, value interface{}) {
 	s.Span.SetAttributes(generateAttribute(key, value))
 }
 
-func (s *Span) SetError(err error) {
-	s.Span.RecordError(err)
+func (s *Span) SetError(err error, opts ...sdk.ErrorOption) {
+	if err == nil || !s.Span.IsRecording() {
+		return
+	}
+
+	attrs := sdk.ErrorAttributes(err, sdk.NewErrorOptions(opts...))
+	s.AddEvent("exception", time.Now(), attrs)
 }
 
 func (s *Span) SetStatus(code sdk.Code, description string) {
@@ -134,7 +139,9 @@ func startSpan(provider getTracerProvider) sdk.StartSpan {
 				startOpts = append(startOpts, trace.WithTimestamp(opts.Timestamp))
 			}
 		}
-		startOpts = append(startOpts, trace.WithAttributes(identifier.ServiceInstanceKeyValue))
+		if identifier.SpanAttributeEnabled() {
+			startOpts = append(startOpts, trace.WithAttributes(identifier.ServiceInstanceKeyValue()))
+		}
 
 		ctx, span := provider().
 			Tracer(TracerDomain, trace.WithInstrumentationVersion(version.Version)).
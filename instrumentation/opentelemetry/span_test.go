@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/hypertrace/goagent/config"
+	"github.com/hypertrace/goagent/instrumentation/opentelemetry/identifier"
 	"github.com/hypertrace/goagent/sdk"
 	"github.com/stretchr/testify/assert"
 	"go.opentelemetry.io/otel"
@@ -51,6 +52,9 @@ func TestSetAttributeSuccess(t *testing.T) {
 }
 
 func TestSpanHasSameServiceInstanceId(t *testing.T) {
+	identifier.SetSpanAttributeEnabled(true)
+	defer identifier.SetSpanAttributeEnabled(false)
+
 	_, original, _ := StartSpan(context.Background(), "test_span", &sdk.SpanOptions{})
 	firstId := original.GetAttributes().GetValue("service.instance.id")
 	for i := 0; i < 300; i++ {
@@ -60,6 +64,11 @@ func TestSpanHasSameServiceInstanceId(t *testing.T) {
 	}
 }
 
+func TestSpanHasNoServiceInstanceIdByDefault(t *testing.T) {
+	_, s, _ := StartSpan(context.Background(), "test_span", &sdk.SpanOptions{})
+	assert.Nil(t, s.GetAttributes().GetValue("service.instance.id"))
+}
+
 func TestGenerateAttribute(t *testing.T) {
 	assert.Equal(t, attribute.BOOL, generateAttribute("key", true).Value.Type())
 	assert.Equal(t, attribute.BOOLSLICE, generateAttribute("key", []bool{true}).Value.Type())
@@ -131,8 +140,8 @@ func TestIterate(t *testing.T) {
 		numAttrs++
 		return true
 	})
-	// service.instance.id is added implicitly in StartSpan so 3 attributes will be present.
-	assert.Equal(t, 3, numAttrs)
+	// service.instance.id is on the resource, not on the span.
+	assert.Equal(t, 2, numAttrs)
 }
 
 func TestLen(t *testing.T) {
@@ -145,8 +154,8 @@ func TestLen(t *testing.T) {
 	s.SetAttribute("k1", "v1")
 	s.SetAttribute("k2", 200)
 
-	// service.instance.id is added implicitly in StartSpan so 3 attributes will be present.
-	assert.Equal(t, 3, s.GetAttributes().Len())
+	// service.instance.id is on the resource, not on the span.
+	assert.Equal(t, 2, s.GetAttributes().Len())
 }
 
 func TestGetSpanID(t *testing.T) {
@@ -154,3 +163,37 @@ func TestGetSpanID(t *testing.T) {
 	spanId := s.GetSpanId()
 	assert.NotEqual(t, 0, len(spanId))
 }
+
+type queryError struct {
+	query string
+}
+
+func (e *queryError) Error() string {
+	return "invalid query " + e.query
+}
+
+func TestSetErrorRecordsExceptionEvent(t *testing.T) {
+	_, otelSpan := sdktrace.NewTracerProvider().Tracer("test").Start(context.Background(), "test_span")
+	s := &Span{otelSpan}
+
+	err := fmt.Errorf("listing users: %w", errors.Join(&queryError{query: "SELEC"}, context.Canceled))
+	s.SetError(err, sdk.WithStackTrace(true))
+
+	events := otelSpan.(sdktrace.ReadOnlySpan).Events()
+	assert.Len(t, events, 1)
+	assert.Equal(t, "exception", events[0].Name)
+
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, attr := range events[0].Attributes {
+		attrs[attr.Key] = attr.Value
+	}
+	assert.Equal(t, "*fmt.wrapError", attrs["exception.type"].AsString())
+	assert.Equal(t, "listing users: invalid query SELEC\ncontext canceled", attrs["exception.message"].AsString())
+	assert.Equal(t, []string{
+		"*errors.joinError: invalid query SELEC\ncontext canceled",
+		"*opentelemetry.queryError: invalid query SELEC",
+		"*errors.errorString: context canceled",
+	}, attrs["exception.cause"].AsStringSlice())
+	assert.Contains(t, attrs["exception.stacktrace"].AsString(), "opentelemetry.TestSetErrorRecordsExceptionEvent\n")
+	assert.NotContains(t, attrs["exception.stacktrace"].AsString(), "opentelemetry.(*Span).SetError")
+}
@@ -0,0 +1,61 @@
+// Package config reads the agent settings that are not part of the agent config, like
+// the toggles of the optional features set through environment variables.
+package config // import "github.com/hypertrace/goagent/internal/config"
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BoolEnv returns the boolean value of the environment variable key or defaultValue
+// when it is not set. Invalid values are logged and defaultValue is returned.
+func BoolEnv(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("invalid value %q for %s, boolean value expected\n", value, key)
+		return defaultValue
+	}
+	return enabled
+}
+
+// ListEnv returns the comma separated values of the environment variable key, trimmed
+// and without the empty ones, or defaultValue when it is not set.
+func ListEnv(key string, defaultValue []string) []string {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return defaultValue
+	}
+
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// DurationEnv returns the duration value of the environment variable key, e.g. "300ms",
+// or defaultValue when it is not set. Invalid and non positive values are logged and
+// defaultValue is returned.
+func DurationEnv(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Printf("invalid value %q for %s, positive duration expected\n", value, key)
+		return defaultValue
+	}
+	return duration
+}
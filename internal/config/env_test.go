@@ -0,0 +1,59 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBoolEnv(t *testing.T) {
+	tCases := map[string]struct {
+		value         string
+		defaultValue  bool
+		expectedValue bool
+	}{
+		"unset":   {value: "", defaultValue: true, expectedValue: true},
+		"true":    {value: "true", defaultValue: false, expectedValue: true},
+		"false":   {value: "0", defaultValue: true, expectedValue: false},
+		"invalid": {value: "yes", defaultValue: true, expectedValue: true},
+	}
+
+	for name, tCase := range tCases {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("HT_TEST_BOOL_ENV", tCase.value)
+			assert.Equal(t, tCase.expectedValue, BoolEnv("HT_TEST_BOOL_ENV", tCase.defaultValue))
+		})
+	}
+}
+
+func TestListEnv(t *testing.T) {
+	defaultValue := []string{"a"}
+
+	assert.Equal(t, defaultValue, ListEnv("HT_TEST_LIST_ENV", defaultValue))
+
+	t.Setenv("HT_TEST_LIST_ENV", " b, ,c ")
+	assert.Equal(t, []string{"b", "c"}, ListEnv("HT_TEST_LIST_ENV", defaultValue))
+
+	t.Setenv("HT_TEST_LIST_ENV", "")
+	assert.Empty(t, ListEnv("HT_TEST_LIST_ENV", defaultValue))
+}
+
+func TestDurationEnv(t *testing.T) {
+	tCases := map[string]struct {
+		value         string
+		expectedValue time.Duration
+	}{
+		"unset":    {value: "", expectedValue: time.Second},
+		"valid":    {value: "300ms", expectedValue: 300 * time.Millisecond},
+		"negative": {value: "-1s", expectedValue: time.Second},
+		"invalid":  {value: "300", expectedValue: time.Second},
+	}
+
+	for name, tCase := range tCases {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("HT_TEST_DURATION_ENV", tCase.value)
+			assert.Equal(t, tCase.expectedValue, DurationEnv("HT_TEST_DURATION_ENV", time.Second))
+		})
+	}
+}
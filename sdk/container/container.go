@@ -0,0 +1,13 @@
+package container // import "github.com/hypertrace/goagent/sdk/container"
+
+import (
+	internalcontainer "github.com/hypertrace/goagent/sdk/internal/container"
+)
+
+// ErrNotInContainerEnv is returned when GetID is called in a non container environment
+var ErrNotInContainerEnv = internalcontainer.ErrNotInContainerEnv
+
+// GetID returns the container ID when in a containerized environment.
+func GetID() (string, error) {
+	return internalcontainer.GetID()
+}
@@ -0,0 +1,137 @@
+package sdk // import "github.com/hypertrace/goagent/sdk"
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync/atomic"
+
+	"github.com/hypertrace/goagent/sdk/internal/env"
+)
+
+// ErrorStackTraceEnabledEnv turns on the capture of the stack trace of the SetError call
+// sites. It is disabled by default as walking the stack has a cost.
+const ErrorStackTraceEnabledEnv = "HT_ERROR_STACK_TRACE_ENABLED"
+
+// maxErrorCauses bounds the number of wrapped errors recorded as causes.
+const maxErrorCauses = 32
+
+var errorStackTraceEnabled atomic.Bool
+
+func init() {
+	errorStackTraceEnabled.Store(env.Bool(ErrorStackTraceEnabledEnv, false))
+}
+
+// SetErrorStackTraceEnabled turns on or off the capture of the stack traces by default in
+// SetError, WithStackTrace overriding it per call.
+func SetErrorStackTraceEnabled(enabled bool) {
+	errorStackTraceEnabled.Store(enabled)
+}
+
+// ErrorOptions configures how SetError records an error.
+type ErrorOptions struct {
+	// StackTrace records the stack trace of the SetError call site.
+	StackTrace bool
+	// CallerSkip is the number of frames skipped above the SetError call site, e.g. for
+	// helpers recording the errors on behalf of their callers.
+	CallerSkip int
+}
+
+// ErrorOption configures how SetError records an error.
+type ErrorOption func(o *ErrorOptions)
+
+// WithStackTrace captures the stack trace or not regardless of the default.
+func WithStackTrace(enabled bool) ErrorOption {
+	return func(o *ErrorOptions) {
+		o.StackTrace = enabled
+	}
+}
+
+// WithCallerSkip skips the given number of frames of the stack trace.
+func WithCallerSkip(skip int) ErrorOption {
+	return func(o *ErrorOptions) {
+		o.CallerSkip = skip
+	}
+}
+
+// NewErrorOptions returns the SetError options, the stack trace being captured
+// as set by SetErrorStackTraceEnabled unless opts say otherwise.
+func NewErrorOptions(opts ...ErrorOption) ErrorOptions {
+	o := ErrorOptions{StackTrace: errorStackTraceEnabled.Load()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// ErrorAttributes returns the attributes of the exception event describing err:
+// exception.type with the concrete type name, exception.message, exception.cause with
+// an entry per error wrapped with %w or errors.Join, and exception.stacktrace. It has to
+// be called by the SetError implementations themselves for the stack trace to start at
+// the SetError call site.
+func ErrorAttributes(err error, o ErrorOptions) map[string]interface{} {
+	attrs := map[string]interface{}{
+		"exception.type":    fmt.Sprintf("%T", err),
+		"exception.message": err.Error(),
+	}
+
+	if causes := errorCauses(err); len(causes) > 0 {
+		attrs["exception.cause"] = causes
+	}
+
+	if o.StackTrace {
+		// skips runtime.Callers, stackTrace, ErrorAttributes and SetError
+		attrs["exception.stacktrace"] = stackTrace(4 + o.CallerSkip)
+	}
+
+	return attrs
+}
+
+// errorCauses walks the tree of the wrapped errors depth first and returns an entry per
+// error formatted as "<type>: <message>".
+func errorCauses(err error) []string {
+	var causes []string
+	var walk func(err error)
+	walk = func(err error) {
+		var wrapped []error
+		switch e := err.(type) { // nolint:errorlint
+		case interface{ Unwrap() error }:
+			if cause := e.Unwrap(); cause != nil {
+				wrapped = []error{cause}
+			}
+		case interface{ Unwrap() []error }:
+			wrapped = e.Unwrap()
+		}
+
+		for _, cause := range wrapped {
+			if cause == nil {
+				continue
+			}
+			if len(causes) == maxErrorCauses {
+				return
+			}
+			causes = append(causes, fmt.Sprintf("%T: %s", cause, cause.Error()))
+			walk(cause)
+		}
+	}
+	walk(err)
+	return causes
+}
+
+// stackTrace formats the stack of the current goroutine starting skip frames above,
+// as in the panic traces.
+func stackTrace(skip int) string {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var sb strings.Builder
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&sb, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return sb.String()
+}
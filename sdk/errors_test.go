@@ -0,0 +1,36 @@
+package sdk
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewErrorOptions(t *testing.T) {
+	defer SetErrorStackTraceEnabled(false)
+
+	assert.Equal(t, ErrorOptions{}, NewErrorOptions())
+	assert.Equal(t, ErrorOptions{StackTrace: true, CallerSkip: 2}, NewErrorOptions(WithStackTrace(true), WithCallerSkip(2)))
+
+	SetErrorStackTraceEnabled(true)
+	assert.Equal(t, ErrorOptions{StackTrace: true}, NewErrorOptions())
+	assert.Equal(t, ErrorOptions{}, NewErrorOptions(WithStackTrace(false)))
+}
+
+func TestErrorAttributesWithoutStackTrace(t *testing.T) {
+	attrs := ErrorAttributes(errors.New("boom"), ErrorOptions{})
+	assert.Equal(t, map[string]interface{}{
+		"exception.type":    "*errors.errorString",
+		"exception.message": "boom",
+	}, attrs)
+}
+
+func TestErrorCausesAreBounded(t *testing.T) {
+	err := errors.New("root")
+	for i := 0; i < 2*maxErrorCauses; i++ {
+		err = fmt.Errorf("level %d: %w", i, err)
+	}
+	assert.Len(t, errorCauses(err), maxErrorCauses)
+}
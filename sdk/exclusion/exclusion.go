@@ -0,0 +1,127 @@
+package exclusion // import "github.com/hypertrace/goagent/sdk/exclusion"
+
+import (
+	"net/http"
+)
+
+// Action tells what is skipped for the requests matching a rule.
+type Action int
+
+const (
+	// SkipDataCapture keeps the span but does not capture the headers, metadata and
+	// bodies. The filters are still evaluated. It is the default action.
+	SkipDataCapture Action = iota
+	// SkipSpan does not record a span for the request. It requires the span to be
+	// created by an instrumentation supporting it, otherwise it falls back to
+	// SkipDataCapture.
+	SkipSpan
+)
+
+// Rule excludes the requests matching all its non-empty conditions. Conditions are globs
+// where `*` matches any sequence of characters, including `/`, and `?` matches a
+// single character. A rule without conditions matches no request.
+type Rule struct {
+	// FullMethod matches the full name of gRPC methods, e.g. "/grpc.health.v1.Health/*".
+	FullMethod string
+	// Path matches the URL path of HTTP requests, e.g. "/healthz".
+	Path string
+	// Route matches the route template of HTTP requests, e.g. "/internal/*".
+	Route string
+	// UserAgent matches the user agent, e.g. "kube-probe/*". As the user agent is set by
+	// the client, it should not be the only condition of SkipSpan rules.
+	UserAgent string
+	// Action defaults to SkipDataCapture.
+	Action Action
+}
+
+// Request is the view of a request matched against the rules, the attributes that
+// don't apply to the protocol of the request are empty.
+type Request struct {
+	FullMethod string
+	Path       string
+	Route      string
+	UserAgent  string
+}
+
+// HTTPRequest returns the view of an HTTP request, route being its route template if known.
+func HTTPRequest(r *http.Request, route string) Request {
+	req := Request{Route: route, UserAgent: r.UserAgent()}
+	if r.URL != nil {
+		req.Path = r.URL.Path
+	}
+	return req
+}
+
+// Rules is a list of exclusion rules, the first rule matching a request applies.
+type Rules []Rule
+
+// Match returns the action of the first rule matching the request.
+func (rs Rules) Match(req Request) (Action, bool) {
+	for _, r := range rs {
+		if r.matches(req) {
+			return r.Action, true
+		}
+	}
+	return SkipDataCapture, false
+}
+
+// SkipsSpan tells whether the span of the request should not be created.
+func (rs Rules) SkipsSpan(req Request) bool {
+	action, ok := rs.Match(req)
+	return ok && action == SkipSpan
+}
+
+func (r Rule) matches(req Request) bool {
+	if r.FullMethod == "" && r.Path == "" && r.Route == "" && r.UserAgent == "" {
+		return false
+	}
+
+	return matchCondition(r.FullMethod, req.FullMethod) &&
+		matchCondition(r.Path, req.Path) &&
+		matchCondition(r.Route, req.Route) &&
+		matchCondition(r.UserAgent, req.UserAgent)
+}
+
+func matchCondition(pattern, value string) bool {
+	return pattern == "" || matchGlob(pattern, value)
+}
+
+// matchGlob matches a value against a glob pattern supporting `*` and `?`.
+func matchGlob(pattern, value string) bool {
+	p, v := 0, 0
+	// position of the last star in the pattern and of the value when it was found,
+	// used to backtrack when the rest of the pattern does not match.
+	star, starValue := -1, 0
+	for v < len(value) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == value[v]):
+			p++
+			v++
+		case p < len(pattern) && pattern[p] == '*':
+			star, starValue = p, v
+			p++
+		case star >= 0:
+			starValue++
+			p, v = star+1, starValue
+		default:
+			return false
+		}
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// DefaultRules returns rules excluding the gRPC health checks and reflection calls
+// and the usual HTTP health probes.
+func DefaultRules(action Action) Rules {
+	return Rules{
+		{FullMethod: "/grpc.health.v1.Health/*", Action: action},
+		{FullMethod: "/grpc.reflection.*", Action: action},
+		{Path: "/healthz", Action: action},
+		{Path: "/livez", Action: action},
+		{Path: "/readyz", Action: action},
+	}
+}
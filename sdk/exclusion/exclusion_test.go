@@ -0,0 +1,81 @@
+package exclusion
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tCases := []struct {
+		pattern string
+		value   string
+		matches bool
+	}{
+		{"/healthz", "/healthz", true},
+		{"/healthz", "/healthz/live", false},
+		{"/grpc.reflection.*", "/grpc.reflection.v1.ServerReflection/ServerReflectionInfo", true},
+		{"/grpc.health.v1.Health/*", "/grpc.health.v1.Health/Check", true},
+		{"/grpc.health.v1.Health/*", "/helloworld.Greeter/SayHello", false},
+		{"kube-probe/*", "kube-probe/1.29", true},
+		{"*probe*", "kube-probe/1.29", true},
+		{"/users/?", "/users/1", true},
+		{"/users/?", "/users/12", false},
+		{"*", "", true},
+		{"a*b*c", "aXbYbZc", true},
+		{"a*b*c", "aXbYbZ", false},
+	}
+
+	for _, tCase := range tCases {
+		assert.Equal(t, tCase.matches, matchGlob(tCase.pattern, tCase.value), "pattern %q, value %q", tCase.pattern, tCase.value)
+	}
+}
+
+func TestRulesMatch(t *testing.T) {
+	rules := Rules{
+		{Path: "/internal/*", UserAgent: "kube-probe/*", Action: SkipSpan},
+		{Route: "/internal/*", Action: SkipDataCapture},
+		{},
+	}
+
+	action, ok := rules.Match(Request{Path: "/internal/status", Route: "/internal/*", UserAgent: "kube-probe/1.29"})
+	assert.True(t, ok)
+	assert.Equal(t, SkipSpan, action)
+
+	// all the conditions of a rule need to match
+	action, ok = rules.Match(Request{Path: "/internal/status", Route: "/internal/*", UserAgent: "curl/8.0"})
+	assert.True(t, ok)
+	assert.Equal(t, SkipDataCapture, action)
+
+	// rules without conditions match nothing
+	_, ok = rules.Match(Request{Path: "/users"})
+	assert.False(t, ok)
+
+	assert.True(t, rules.SkipsSpan(Request{Path: "/internal/status", UserAgent: "kube-probe/1.29"}))
+	assert.False(t, rules.SkipsSpan(Request{Route: "/internal/*"}))
+}
+
+func TestRulesDefaultToSkipDataCapture(t *testing.T) {
+	action, ok := Rules{{Path: "/healthz"}}.Match(Request{Path: "/healthz"})
+	assert.True(t, ok)
+	assert.Equal(t, SkipDataCapture, action)
+	assert.False(t, Rules{{Path: "/healthz"}}.SkipsSpan(Request{Path: "/healthz"}))
+}
+
+func TestDefaultRules(t *testing.T) {
+	rules := DefaultRules(SkipSpan)
+	assert.True(t, rules.SkipsSpan(Request{FullMethod: "/grpc.health.v1.Health/Watch"}))
+	assert.True(t, rules.SkipsSpan(Request{FullMethod: "/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo"}))
+	assert.True(t, rules.SkipsSpan(Request{Path: "/healthz"}))
+	assert.False(t, rules.SkipsSpan(Request{FullMethod: "/helloworld.Greeter/SayHello"}))
+	assert.False(t, rules.SkipsSpan(Request{Path: "/users"}))
+}
+
+func TestHTTPRequest(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "http://localhost/users/1?q=1", nil)
+	r.Header.Set("User-Agent", "kube-probe/1.29")
+
+	assert.Equal(t, Request{Path: "/users/1", Route: "/users/{id}", UserAgent: "kube-probe/1.29"}, HTTPRequest(r, "/users/{id}"))
+}
@@ -0,0 +1,114 @@
+package filter // import "github.com/hypertrace/goagent/sdk/filter"
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/filter/result"
+)
+
+// ContextFilter is an optional interface for filters that need access to the request
+// context (e.g. to honor its deadline) or to request data the agent did not capture
+// in the span. Instrumentations prefer EvaluateWithContext over Evaluate when the
+// filter implements it.
+type ContextFilter interface {
+	Filter
+	// EvaluateWithContext evaluates the request using its context and a protocol
+	// neutral view of it.
+	EvaluateWithContext(ctx context.Context, span sdk.Span, req *Request) result.FilterResult
+}
+
+// HeaderAccessor allows reading the request headers (or metadata in gRPC) regardless
+// of the underlying data structure.
+type HeaderAccessor interface {
+	Lookup(key string) []string
+	ForEachHeader(callback func(key string, values []string) error) error
+}
+
+// Request is a protocol neutral view of the request being evaluated.
+type Request struct {
+	// Method is the HTTP method or the gRPC full method name (e.g. /helloworld.Greeter/SayHello)
+	Method string
+	// Route is the route template (e.g. /users/{id}) or the gRPC full method name.
+	// It is empty when the instrumentation does not know the route.
+	Route string
+	// Peer is the address of the remote peer
+	Peer string
+	// Headers gives access to the request headers or metadata
+	Headers HeaderAccessor
+
+	bodyReader func() ([]byte, error)
+	mu         sync.Mutex
+	bodyRead   bool
+	evaluated  bool
+	body       []byte
+	bodyErr    error
+}
+
+// ErrRequestEvaluated is returned by Request.Body when the body was not read before
+// the evaluation returned, e.g. by a filter still running after its deadline, as the
+// instrumented handler may be consuming it by then.
+var ErrRequestEvaluated = errors.New("request body is not available once the evaluation returned")
+
+// NewRequest creates a request view. bodyReader is invoked at most once and only
+// when a filter asks for the body.
+func NewRequest(method, route, peer string, headers HeaderAccessor, bodyReader func() ([]byte, error)) *Request {
+	return &Request{
+		Method:     method,
+		Route:      route,
+		Peer:       peer,
+		Headers:    headers,
+		bodyReader: bodyReader,
+	}
+}
+
+// Body returns the request body, reading it on first use. The body is read even
+// if the body capture is disabled but it might be truncated to the max processing
+// size. It returns ErrRequestEvaluated when the body is first asked for after
+// EvaluateRequest returned.
+func (r *Request) Body() ([]byte, error) {
+	if r == nil || r.bodyReader == nil {
+		return nil, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.bodyRead {
+		if r.evaluated {
+			return nil, ErrRequestEvaluated
+		}
+		r.body, r.bodyErr = r.bodyReader()
+		r.bodyRead = true
+	}
+	return r.body, r.bodyErr
+}
+
+// markEvaluated makes the body unavailable to the filters still running, waiting for
+// a read in progress to complete.
+func (r *Request) markEvaluated() {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	r.evaluated = true
+	r.mu.Unlock()
+}
+
+// EvaluateRequest evaluates the request using EvaluateWithContext when the filter
+// implements ContextFilter and falls back to Evaluate otherwise. Once it returns, the
+// request body can no longer be read by the filters.
+func EvaluateRequest(ctx context.Context, f Filter, span sdk.Span, req *Request) result.FilterResult {
+	defer req.markEvaluated()
+	return evaluateRequest(ctx, f, span, req)
+}
+
+func evaluateRequest(ctx context.Context, f Filter, span sdk.Span, req *Request) result.FilterResult {
+	if cf, ok := f.(ContextFilter); ok {
+		return cf.EvaluateWithContext(ctx, span, req)
+	}
+	return f.Evaluate(span)
+}
@@ -0,0 +1,105 @@
+package filter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/filter/result"
+	"github.com/hypertrace/goagent/sdk/internal/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+type contextFilter struct {
+	mock.Filter
+	evaluator func(ctx context.Context, span sdk.Span, req *Request) result.FilterResult
+}
+
+func (f contextFilter) EvaluateWithContext(ctx context.Context, span sdk.Span, req *Request) result.FilterResult {
+	return f.evaluator(ctx, span, req)
+}
+
+func TestEvaluateRequestPrefersContextFilter(t *testing.T) {
+	f := contextFilter{
+		Filter: mock.Filter{
+			Evaluator: func(span sdk.Span) result.FilterResult {
+				assert.Fail(t, "should not be called")
+				return result.FilterResult{}
+			},
+		},
+		evaluator: func(ctx context.Context, span sdk.Span, req *Request) result.FilterResult {
+			assert.Equal(t, "GET", req.Method)
+			assert.Equal(t, "/users/{id}", req.Route)
+			return result.FilterResult{Block: true, ResponseStatusCode: 401}
+		},
+	}
+
+	res := EvaluateRequest(context.Background(), f, nil, NewRequest("GET", "/users/{id}", "", nil, nil))
+	assert.True(t, res.Block)
+	assert.Equal(t, int32(401), res.ResponseStatusCode)
+}
+
+func TestEvaluateRequestFallsBackToFilter(t *testing.T) {
+	f := mock.Filter{
+		Evaluator: func(span sdk.Span) result.FilterResult {
+			return result.FilterResult{Block: true, ResponseStatusCode: 403}
+		},
+	}
+
+	res := EvaluateRequest(context.Background(), f, nil, NewRequest("GET", "", "", nil, nil))
+	assert.True(t, res.Block)
+}
+
+func TestRequestBodyIsReadOnce(t *testing.T) {
+	reads := 0
+	req := NewRequest("POST", "", "", nil, func() ([]byte, error) {
+		reads++
+		return []byte("body"), nil
+	})
+
+	for i := 0; i < 2; i++ {
+		body, err := req.Body()
+		assert.NoError(t, err)
+		assert.Equal(t, "body", string(body))
+	}
+	assert.Equal(t, 1, reads)
+
+	body, err := (&Request{}).Body()
+	assert.NoError(t, err)
+	assert.Nil(t, body)
+}
+
+func TestRequestBodyIsNotReadOnceEvaluated(t *testing.T) {
+	req := NewRequest("POST", "", "", nil, func() ([]byte, error) {
+		return []byte("body"), nil
+	})
+
+	EvaluateRequest(context.Background(), mock.Filter{}, nil, req)
+
+	body, err := req.Body()
+	assert.ErrorIs(t, err, ErrRequestEvaluated)
+	assert.Nil(t, body)
+}
+
+func TestMultiFilterPassesContextAndRequest(t *testing.T) {
+	req := NewRequest("GET", "", "", nil, nil)
+	ctxErr := make(chan error, 1)
+	f := NewMultiFilterWithOptions(
+		MultiFilterOptions{Timeout: 10 * time.Millisecond},
+		mock.Filter{},
+		contextFilter{
+			evaluator: func(ctx context.Context, span sdk.Span, r *Request) result.FilterResult {
+				assert.Equal(t, req, r)
+				// the deadline is propagated to the filter
+				<-ctx.Done()
+				ctxErr <- ctx.Err()
+				return result.FilterResult{}
+			},
+		},
+	)
+
+	res := f.EvaluateWithContext(context.Background(), nil, req)
+	assert.False(t, res.Block)
+	assert.Equal(t, context.DeadlineExceeded, <-ctxErr)
+}
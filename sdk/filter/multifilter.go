@@ -1,29 +1,228 @@
 package filter // import "github.com/hypertrace/goagent/sdk/filter"
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
 	"github.com/hypertrace/goagent/sdk"
 	"github.com/hypertrace/goagent/sdk/filter/result"
 )
 
+// EvaluationStrategy describes how the filters in a MultiFilter are run.
+type EvaluationStrategy int
+
+const (
+	// SequentialEvaluation runs the filters one after the other until one
+	// of them blocks the request.
+	SequentialEvaluation EvaluationStrategy = iota
+	// ConcurrentEvaluation runs all the filters at the same time and returns
+	// as soon as one of them blocks the request.
+	ConcurrentEvaluation
+)
+
+// FailurePolicy describes what to do with a request when a filter panics
+// or does not return before its deadline.
+type FailurePolicy int
+
+const (
+	// FailOpen ignores the failing filter and lets the request continue.
+	FailOpen FailurePolicy = iota
+	// FailClosed blocks the request when a filter fails.
+	FailClosed
+)
+
+const defaultFailClosedStatusCode = 403
+
+// MultiFilterOptions holds the options for a MultiFilter
+type MultiFilterOptions struct {
+	// Strategy for evaluating the filters, defaults to SequentialEvaluation
+	Strategy EvaluationStrategy
+	// Timeout is the deadline for each filter evaluation, zero means no deadline
+	Timeout time.Duration
+	// FailurePolicy applies when a filter panics or times out, defaults to FailOpen
+	FailurePolicy FailurePolicy
+	// FailClosedStatusCode is the status code returned when failing closed, defaults to 403
+	FailClosedStatusCode int32
+}
+
 // MultiFilter encapsulates multiple filters
 type MultiFilter struct {
 	filters []Filter
+	opts    MultiFilterOptions
 }
 
-var _ Filter = (*MultiFilter)(nil)
+var _ ContextFilter = (*MultiFilter)(nil)
 
-// NewMultiFilter creates a new MultiFilter
+// NewMultiFilter creates a new MultiFilter that runs the filters sequentially
+// with no deadline
 func NewMultiFilter(filter ...Filter) *MultiFilter {
 	return &MultiFilter{filters: filter}
 }
 
-// Evaluate runs body evaluators for each filter until one returns true
+// NewMultiFilterWithOptions creates a new MultiFilter with a custom evaluation
+// strategy, deadline and failure policy
+func NewMultiFilterWithOptions(opts MultiFilterOptions, filter ...Filter) *MultiFilter {
+	if opts.FailClosedStatusCode == 0 {
+		opts.FailClosedStatusCode = defaultFailClosedStatusCode
+	}
+	return &MultiFilter{filters: filter, opts: opts}
+}
+
+// Evaluate runs body evaluators for each filter until one returns true. Decorations
+// from the filters that did not block the request are merged in the filters order.
 func (m *MultiFilter) Evaluate(span sdk.Span) result.FilterResult {
-	for _, f := range (*m).filters {
-		filterResult := f.Evaluate(span)
+	return m.evaluate(context.Background(), span, nil)
+}
+
+// EvaluateWithContext works like Evaluate but passes the context and the request to
+// the filters implementing ContextFilter. When a timeout is set, the context passed
+// to each filter is cancelled once the deadline is exceeded.
+func (m *MultiFilter) EvaluateWithContext(ctx context.Context, span sdk.Span, req *Request) result.FilterResult {
+	return m.evaluate(ctx, span, req)
+}
+
+func (m *MultiFilter) evaluate(ctx context.Context, span sdk.Span, req *Request) result.FilterResult {
+	if m.opts.Strategy == ConcurrentEvaluation && len(m.filters) > 1 {
+		return m.evaluateConcurrently(ctx, span, req)
+	}
+
+	results := make([]result.FilterResult, 0, len(m.filters))
+	for i, f := range m.filters {
+		filterResult, fail := m.evaluateFilter(ctx, f, span, req)
+		if fail != nil {
+			filterResult = m.onFailure(i, f, span, fail)
+		}
 		if filterResult.Block {
 			return filterResult
 		}
+		results = append(results, filterResult)
+	}
+	return mergeResults(results)
+}
+
+// failure describes why a filter did not return a result.
+type failure struct {
+	reason string
+	err    error
+}
+
+type indexedResult struct {
+	index   int
+	result  result.FilterResult
+	failure *failure
+}
+
+func (m *MultiFilter) evaluateConcurrently(ctx context.Context, span sdk.Span, req *Request) result.FilterResult {
+	// cancels the context of the filters still running once we return
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// buffered so late filters do not leak a blocked goroutine once we return
+	resultsCh := make(chan indexedResult, len(m.filters))
+	for i, f := range m.filters {
+		go func(i int, f Filter) {
+			filterResult, fail := m.evaluateFilter(ctx, f, span, req)
+			resultsCh <- indexedResult{i, filterResult, fail}
+		}(i, f)
+	}
+
+	// failures are only recorded here so the span isn't touched once we return
+	results := make([]result.FilterResult, len(m.filters))
+	for range m.filters {
+		r := <-resultsCh
+		if r.failure != nil {
+			r.result = m.onFailure(r.index, m.filters[r.index], span, r.failure)
+		}
+		if r.result.Block {
+			return r.result
+		}
+		results[r.index] = r.result
+	}
+	return mergeResults(results)
+}
+
+// evaluateFilter runs a single filter recovering from panics and applying the
+// deadline if any. A filter whose context is cancelled by the caller, or by a sibling
+// blocking the request, returns an empty result rather than a failure.
+func (m *MultiFilter) evaluateFilter(ctx context.Context, f Filter, span sdk.Span, req *Request) (result.FilterResult, *failure) {
+	if m.opts.Timeout <= 0 {
+		filterResult, err := safeEvaluate(ctx, f, span, req)
+		if err != nil {
+			return result.FilterResult{}, &failure{"panic", err}
+		}
+		return filterResult, nil
+	}
+
+	type evaluation struct {
+		result result.FilterResult
+		err    error
+	}
+
+	filterCtx, cancel := context.WithTimeout(ctx, m.opts.Timeout)
+	defer cancel()
+
+	evalCh := make(chan evaluation, 1)
+	go func() {
+		filterResult, err := safeEvaluate(filterCtx, f, span, req)
+		evalCh <- evaluation{filterResult, err}
+	}()
+
+	select {
+	case e := <-evalCh:
+		if e.err != nil {
+			return result.FilterResult{}, &failure{"panic", e.err}
+		}
+		return e.result, nil
+	case <-filterCtx.Done():
+		if ctx.Err() == nil && errors.Is(filterCtx.Err(), context.DeadlineExceeded) {
+			return result.FilterResult{}, &failure{"timeout",
+				fmt.Errorf("filter evaluation exceeded deadline of %s", m.opts.Timeout)}
+		}
+		return result.FilterResult{}, nil
+	}
+}
+
+// onFailure records the filter failure in the span and applies the failure policy.
+func (m *MultiFilter) onFailure(index int, f Filter, span sdk.Span, fail *failure) result.FilterResult {
+	if span != nil && !span.IsNoop() {
+		span.AddEvent("filter.failure", time.Now(), map[string]interface{}{
+			"filter.index":          index,
+			"filter.type":           fmt.Sprintf("%T", f),
+			"filter.failure.reason": fail.reason,
+			"filter.failure.error":  fail.err.Error(),
+		})
+	}
+
+	if m.opts.FailurePolicy == FailClosed {
+		return result.FilterResult{Block: true, ResponseStatusCode: m.opts.FailClosedStatusCode}
 	}
 	return result.FilterResult{}
 }
+
+func safeEvaluate(ctx context.Context, f Filter, span sdk.Span, req *Request) (res result.FilterResult, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("filter panicked: %v", r)
+		}
+	}()
+
+	return evaluateRequest(ctx, f, span, req), nil
+}
+
+// mergeResults merges the decorations of non blocking results into a single result.
+func mergeResults(results []result.FilterResult) result.FilterResult {
+	var decorations *result.Decorations
+	for _, r := range results {
+		if r.Decorations == nil {
+			continue
+		}
+		if decorations == nil {
+			decorations = &result.Decorations{}
+		}
+		decorations.RequestHeaderInjections = append(decorations.RequestHeaderInjections, r.Decorations.RequestHeaderInjections...)
+		decorations.RequestHeaderRemovals = append(decorations.RequestHeaderRemovals, r.Decorations.RequestHeaderRemovals...)
+	}
+	return result.FilterResult{Decorations: decorations}
+}
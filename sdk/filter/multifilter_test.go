@@ -1,7 +1,9 @@
 package filter
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/hypertrace/goagent/sdk"
 	"github.com/hypertrace/goagent/sdk/filter/result"
@@ -52,3 +54,173 @@ func TestMultiFilterStopsAfterTrue(t *testing.T) {
 		})
 	}
 }
+
+func TestMultiFilterMergesDecorations(t *testing.T) {
+	for name, strategy := range map[string]EvaluationStrategy{
+		"sequential": SequentialEvaluation,
+		"concurrent": ConcurrentEvaluation,
+	} {
+		t.Run(name, func(t *testing.T) {
+			f := NewMultiFilterWithOptions(
+				MultiFilterOptions{Strategy: strategy},
+				mock.Filter{
+					Evaluator: func(span sdk.Span) result.FilterResult {
+						return result.FilterResult{Decorations: &result.Decorations{
+							RequestHeaderInjections: []result.KeyValueString{{Key: "a", Value: "1"}},
+						}}
+					},
+				},
+				mock.Filter{},
+				mock.Filter{
+					Evaluator: func(span sdk.Span) result.FilterResult {
+						return result.FilterResult{Decorations: &result.Decorations{
+							RequestHeaderInjections: []result.KeyValueString{{Key: "b", Value: "2"}},
+						}}
+					},
+				},
+			)
+
+			res := f.Evaluate(nil)
+			assert.False(t, res.Block)
+			assert.Equal(t, []result.KeyValueString{{Key: "a", Value: "1"}, {Key: "b", Value: "2"}},
+				res.Decorations.RequestHeaderInjections)
+		})
+	}
+}
+
+func TestMultiFilterConcurrentFirstBlockWins(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	f := NewMultiFilterWithOptions(
+		MultiFilterOptions{Strategy: ConcurrentEvaluation},
+		mock.Filter{
+			Evaluator: func(span sdk.Span) result.FilterResult {
+				<-release
+				return result.FilterResult{}
+			},
+		},
+		mock.Filter{
+			Evaluator: func(span sdk.Span) result.FilterResult {
+				return result.FilterResult{Block: true, ResponseStatusCode: 403}
+			},
+		},
+	)
+
+	res := f.Evaluate(nil)
+	assert.True(t, res.Block)
+	assert.Equal(t, int32(403), res.ResponseStatusCode)
+}
+
+func TestMultiFilterRecoversFromPanic(t *testing.T) {
+	tCases := map[string]struct {
+		policy        FailurePolicy
+		expectedBlock bool
+	}{
+		"fail open":   {policy: FailOpen, expectedBlock: false},
+		"fail closed": {policy: FailClosed, expectedBlock: true},
+	}
+
+	for name, tCase := range tCases {
+		t.Run(name, func(t *testing.T) {
+			span := mock.NewSpan()
+			f := NewMultiFilterWithOptions(
+				MultiFilterOptions{FailurePolicy: tCase.policy},
+				mock.Filter{
+					Evaluator: func(span sdk.Span) result.FilterResult {
+						panic("boom")
+					},
+				},
+			)
+
+			res := f.Evaluate(span)
+			assert.Equal(t, tCase.expectedBlock, res.Block)
+			if tCase.expectedBlock {
+				assert.Equal(t, int32(403), res.ResponseStatusCode)
+			}
+
+			attrs, ok := span.ReadEvent("filter.failure")
+			assert.True(t, ok)
+			assert.Equal(t, "panic", attrs["filter.failure.reason"])
+			assert.Equal(t, 0, attrs["filter.index"])
+		})
+	}
+}
+
+func TestMultiFilterTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	span := mock.NewSpan()
+	f := NewMultiFilterWithOptions(
+		MultiFilterOptions{Timeout: 10 * time.Millisecond, FailurePolicy: FailClosed, FailClosedStatusCode: 503},
+		mock.Filter{
+			Evaluator: func(span sdk.Span) result.FilterResult {
+				<-release
+				return result.FilterResult{}
+			},
+		},
+	)
+
+	res := f.Evaluate(span)
+	assert.True(t, res.Block)
+	assert.Equal(t, int32(503), res.ResponseStatusCode)
+
+	attrs, ok := span.ReadEvent("filter.failure")
+	assert.True(t, ok)
+	assert.Equal(t, "timeout", attrs["filter.failure.reason"])
+}
+
+func TestMultiFilterConcurrentBlockDoesNotFailSiblings(t *testing.T) {
+	siblingDone := make(chan struct{})
+
+	span := mock.NewSpan()
+	f := NewMultiFilterWithOptions(
+		MultiFilterOptions{Strategy: ConcurrentEvaluation, Timeout: time.Second, FailurePolicy: FailClosed, FailClosedStatusCode: 503},
+		mock.Filter{
+			Evaluator: func(span sdk.Span) result.FilterResult {
+				defer close(siblingDone)
+				time.Sleep(20 * time.Millisecond)
+				return result.FilterResult{}
+			},
+		},
+		mock.Filter{
+			Evaluator: func(span sdk.Span) result.FilterResult {
+				return result.FilterResult{Block: true, ResponseStatusCode: 403}
+			},
+		},
+	)
+
+	res := f.Evaluate(span)
+	assert.Equal(t, int32(403), res.ResponseStatusCode)
+
+	// the sibling cancelled by the blocking filter is neither a timeout nor recorded
+	<-siblingDone
+	time.Sleep(10 * time.Millisecond)
+	_, ok := span.ReadEvent("filter.failure")
+	assert.False(t, ok)
+}
+
+func TestMultiFilterParentCancellationIsNotATimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	span := mock.NewSpan()
+	f := NewMultiFilterWithOptions(
+		MultiFilterOptions{Timeout: time.Second, FailurePolicy: FailClosed},
+		mock.Filter{
+			Evaluator: func(span sdk.Span) result.FilterResult {
+				<-release
+				return result.FilterResult{}
+			},
+		},
+	)
+
+	res := f.EvaluateWithContext(ctx, span, nil)
+	assert.False(t, res.Block)
+	_, ok := span.ReadEvent("filter.failure")
+	assert.False(t, ok)
+}
@@ -0,0 +1,60 @@
+package opa // import "github.com/hypertrace/goagent/sdk/filter/opa"
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/hypertrace/goagent/sdk/filter/result"
+)
+
+// resultCache is a fixed size LRU cache of policy results keyed by the
+// hash of the input document.
+type resultCache struct {
+	mux     sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type cacheEntry struct {
+	key    string
+	result result.FilterResult
+}
+
+func newResultCache(size int) *resultCache {
+	return &resultCache{
+		size:    size,
+		entries: make(map[string]*list.Element, size),
+		order:   list.New(),
+	}
+}
+
+func (c *resultCache) get(key string) (result.FilterResult, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return result.FilterResult{}, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*cacheEntry).result, true
+}
+
+func (c *resultCache) put(key string, r result.FilterResult) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*cacheEntry).result = r
+		c.order.MoveToFront(e)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, result: r})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
@@ -0,0 +1,398 @@
+package opa // import "github.com/hypertrace/goagent/sdk/filter/opa"
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/filter"
+	"github.com/hypertrace/goagent/sdk/filter/result"
+	"github.com/open-policy-agent/opa/rego"
+)
+
+const (
+	defaultQuery           = "data.hypertrace.filter.result"
+	defaultCacheKeyQuery   = "data.hypertrace.filter.cache_key"
+	defaultTimeout         = 50 * time.Millisecond
+	defaultBlockStatusCode = 403
+)
+
+// Options holds the options for the policy filter
+type Options struct {
+	// BundlePath is the path to a bundle directory or a bundle tarball (.tar.gz)
+	BundlePath string
+	// Query is the rego query whose result is mapped into the filter result,
+	// defaults to data.hypertrace.filter.result
+	Query string
+	// Timeout is the deadline for each policy evaluation, defaults to 50ms
+	Timeout time.Duration
+	// ReloadInterval is how often the bundle is checked for changes, zero
+	// disables the hot reload
+	ReloadInterval time.Duration
+	// CacheSize is the max number of results cached, zero disables the cache
+	CacheSize int
+	// CacheKeyFields are the paths of the input fields the policy depends on, e.g.
+	// "http.method" or "http.request.headers.x-client", results being cached per
+	// combination of their values. When empty, the fields are read from the bundle
+	// through CacheKeyQuery and results are not cached if the bundle declares none.
+	CacheKeyFields []string
+	// CacheKeyQuery is the rego query returning the cache key fields declared by the
+	// bundle, defaults to data.hypertrace.filter.cache_key
+	CacheKeyQuery string
+}
+
+// compiledPolicy holds a prepared query along with the cache of results it produced
+// so that reloading the bundle drops the stale results.
+type compiledPolicy struct {
+	query       rego.PreparedEvalQuery
+	cache       *resultCache
+	cacheKey    []string
+	fingerprint string
+}
+
+// Filter evaluates a rego policy against an input document built from the span
+// attributes. The query result is either a boolean telling whether the request has
+// to be blocked or an object with the following (optional) fields:
+//
+//	{
+//	  "block": true,
+//	  "status_code": 429,
+//	  "message": "too many requests",
+//	  "headers": {"x-policy": "limited"},
+//	  "remove_headers": ["x-internal"]
+//	}
+//
+// Evaluation errors and timeouts let the request continue and are recorded in the
+// span as a `filter.failure` event.
+type Filter struct {
+	opts   Options
+	policy atomic.Pointer[compiledPolicy]
+	done   chan struct{}
+	close  sync.Once
+}
+
+var _ filter.ContextFilter = (*Filter)(nil)
+
+// NewFilter loads and compiles the bundle and starts watching it for changes when
+// a reload interval is set.
+func NewFilter(opts Options) (*Filter, error) {
+	if opts.BundlePath == "" {
+		return nil, errors.New("bundle path is required")
+	}
+	if opts.Query == "" {
+		opts.Query = defaultQuery
+	}
+	if opts.CacheKeyQuery == "" {
+		opts.CacheKeyQuery = defaultCacheKeyQuery
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+
+	f := &Filter{opts: opts, done: make(chan struct{})}
+	if err := f.reload(); err != nil {
+		return nil, err
+	}
+
+	if opts.ReloadInterval > 0 {
+		go f.watch()
+	}
+
+	return f, nil
+}
+
+// Close stops watching the bundle for changes.
+func (f *Filter) Close() {
+	f.close.Do(func() {
+		close(f.done)
+	})
+}
+
+// Evaluate evaluates the policy with the span attributes as input.
+func (f *Filter) Evaluate(span sdk.Span) result.FilterResult {
+	return f.EvaluateWithContext(context.Background(), span, nil)
+}
+
+// EvaluateWithContext evaluates the policy with the span attributes and the request
+// view as input. The evaluation is cancelled when the context is done or the timeout
+// is exceeded.
+func (f *Filter) EvaluateWithContext(ctx context.Context, span sdk.Span, req *filter.Request) result.FilterResult {
+	if span == nil || span.IsNoop() {
+		return result.FilterResult{}
+	}
+
+	input := buildInput(span, req)
+	policy := f.policy.Load()
+
+	var key string
+	if policy.cache != nil {
+		key = cacheKey(input, policy.cacheKey)
+		if r, ok := policy.cache.get(key); key != "" && ok {
+			return r
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, f.opts.Timeout)
+	defer cancel()
+
+	rs, err := policy.query.Eval(ctx, rego.EvalInput(input))
+	if err != nil {
+		reason := "error"
+		if ctx.Err() != nil {
+			reason = "timeout"
+		}
+		recordFailure(span, reason, err)
+		return result.FilterResult{}
+	}
+
+	var r result.FilterResult
+	if len(rs) > 0 && len(rs[0].Expressions) > 0 {
+		r, err = toFilterResult(rs[0].Expressions[0].Value)
+		if err != nil {
+			recordFailure(span, "error", err)
+			return result.FilterResult{}
+		}
+	}
+
+	if key != "" {
+		policy.cache.put(key, r)
+	}
+	return r
+}
+
+// cacheKey hashes the values of the given input fields, leaving out the ones varying
+// on every request such as the trace context. It returns an empty key when the values
+// can't be serialized.
+func cacheKey(input map[string]interface{}, fields []string) string {
+	values := make([]interface{}, len(fields))
+	for i, field := range fields {
+		values[i] = lookupField(input, field)
+	}
+	rawValues, err := json.Marshal(values)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(rawValues)
+	return hex.EncodeToString(sum[:])
+}
+
+// lookupField returns the value at the dot separated path in the input document. As
+// keys can contain dots (e.g. attributes.http.method), the longest key matching a path
+// prefix wins.
+func lookupField(doc map[string]interface{}, path string) interface{} {
+	if value, ok := doc[path]; ok {
+		return value
+	}
+	for i := strings.LastIndex(path, "."); i > 0; i = strings.LastIndex(path[:i], ".") {
+		if nested, ok := doc[path[:i]].(map[string]interface{}); ok {
+			return lookupField(nested, path[i+1:])
+		}
+	}
+	return nil
+}
+
+// declaredCacheKey returns the cache key fields declared by the bundle, if any.
+func (f *Filter) declaredCacheKey() ([]string, error) {
+	rs, err := rego.New(
+		rego.Query(f.opts.CacheKeyQuery),
+		rego.LoadBundle(f.opts.BundlePath),
+	).Eval(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if len(rs) == 0 || len(rs[0].Expressions) == 0 {
+		return nil, nil
+	}
+
+	rawFields, ok := rs[0].Expressions[0].Value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected cache key type %T", rs[0].Expressions[0].Value)
+	}
+	fields := make([]string, 0, len(rawFields))
+	for _, rawField := range rawFields {
+		field, ok := rawField.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected cache key field type %T", rawField)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+func (f *Filter) watch() {
+	ticker := time.NewTicker(f.opts.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.done:
+			return
+		case <-ticker.C:
+			if err := f.reload(); err != nil {
+				log.Printf("error while reloading policy bundle %s: %v", f.opts.BundlePath, err)
+			}
+		}
+	}
+}
+
+// reload compiles the bundle if it changed since the last load. The previous
+// policy is kept when the new bundle fails to compile.
+func (f *Filter) reload() error {
+	fingerprint, err := bundleFingerprint(f.opts.BundlePath)
+	if err != nil {
+		return err
+	}
+
+	if current := f.policy.Load(); current != nil && current.fingerprint == fingerprint {
+		return nil
+	}
+
+	query, err := rego.New(
+		rego.Query(f.opts.Query),
+		rego.LoadBundle(f.opts.BundlePath),
+	).PrepareForEval(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to compile policy bundle: %v", err)
+	}
+
+	policy := &compiledPolicy{query: query, fingerprint: fingerprint}
+	if f.opts.CacheSize > 0 {
+		policy.cacheKey = f.opts.CacheKeyFields
+		if len(policy.cacheKey) == 0 {
+			if policy.cacheKey, err = f.declaredCacheKey(); err != nil {
+				return fmt.Errorf("failed to read the cache key of the policy bundle: %v", err)
+			}
+		}
+
+		if len(policy.cacheKey) > 0 {
+			policy.cache = newResultCache(f.opts.CacheSize)
+		} else {
+			log.Printf("policy results are not cached as no cache key fields are declared for %s", f.opts.BundlePath)
+		}
+	}
+	f.policy.Store(policy)
+	return nil
+}
+
+// bundleFingerprint summarizes the name, size and modification time of the bundle
+// files so changes can be detected without reading them.
+func bundleFingerprint(path string) (string, error) {
+	h := sha256.New()
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s:%d:%d;", p, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("policy bundle not found: %v", err)
+		}
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func toFilterResult(value interface{}) (result.FilterResult, error) {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return result.FilterResult{Block: true, ResponseStatusCode: defaultBlockStatusCode}, nil
+		}
+		return result.FilterResult{}, nil
+	case map[string]interface{}:
+		return toFilterResultFromObject(v)
+	default:
+		return result.FilterResult{}, fmt.Errorf("unexpected policy result type %T", value)
+	}
+}
+
+func toFilterResultFromObject(obj map[string]interface{}) (result.FilterResult, error) {
+	r := result.FilterResult{}
+
+	if block, ok := obj["block"].(bool); ok && block {
+		r.Block = true
+		r.ResponseStatusCode = defaultBlockStatusCode
+	}
+
+	if rawCode, ok := obj["status_code"]; ok {
+		code, ok := rawCode.(json.Number)
+		if !ok {
+			return result.FilterResult{}, fmt.Errorf("unexpected status_code type %T", rawCode)
+		}
+		c, err := code.Int64()
+		if err != nil {
+			return result.FilterResult{}, fmt.Errorf("invalid status_code: %v", err)
+		}
+		r.ResponseStatusCode = int32(c)
+	}
+
+	if message, ok := obj["message"].(string); ok {
+		r.ResponseMessage = message
+	}
+
+	decorations := &result.Decorations{}
+	if headers, ok := obj["headers"].(map[string]interface{}); ok {
+		keys := make([]string, 0, len(headers))
+		for k := range headers {
+			keys = append(keys, k)
+		}
+		// keeps the injections deterministic as objects have no order
+		sort.Strings(keys)
+		for _, k := range keys {
+			switch hv := headers[k].(type) {
+			case string:
+				decorations.RequestHeaderInjections = append(decorations.RequestHeaderInjections, result.KeyValueString{Key: k, Value: hv})
+			case []interface{}:
+				for _, item := range hv {
+					if s, ok := item.(string); ok {
+						decorations.RequestHeaderInjections = append(decorations.RequestHeaderInjections, result.KeyValueString{Key: k, Value: s})
+					}
+				}
+			}
+		}
+	}
+
+	if removals, ok := obj["remove_headers"].([]interface{}); ok {
+		for _, item := range removals {
+			if s, ok := item.(string); ok {
+				decorations.RequestHeaderRemovals = append(decorations.RequestHeaderRemovals, s)
+			}
+		}
+	}
+
+	if len(decorations.RequestHeaderInjections) > 0 || len(decorations.RequestHeaderRemovals) > 0 {
+		r.Decorations = decorations
+	}
+
+	return r, nil
+}
+
+func recordFailure(span sdk.Span, reason string, err error) {
+	span.AddEvent("filter.failure", time.Now(), map[string]interface{}{
+		"filter.type":           fmt.Sprintf("%T", (*Filter)(nil)),
+		"filter.failure.reason": reason,
+		"filter.failure.error":  err.Error(),
+	})
+}
@@ -0,0 +1,238 @@
+package opa
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hypertrace/goagent/sdk/filter"
+	"github.com/hypertrace/goagent/sdk/filter/result"
+	"github.com/hypertrace/goagent/sdk/internal/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const blockingPolicy = `package hypertrace.filter
+
+import rego.v1
+
+default result := {"block": false}
+
+result := {
+	"block": true,
+	"status_code": 429,
+	"message": "too many requests",
+} if {
+	input.http.request.headers["x-client"] == "abuser"
+}
+
+result := {"headers": {"x-policy": "checked"}, "remove_headers": ["x-internal"]} if {
+	input.rpc.service == "helloworld.Greeter"
+}
+`
+
+func writeBundle(t *testing.T, dir, policy string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "policy.rego"), []byte(policy), 0o600))
+}
+
+func TestFilterBlocksRequest(t *testing.T) {
+	dir := t.TempDir()
+	writeBundle(t, dir, blockingPolicy)
+
+	f, err := NewFilter(Options{BundlePath: dir})
+	require.NoError(t, err)
+	defer f.Close()
+
+	span := mock.NewSpan()
+	span.SetAttribute("http.url", "http://localhost/foo")
+	span.SetAttribute("http.request.header.x-client", "abuser")
+
+	res := f.Evaluate(span)
+	assert.True(t, res.Block)
+	assert.Equal(t, int32(429), res.ResponseStatusCode)
+	assert.Equal(t, "too many requests", res.ResponseMessage)
+
+	span = mock.NewSpan()
+	span.SetAttribute("http.request.header.x-client", "friend")
+	assert.Equal(t, result.FilterResult{}, f.Evaluate(span))
+}
+
+func TestFilterDecoratesRequest(t *testing.T) {
+	dir := t.TempDir()
+	writeBundle(t, dir, blockingPolicy)
+
+	f, err := NewFilter(Options{BundlePath: dir})
+	require.NoError(t, err)
+	defer f.Close()
+
+	span := mock.NewSpan()
+	span.SetAttribute("rpc.system", "grpc")
+	span.SetAttribute("rpc.service", "helloworld.Greeter")
+
+	res := f.EvaluateWithContext(context.Background(), span, filter.NewRequest("/helloworld.Greeter/SayHello", "", "", nil, nil))
+	assert.False(t, res.Block)
+	assert.Equal(t, &result.Decorations{
+		RequestHeaderInjections: []result.KeyValueString{{Key: "x-policy", Value: "checked"}},
+		RequestHeaderRemovals:   []string{"x-internal"},
+	}, res.Decorations)
+}
+
+func TestFilterBooleanResult(t *testing.T) {
+	dir := t.TempDir()
+	writeBundle(t, dir, `package hypertrace.filter
+
+import rego.v1
+
+result if input.request.route == "/admin"
+`)
+
+	f, err := NewFilter(Options{BundlePath: dir})
+	require.NoError(t, err)
+	defer f.Close()
+
+	res := f.EvaluateWithContext(context.Background(), mock.NewSpan(), filter.NewRequest("GET", "/admin", "", nil, nil))
+	assert.True(t, res.Block)
+	assert.Equal(t, int32(403), res.ResponseStatusCode)
+
+	res = f.EvaluateWithContext(context.Background(), mock.NewSpan(), filter.NewRequest("GET", "/users", "", nil, nil))
+	assert.False(t, res.Block)
+}
+
+func TestFilterEvaluationIsBoundedInTime(t *testing.T) {
+	dir := t.TempDir()
+	// numbers.range generates a large enough set for the evaluation to exceed the deadline
+	writeBundle(t, dir, `package hypertrace.filter
+
+import rego.v1
+
+result if {
+	count([x | some x in numbers.range(1, 100000000); x % 7 == 0]) > 0
+}
+`)
+
+	f, err := NewFilter(Options{BundlePath: dir, Timeout: 10 * time.Millisecond})
+	require.NoError(t, err)
+	defer f.Close()
+
+	span := mock.NewSpan()
+	start := time.Now()
+	res := f.Evaluate(span)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.False(t, res.Block)
+
+	event, ok := span.ReadEvent("filter.failure")
+	require.True(t, ok)
+	assert.Equal(t, "timeout", event["filter.failure.reason"])
+}
+
+func TestFilterCachesResultsByDeclaredFields(t *testing.T) {
+	dir := t.TempDir()
+	writeBundle(t, dir, blockingPolicy+`
+cache_key := ["http.request.headers.x-client", "rpc.service"]
+`)
+
+	f, err := NewFilter(Options{BundlePath: dir, CacheSize: 1})
+	require.NoError(t, err)
+	defer f.Close()
+
+	// spans of distinct requests only sharing the fields the policy depends on
+	newSpan := func(client, traceparent string) *mock.Span {
+		span := mock.NewSpan()
+		span.SetAttribute("http.request.header.x-client", client)
+		span.SetAttribute("http.request.header.traceparent", traceparent)
+		span.SetAttribute("http.request.header.x-request-id", traceparent)
+		return span
+	}
+
+	assert.True(t, f.Evaluate(newSpan("abuser", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")).Block)
+	key := cacheKey(buildInput(newSpan("abuser", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"), nil), f.policy.Load().cacheKey)
+	cached, ok := f.policy.Load().cache.get(key)
+	require.True(t, ok)
+	assert.True(t, cached.Block)
+
+	// evicts the previous entry
+	assert.False(t, f.Evaluate(newSpan("friend", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")).Block)
+	_, ok = f.policy.Load().cache.get(key)
+	assert.False(t, ok)
+}
+
+func TestFilterCacheKeyFieldsOption(t *testing.T) {
+	dir := t.TempDir()
+	writeBundle(t, dir, blockingPolicy)
+
+	f, err := NewFilter(Options{BundlePath: dir, CacheSize: 10, CacheKeyFields: []string{"attributes.http.request.header.x-client"}})
+	require.NoError(t, err)
+	defer f.Close()
+
+	span := mock.NewSpan()
+	span.SetAttribute("http.request.header.x-client", "abuser")
+	assert.True(t, f.Evaluate(span).Block)
+
+	_, ok := f.policy.Load().cache.get(cacheKey(map[string]interface{}{
+		"attributes": map[string]interface{}{"http.request.header.x-client": "abuser"},
+	}, []string{"attributes.http.request.header.x-client"}))
+	assert.True(t, ok)
+}
+
+func TestFilterDoesNotCacheWithoutKeyFields(t *testing.T) {
+	dir := t.TempDir()
+	writeBundle(t, dir, blockingPolicy)
+
+	f, err := NewFilter(Options{BundlePath: dir, CacheSize: 10})
+	require.NoError(t, err)
+	defer f.Close()
+
+	assert.Nil(t, f.policy.Load().cache)
+}
+
+func TestFilterReloadsBundle(t *testing.T) {
+	dir := t.TempDir()
+	writeBundle(t, dir, `package hypertrace.filter
+
+result := false
+`)
+
+	f, err := NewFilter(Options{BundlePath: dir, ReloadInterval: 10 * time.Millisecond, CacheSize: 10})
+	require.NoError(t, err)
+	defer f.Close()
+
+	assert.False(t, f.Evaluate(mock.NewSpan()).Block)
+
+	writeBundle(t, dir, `package hypertrace.filter
+
+result := true
+`)
+	assert.Eventually(t, func() bool {
+		return f.Evaluate(mock.NewSpan()).Block
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestFilterKeepsPolicyOnInvalidBundle(t *testing.T) {
+	dir := t.TempDir()
+	writeBundle(t, dir, `package hypertrace.filter
+
+result := true
+`)
+
+	f, err := NewFilter(Options{BundlePath: dir})
+	require.NoError(t, err)
+	defer f.Close()
+
+	writeBundle(t, dir, `package hypertrace.filter
+
+result := {
+`)
+	assert.Error(t, f.reload())
+	assert.True(t, f.Evaluate(mock.NewSpan()).Block)
+}
+
+func TestNewFilterFailsOnMissingBundle(t *testing.T) {
+	_, err := NewFilter(Options{})
+	assert.Error(t, err)
+
+	_, err = NewFilter(Options{BundlePath: filepath.Join(t.TempDir(), "missing")})
+	assert.Error(t, err)
+}
@@ -0,0 +1,75 @@
+package opa // import "github.com/hypertrace/goagent/sdk/filter/opa"
+
+import (
+	"strings"
+
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/filter"
+)
+
+const (
+	httpRequestHeaderPrefix  = "http.request.header."
+	rpcRequestMetadataPrefix = "rpc.request.metadata."
+)
+
+// buildInput creates the input document for the policy out of the span attributes
+// and, when available, the request view passed by the instrumentation:
+//
+//	{
+//	  "attributes": {"http.method": "GET", ...},
+//	  "http": {"method": "GET", "url": "...", "target": "...", "request": {"headers": {...}, "body": "..."}},
+//	  "rpc": {"system": "grpc", "service": "...", "method": "...", "request": {"metadata": {...}, "body": "..."}},
+//	  "request": {"method": "...", "route": "...", "peer": "..."}
+//	}
+//
+// Header and metadata keys are lowercased as the instrumentations record them.
+func buildInput(span sdk.Span, req *filter.Request) map[string]interface{} {
+	attributes := map[string]interface{}{}
+	httpDoc := map[string]interface{}{}
+	httpRequest := map[string]interface{}{}
+	httpHeaders := map[string]interface{}{}
+	rpcDoc := map[string]interface{}{}
+	rpcRequest := map[string]interface{}{}
+	rpcMetadata := map[string]interface{}{}
+
+	span.GetAttributes().Iterate(func(key string, value interface{}) bool {
+		attributes[key] = value
+		switch {
+		case strings.HasPrefix(key, httpRequestHeaderPrefix):
+			httpHeaders[strings.TrimPrefix(key, httpRequestHeaderPrefix)] = value
+		case strings.HasPrefix(key, rpcRequestMetadataPrefix):
+			rpcMetadata[strings.TrimPrefix(key, rpcRequestMetadataPrefix)] = value
+		case key == "http.request.body":
+			httpRequest["body"] = value
+		case key == "rpc.request.body":
+			rpcRequest["body"] = value
+		case key == "http.method", key == "http.url", key == "http.target",
+			key == "http.scheme", key == "http.host", key == "http.route":
+			httpDoc[strings.TrimPrefix(key, "http.")] = value
+		case key == "rpc.system", key == "rpc.service", key == "rpc.method":
+			rpcDoc[strings.TrimPrefix(key, "rpc.")] = value
+		}
+		return true
+	})
+
+	httpRequest["headers"] = httpHeaders
+	httpDoc["request"] = httpRequest
+	rpcRequest["metadata"] = rpcMetadata
+	rpcDoc["request"] = rpcRequest
+
+	input := map[string]interface{}{
+		"attributes": attributes,
+		"http":       httpDoc,
+		"rpc":        rpcDoc,
+	}
+
+	if req != nil {
+		input["request"] = map[string]interface{}{
+			"method": req.Method,
+			"route":  req.Route,
+			"peer":   req.Peer,
+		}
+	}
+
+	return input
+}
@@ -7,6 +7,9 @@ type KeyValueString struct {
 
 type Decorations struct {
 	RequestHeaderInjections []KeyValueString
+	// RequestHeaderRemovals lists the headers (or metadata keys in gRPC) to be
+	// removed from the request
+	RequestHeaderRemovals []string
 }
 
 type FilterResult struct {
@@ -0,0 +1,85 @@
+package waf // import "github.com/hypertrace/goagent/sdk/filter/waf"
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Category groups the rules by the kind of attack they detect.
+type Category string
+
+const (
+	CategorySQLi          Category = "sqli"
+	CategoryXSS           Category = "xss"
+	CategoryPathTraversal Category = "path_traversal"
+)
+
+// rule is a single detection signature, it only runs when the configured
+// paranoia level is equal or greater than its own.
+type rule struct {
+	id            string
+	category      Category
+	paranoiaLevel int
+	// raw tells the rule to inspect the value before decoding it, useful for
+	// detecting encoding based evasions.
+	raw    bool
+	detect func(value string) bool
+}
+
+func regexpRule(id string, category Category, paranoiaLevel int, expr string) rule {
+	re := regexp.MustCompile(expr)
+	return rule{id: id, category: category, paranoiaLevel: paranoiaLevel, detect: re.MatchString}
+}
+
+func sqliRule(id string, paranoiaLevel int, detector func([]token) bool) rule {
+	return rule{id: id, category: CategorySQLi, paranoiaLevel: paranoiaLevel, detect: func(value string) bool {
+		return detectSQLi(value, detector)
+	}}
+}
+
+// rules are evaluated in order so cheaper and more accurate rules go first.
+var rules = []rule{
+	sqliRule("sqli-union", 1, sqliUnion),
+	sqliRule("sqli-tautology", 1, sqliTautology(true)),
+	sqliRule("sqli-stacked-query", 1, sqliStackedQuery),
+	sqliRule("sqli-function", 1, sqliFunction),
+	sqliRule("sqli-comment-termination", 2, sqliCommentTermination),
+	sqliRule("sqli-boolean-condition", 3, sqliTautology(false)),
+
+	regexpRule("xss-script-tag", CategoryXSS, 1, `(?i)<\s*script[\s/>]`),
+	regexpRule("xss-event-handler", CategoryXSS, 1, `(?i)<[a-z][^>]*[\s/"'\x60]on[a-z]+\s*=`),
+	regexpRule("xss-javascript-uri", CategoryXSS, 1, `(?i)(?:java|vb)script\s*:`),
+	regexpRule("xss-dangerous-tag", CategoryXSS, 2, `(?i)<\s*(?:iframe|frame|object|embed|applet|svg|math|base|form|meta|link|style)\b`),
+	regexpRule("xss-js-sink", CategoryXSS, 2, `(?i)(?:document\s*\.\s*(?:cookie|domain|write)|\beval\s*\(|\balert\s*\(|\bprompt\s*\(|fromcharcode|data:text/html)`),
+	regexpRule("xss-html-tag", CategoryXSS, 3, `(?i)<\s*/?\s*[a-z][a-z0-9]*[^>]*>`),
+
+	regexpRule("path-traversal-dot-dot", CategoryPathTraversal, 1, `(?:^|[\\/])\.\.(?:[\\/]|$)`),
+	{
+		id:            "path-traversal-encoded",
+		category:      CategoryPathTraversal,
+		paranoiaLevel: 1,
+		raw:           true,
+		detect:        detectEncodedTraversal,
+	},
+	regexpRule("path-traversal-sensitive-file", CategoryPathTraversal, 2, `(?i)(?:/etc/(?:passwd|shadow|group|hosts)|/proc/self/|\\?(?:boot|win)\.ini|/\.ssh/|\.htaccess|\.htpasswd|/\.git/|/\.env\b)`),
+	regexpRule("path-traversal-dot-dot-loose", CategoryPathTraversal, 3, `\.\.[\\/]|[\\/]\.\.`),
+}
+
+// encodedDotDot lists the encoded forms of ../ used to bypass naive filters.
+var encodedDotDot = []string{
+	"%2e%2e%2f", "%2e%2e/", "..%2f", "%2e%2e%5c", "..%5c", "%252e%252e", "..%252f",
+	"%c0%ae%c0%ae", "%c0%af", "%c1%9c", "..%c0%af", "%uff0e%uff0e",
+}
+
+func detectEncodedTraversal(value string) bool {
+	lower := strings.ToLower(value)
+	if !strings.Contains(lower, "%") {
+		return false
+	}
+	for _, e := range encodedDotDot {
+		if strings.Contains(lower, e) {
+			return true
+		}
+	}
+	return false
+}
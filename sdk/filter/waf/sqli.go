@@ -0,0 +1,307 @@
+package waf // import "github.com/hypertrace/goagent/sdk/filter/waf"
+
+import (
+	"strings"
+)
+
+type tokenType int
+
+const (
+	tokenString tokenType = iota
+	tokenNumber
+	tokenKeyword
+	tokenFunction
+	tokenIdentifier
+	tokenOperator
+	tokenLogicalOperator
+	tokenComment
+	tokenSemicolon
+	tokenOpenParen
+	tokenCloseParen
+	tokenComma
+)
+
+type token struct {
+	typ   tokenType
+	value string
+}
+
+var sqlKeywords = map[string]bool{
+	"select": true, "union": true, "all": true, "from": true, "where": true,
+	"insert": true, "into": true, "values": true, "update": true, "set": true,
+	"delete": true, "drop": true, "create": true, "alter": true, "truncate": true,
+	"exec": true, "execute": true, "declare": true, "shutdown": true, "having": true,
+	"order": true, "group": true, "by": true, "like": true, "null": true, "table": true,
+	"waitfor": true, "delay": true, "limit": true, "offset": true, "case": true, "when": true,
+	"then": true, "else": true, "end": true, "is": true, "not": true, "in": true,
+}
+
+var sqlLogicalOperators = map[string]bool{"or": true, "and": true, "xor": true, "||": true, "&&": true}
+
+// sqlFunctions are functions commonly used to exfiltrate data or to run
+// time based blind injections.
+var sqlFunctions = map[string]bool{
+	"sleep": true, "benchmark": true, "pg_sleep": true, "load_file": true, "version": true,
+	"user": true, "database": true, "char": true, "concat": true, "extractvalue": true,
+	"updatexml": true, "substring": true, "ascii": true, "if": true, "dbms_pipe.receive_message": true,
+}
+
+var sqlStatementKeywords = map[string]bool{
+	"select": true, "insert": true, "update": true, "delete": true, "drop": true,
+	"create": true, "alter": true, "truncate": true, "exec": true, "execute": true,
+	"declare": true, "shutdown": true, "waitfor": true,
+}
+
+// tokenizeSQL splits the input into SQL tokens. Like libinjection, the input is
+// expected to be a fragment of a query so a leading quote is a valid way of
+// breaking out of a string literal.
+func tokenizeSQL(s string) []token {
+	var tokens []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '+':
+			// + is how spaces usually get to a query when coming from a form
+			i++
+		case c == '\'' || c == '"' || c == '`':
+			end := i + 1
+			for end < len(s) && s[end] != c {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				tokens = append(tokens, token{tokenString, s[i:]})
+				i = len(s)
+			} else {
+				tokens = append(tokens, token{tokenString, s[i : end+1]})
+				i = end + 1
+			}
+		case c == '#' || (c == '-' && i+1 < len(s) && s[i+1] == '-'):
+			tokens = append(tokens, token{tokenComment, s[i:]})
+			i = len(s)
+		case c == '/' && i+1 < len(s) && s[i+1] == '*':
+			end := strings.Index(s[i+2:], "*/")
+			if end == -1 {
+				tokens = append(tokens, token{tokenComment, s[i:]})
+				i = len(s)
+			} else {
+				tokens = append(tokens, token{tokenComment, s[i : i+end+4]})
+				i += end + 4
+			}
+		case c >= '0' && c <= '9' || (c == '.' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9'):
+			end := i + 1
+			for end < len(s) && (isAlphaNumeric(s[end]) || s[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, token{tokenNumber, s[i:end]})
+			i = end
+		case isWordStart(c):
+			end := i + 1
+			for end < len(s) && (isAlphaNumeric(s[end]) || s[end] == '_' || s[end] == '.' || s[end] == '$') {
+				end++
+			}
+			word := strings.ToLower(s[i:end])
+			tokens = append(tokens, classifyWord(word, s[end:]))
+			i = end
+		case c == '(':
+			tokens = append(tokens, token{tokenOpenParen, "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokenCloseParen, ")"})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{tokenComma, ","})
+			i++
+		case c == ';':
+			tokens = append(tokens, token{tokenSemicolon, ";"})
+			i++
+		default:
+			end := i + 1
+			for end < len(s) && isOperatorChar(s[end]) && isOperatorChar(c) {
+				end++
+			}
+			op := s[i:end]
+			if sqlLogicalOperators[op] {
+				tokens = append(tokens, token{tokenLogicalOperator, op})
+			} else {
+				tokens = append(tokens, token{tokenOperator, op})
+			}
+			i = end
+		}
+	}
+	return tokens
+}
+
+func classifyWord(word string, rest string) token {
+	if sqlLogicalOperators[word] {
+		return token{tokenLogicalOperator, word}
+	}
+	if sqlFunctions[word] && strings.HasPrefix(strings.TrimLeft(rest, " \t"), "(") {
+		return token{tokenFunction, word}
+	}
+	if sqlKeywords[word] {
+		return token{tokenKeyword, word}
+	}
+	return token{tokenIdentifier, word}
+}
+
+func isWordStart(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_' || c == '@' || c == '$'
+}
+
+func isAlphaNumeric(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func isOperatorChar(c byte) bool {
+	return strings.IndexByte("=<>!|&^~*/%-:", c) != -1
+}
+
+// sqlContexts are the prefixes used to evaluate the input as if it was injected
+// unquoted, inside a single quoted string or inside a double quoted string.
+var sqlContexts = []string{"", "'", "\""}
+
+// detectSQLi runs the given detector over the input tokenized in every context
+// and returns true if any of them matches.
+func detectSQLi(value string, detector func([]token) bool) bool {
+	if !strings.ContainsAny(value, "'\"`;()=<>|&#-/*") && !containsSQLWord(value) {
+		return false
+	}
+	for _, prefix := range sqlContexts {
+		if prefix != "" && !strings.Contains(value, prefix) {
+			// the input can't break out of a string it doesn't close
+			continue
+		}
+		if detector(tokenizeSQL(prefix + value)) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsSQLWord(value string) bool {
+	lower := strings.ToLower(value)
+	return strings.Contains(lower, "union") || strings.Contains(lower, "select") ||
+		strings.Contains(lower, " or ") || strings.Contains(lower, " and ")
+}
+
+func isOperand(t token) bool {
+	return t.typ == tokenString || t.typ == tokenNumber || t.typ == tokenIdentifier || t.typ == tokenKeyword && t.value == "null"
+}
+
+func isComparison(t token) bool {
+	if t.typ == tokenKeyword {
+		return t.value == "like" || t.value == "is"
+	}
+	if t.typ != tokenOperator {
+		return false
+	}
+	switch t.value {
+	case "=", "==", "<>", "!=", "<", ">", "<=", ">=", "<=>":
+		return true
+	}
+	return false
+}
+
+func unquote(t token) string {
+	v := t.value
+	if t.typ != tokenString || len(v) == 0 {
+		return v
+	}
+	v = v[1:]
+	if len(v) > 0 && (v[len(v)-1] == '\'' || v[len(v)-1] == '"' || v[len(v)-1] == '`') {
+		v = v[:len(v)-1]
+	}
+	return v
+}
+
+// sqliTautology detects boolean conditions that are always true, e.g. ' or 1=1
+// or " or "a"="a. When strict is false any condition chained with a logical
+// operator after a string literal is reported.
+func sqliTautology(strict bool) func([]token) bool {
+	return func(tokens []token) bool {
+		for i := 0; i+3 < len(tokens); i++ {
+			if tokens[i].typ != tokenLogicalOperator {
+				continue
+			}
+			left, cmp, right := tokens[i+1], tokens[i+2], tokens[i+3]
+			if !isOperand(left) || !isComparison(cmp) || !isOperand(right) {
+				continue
+			}
+			if !strict {
+				if i > 0 && (tokens[i-1].typ == tokenString || tokens[i-1].typ == tokenNumber || tokens[i-1].typ == tokenCloseParen) {
+					return true
+				}
+				continue
+			}
+			if left.typ == tokenIdentifier || right.typ == tokenIdentifier {
+				continue
+			}
+			if unquote(left) == unquote(right) || (left.typ == tokenNumber && right.typ == tokenNumber && cmp.value != "=") {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// sqliUnion detects UNION [ALL] SELECT used to append data to the original query.
+func sqliUnion(tokens []token) bool {
+	for i := 0; i+1 < len(tokens); i++ {
+		if tokens[i].typ != tokenKeyword || tokens[i].value != "union" {
+			continue
+		}
+		next := tokens[i+1]
+		if next.typ == tokenKeyword && next.value == "all" && i+2 < len(tokens) {
+			next = tokens[i+2]
+		}
+		for next.typ == tokenOpenParen && i+2 < len(tokens) {
+			i++
+			next = tokens[i+1]
+		}
+		if next.typ == tokenKeyword && next.value == "select" {
+			return true
+		}
+	}
+	return false
+}
+
+// sqliStackedQuery detects a statement terminator followed by a new statement.
+func sqliStackedQuery(tokens []token) bool {
+	for i := 0; i+1 < len(tokens); i++ {
+		if tokens[i].typ == tokenSemicolon && tokens[i+1].typ == tokenKeyword && sqlStatementKeywords[tokens[i+1].value] {
+			return true
+		}
+	}
+	return false
+}
+
+// sqliCommentTermination detects a string break out followed by a comment
+// discarding the rest of the original query, e.g. admin'--
+func sqliCommentTermination(tokens []token) bool {
+	for i := 1; i < len(tokens); i++ {
+		if tokens[i].typ == tokenComment && tokens[i-1].typ == tokenString && len(tokens[i-1].value) > 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// sqliFunction detects calls to functions used in blind or error based injections.
+func sqliFunction(tokens []token) bool {
+	for i := 0; i < len(tokens); i++ {
+		if tokens[i].typ == tokenFunction && i > 0 {
+			prev := tokens[i-1]
+			if prev.typ == tokenLogicalOperator || prev.typ == tokenOperator || prev.typ == tokenSemicolon ||
+				prev.typ == tokenOpenParen || prev.typ == tokenComma || prev.typ == tokenKeyword {
+				return true
+			}
+		}
+		if tokens[i].typ == tokenKeyword && tokens[i].value == "waitfor" && i+1 < len(tokens) && tokens[i+1].value == "delay" {
+			return true
+		}
+	}
+	return false
+}
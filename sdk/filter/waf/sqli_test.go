@@ -0,0 +1,75 @@
+package waf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenizeSQL(t *testing.T) {
+	tokens := tokenizeSQL("'' or 1=1 -- foo")
+	assert.Equal(t, []token{
+		{tokenString, "''"},
+		{tokenLogicalOperator, "or"},
+		{tokenNumber, "1"},
+		{tokenOperator, "="},
+		{tokenNumber, "1"},
+		{tokenComment, "-- foo"},
+	}, tokens)
+
+	tokens = tokenizeSQL("1; SELECT sleep(5)")
+	assert.Equal(t, []token{
+		{tokenNumber, "1"},
+		{tokenSemicolon, ";"},
+		{tokenKeyword, "select"},
+		{tokenFunction, "sleep"},
+		{tokenOpenParen, "("},
+		{tokenNumber, "5"},
+		{tokenCloseParen, ")"},
+	}, tokens)
+}
+
+func TestSQLiDetectors(t *testing.T) {
+	tcs := map[string]struct {
+		detector func([]token) bool
+		attacks  []string
+		benign   []string
+	}{
+		"tautology": {
+			detector: sqliTautology(true),
+			attacks:  []string{"' or 1=1", "admin' OR 'a'='a", "\" or \"x\"=\"x", "1 or 2>1"},
+			benign:   []string{"O'Reilly and sons", "rock and roll", "black or white", "a = b"},
+		},
+		"union": {
+			detector: sqliUnion,
+			attacks:  []string{"1 UNION SELECT password FROM users", "' union all select 1,2--", "1 union (select 1)"},
+			benign:   []string{"european union", "select your plan"},
+		},
+		"stacked query": {
+			detector: sqliStackedQuery,
+			attacks:  []string{"1; DROP TABLE users", "'; exec xp_cmdshell 'dir'"},
+			benign:   []string{"a; b", "hello; world"},
+		},
+		"function": {
+			detector: sqliFunction,
+			attacks:  []string{"1 and sleep(5)", "' or benchmark(1000000,md5(1))", "1; waitfor delay '0:0:5'"},
+			benign:   []string{"sleep well", "user (admin)"},
+		},
+		"comment termination": {
+			detector: sqliCommentTermination,
+			attacks:  []string{"admin'--", "admin'#", "x' /* comment */"},
+			benign:   []string{"first-second", "issue #12"},
+		},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			for _, attack := range tc.attacks {
+				assert.True(t, detectSQLi(attack, tc.detector), "expected detection for %q", attack)
+			}
+			for _, value := range tc.benign {
+				assert.False(t, detectSQLi(value, tc.detector), "unexpected detection for %q", value)
+			}
+		})
+	}
+}
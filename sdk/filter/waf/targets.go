@@ -0,0 +1,204 @@
+package waf // import "github.com/hypertrace/goagent/sdk/filter/waf"
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/filter"
+)
+
+const (
+	httpRequestHeaderPrefix  = "http.request.header."
+	rpcRequestMetadataPrefix = "rpc.request.metadata."
+	// maxDecodingPasses bounds the URL decoding of values encoded multiple times
+	maxDecodingPasses = 3
+)
+
+// target is a piece of the request being inspected, e.g. a query parameter.
+type target struct {
+	name    string
+	raw     string
+	decoded string
+}
+
+func newTarget(name, raw string) target {
+	return target{name: name, raw: raw, decoded: decode(raw)}
+}
+
+// decode reverts the URL and HTML encodings used to evade the signatures.
+func decode(value string) string {
+	decoded := value
+	for i := 0; i < maxDecodingPasses && strings.Contains(decoded, "%"); i++ {
+		d, err := url.PathUnescape(decoded)
+		if err != nil || d == decoded {
+			break
+		}
+		decoded = d
+	}
+	if strings.Contains(decoded, "&") {
+		decoded = html.UnescapeString(decoded)
+	}
+	return decoded
+}
+
+// collectTargets extracts the inspected values from the span attributes. The headers
+// and the body are taken from the request view when they were not captured in the span.
+func collectTargets(attrs sdk.AttributeList, req *filter.Request) []target {
+	var (
+		targets     []target
+		body        string
+		contentType string
+	)
+
+	capturedHeaders := false
+	attrs.Iterate(func(key string, value interface{}) bool {
+		switch {
+		case key == "http.url":
+			targets = append(targets, urlTargets(toString(value))...)
+		case strings.HasPrefix(key, httpRequestHeaderPrefix):
+			name := strings.TrimPrefix(key, httpRequestHeaderPrefix)
+			if name == "content-type" {
+				contentType = toString(value)
+			}
+			targets = append(targets, newTarget("header."+name, toString(value)))
+			capturedHeaders = true
+		case strings.HasPrefix(key, rpcRequestMetadataPrefix):
+			targets = append(targets, newTarget("header."+strings.TrimPrefix(key, rpcRequestMetadataPrefix), toString(value)))
+			capturedHeaders = true
+		case key == "http.request.body", key == "rpc.request.body":
+			body = toString(value)
+		}
+		return true
+	})
+
+	// e.g. for the requests excluded from the data capture
+	if !capturedHeaders && req != nil && req.Headers != nil {
+		_ = req.Headers.ForEachHeader(func(key string, values []string) error {
+			name := strings.ToLower(key)
+			if name == "content-type" && len(values) > 0 {
+				contentType = values[0]
+			}
+			for _, value := range values {
+				targets = append(targets, newTarget("header."+name, value))
+			}
+			return nil
+		})
+	}
+
+	if body == "" && req != nil {
+		if b, err := req.Body(); err == nil {
+			body = string(b)
+		}
+	}
+
+	if body != "" {
+		targets = append(targets, bodyTargets(body, contentType)...)
+	}
+
+	// attributes have no order, sorting keeps the reported detections stable
+	sort.SliceStable(targets, func(i, j int) bool { return targets[i].name < targets[j].name })
+	return targets
+}
+
+// urlTargets returns the path and every query parameter name and value.
+func urlTargets(rawURL string) []target {
+	rawPath, rawQuery, _ := strings.Cut(rawURL, "?")
+	if u, err := url.Parse(rawURL); err == nil {
+		rawPath = u.EscapedPath()
+	}
+
+	targets := []target{newTarget("url.path", rawPath)}
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(pair, "=")
+		name := strings.ReplaceAll(key, "+", " ")
+		if k, err := url.QueryUnescape(key); err == nil {
+			name = k
+		}
+		targets = append(targets,
+			newTarget("query_key."+name, key),
+			newTarget("query."+name, strings.ReplaceAll(value, "+", " ")),
+		)
+	}
+	return targets
+}
+
+// bodyTargets inspects the leaf values (and keys) of JSON and form bodies and the
+// whole body otherwise.
+func bodyTargets(body, contentType string) []target {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(body), &doc); err == nil {
+		var targets []target
+		walkJSON("body", doc, &targets)
+		return targets
+	}
+
+	if strings.Contains(strings.ToLower(contentType), "application/x-www-form-urlencoded") {
+		if values, err := url.ParseQuery(body); err == nil {
+			var targets []target
+			for key, vs := range values {
+				targets = append(targets, newTarget("body_key."+key, key))
+				for _, v := range vs {
+					targets = append(targets, newTarget("body."+key, v))
+				}
+			}
+			return targets
+		}
+	}
+
+	return []target{newTarget("body", body)}
+}
+
+func walkJSON(name string, value interface{}, targets *[]target) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			*targets = append(*targets, newTarget("body_key."+key, key))
+			walkJSON(name+"."+key, child, targets)
+		}
+	case []interface{}:
+		for _, child := range v {
+			walkJSON(name, child, targets)
+		}
+	case string:
+		*targets = append(*targets, newTarget(name, v))
+	}
+}
+
+// routeOf returns the route the exclusions are matched against.
+func routeOf(attrs sdk.AttributeList, req *filter.Request) string {
+	if req != nil && req.Route != "" {
+		return req.Route
+	}
+
+	if service, method := toString(attrs.GetValue("rpc.service")), toString(attrs.GetValue("rpc.method")); service != "" {
+		return "/" + service + "/" + method
+	}
+
+	if rawURL := toString(attrs.GetValue("http.url")); rawURL != "" {
+		if u, err := url.Parse(rawURL); err == nil {
+			return u.Path
+		}
+	}
+	return ""
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []string:
+		return strings.Join(v, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
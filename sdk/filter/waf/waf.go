@@ -0,0 +1,188 @@
+package waf // import "github.com/hypertrace/goagent/sdk/filter/waf"
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/filter"
+	"github.com/hypertrace/goagent/sdk/filter/result"
+)
+
+// Mode tells whether the detections block the request or are only recorded.
+type Mode int
+
+const (
+	// DetectOnly records the detections in the span and lets the request continue.
+	DetectOnly Mode = iota
+	// Block records the first detection in the span and blocks the request.
+	Block
+)
+
+const (
+	defaultParanoiaLevel   = 1
+	maxParanoiaLevel       = 4
+	defaultBlockStatusCode = 403
+)
+
+// Exclusion disables rules or inspected targets for a route.
+type Exclusion struct {
+	// Route is matched against the route template, the URL path or the gRPC full
+	// method (e.g. /grpc.health.v1.Health/*) using the path.Match syntax
+	Route string
+	// RuleIDs lists the excluded rules (e.g. sqli-tautology), all the rules are
+	// excluded when both RuleIDs and Targets are empty
+	RuleIDs []string
+	// Targets lists the excluded targets using the path.Match syntax (e.g.
+	// header.cookie, query.*, body.comment)
+	Targets []string
+}
+
+// Options holds the options for the attack detection filter
+type Options struct {
+	// Mode defaults to DetectOnly
+	Mode Mode
+	// ParanoiaLevel from 1 to 4, higher levels run more rules at the cost of more
+	// false positives, defaults to 1
+	ParanoiaLevel int
+	// Exclusions per route
+	Exclusions []Exclusion
+	// BlockStatusCode is the status code returned when blocking, defaults to 403
+	BlockStatusCode int32
+}
+
+// Filter inspects the URL, query parameters, headers and body of the request for
+// SQL injection, XSS and path traversal signatures. Detections are recorded in the
+// span as `waf.detection` events.
+type Filter struct {
+	opts  Options
+	rules []rule
+}
+
+var _ filter.ContextFilter = (*Filter)(nil)
+
+// NewFilter creates an attack detection filter
+func NewFilter(opts Options) *Filter {
+	if opts.ParanoiaLevel <= 0 {
+		opts.ParanoiaLevel = defaultParanoiaLevel
+	}
+	if opts.ParanoiaLevel > maxParanoiaLevel {
+		opts.ParanoiaLevel = maxParanoiaLevel
+	}
+	if opts.BlockStatusCode == 0 {
+		opts.BlockStatusCode = defaultBlockStatusCode
+	}
+
+	var enabled []rule
+	for _, r := range rules {
+		if r.paranoiaLevel <= opts.ParanoiaLevel {
+			enabled = append(enabled, r)
+		}
+	}
+
+	return &Filter{opts: opts, rules: enabled}
+}
+
+// Evaluate inspects the request data captured in the span.
+func (f *Filter) Evaluate(span sdk.Span) result.FilterResult {
+	return f.EvaluateWithContext(context.Background(), span, nil)
+}
+
+// EvaluateWithContext inspects the request data captured in the span, the request
+// route and body are taken from the request view when available.
+func (f *Filter) EvaluateWithContext(_ context.Context, span sdk.Span, req *filter.Request) result.FilterResult {
+	if span == nil || span.IsNoop() {
+		return result.FilterResult{}
+	}
+
+	attrs := span.GetAttributes()
+	excludedRules, excludedTargets, excludeAll := f.exclusionsFor(routeOf(attrs, req))
+	if excludeAll {
+		return result.FilterResult{}
+	}
+
+	reported := map[string]bool{}
+	for _, t := range collectTargets(attrs, req) {
+		if matchesAny(excludedTargets, t.name) {
+			continue
+		}
+		for _, r := range f.rules {
+			if excludedRules[r.id] {
+				continue
+			}
+			value := t.decoded
+			if r.raw {
+				value = t.raw
+			}
+			if !r.detect(value) {
+				continue
+			}
+
+			key := r.id + "|" + t.name
+			if reported[key] {
+				continue
+			}
+			reported[key] = true
+
+			f.recordDetection(span, r, t.name)
+			if f.opts.Mode == Block {
+				return result.FilterResult{Block: true, ResponseStatusCode: f.opts.BlockStatusCode}
+			}
+		}
+	}
+
+	return result.FilterResult{}
+}
+
+func (f *Filter) recordDetection(span sdk.Span, r rule, target string) {
+	action := "detected"
+	if f.opts.Mode == Block {
+		action = "blocked"
+	}
+	span.AddEvent("waf.detection", time.Now(), map[string]interface{}{
+		"waf.rule.id":             r.id,
+		"waf.rule.category":       string(r.category),
+		"waf.rule.paranoia_level": r.paranoiaLevel,
+		"waf.target":              target,
+		"waf.action":              action,
+	})
+}
+
+// exclusionsFor returns the rules and targets excluded for the route, or true
+// when the whole route is excluded.
+func (f *Filter) exclusionsFor(route string) (map[string]bool, []string, bool) {
+	if route == "" || len(f.opts.Exclusions) == 0 {
+		return nil, nil, false
+	}
+
+	var (
+		excludedRules   map[string]bool
+		excludedTargets []string
+	)
+	for _, e := range f.opts.Exclusions {
+		if ok, _ := path.Match(e.Route, route); !ok {
+			continue
+		}
+		if len(e.RuleIDs) == 0 && len(e.Targets) == 0 {
+			return nil, nil, true
+		}
+		for _, id := range e.RuleIDs {
+			if excludedRules == nil {
+				excludedRules = map[string]bool{}
+			}
+			excludedRules[id] = true
+		}
+		excludedTargets = append(excludedTargets, e.Targets...)
+	}
+	return excludedRules, excludedTargets, false
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,197 @@
+package waf
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/hypertrace/goagent/sdk/filter"
+	sdkhttp "github.com/hypertrace/goagent/sdk/instrumentation/net/http"
+	"github.com/hypertrace/goagent/sdk/internal/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSpan(attrs map[string]interface{}) *mock.Span {
+	span := mock.NewSpan()
+	for k, v := range attrs {
+		span.SetAttribute(k, v)
+	}
+	return span
+}
+
+func TestFilterBlocksAttacks(t *testing.T) {
+	tcs := map[string]struct {
+		attrs    map[string]interface{}
+		ruleID   string
+		targetID string
+	}{
+		"sqli in query": {
+			attrs:    map[string]interface{}{"http.url": "http://localhost/users?id=1%27%20UNION%20SELECT%20password%20FROM%20users--"},
+			ruleID:   "sqli-union",
+			targetID: "query.id",
+		},
+		"double encoded xss in query": {
+			attrs:    map[string]interface{}{"http.url": "/search?q=%253Cscript%253Ealert(1)%253C%252Fscript%253E"},
+			ruleID:   "xss-script-tag",
+			targetID: "query.q",
+		},
+		"xss in json body": {
+			attrs: map[string]interface{}{
+				"http.url":          "/comments",
+				"http.request.body": `{"comment":{"text":"<img src=x onerror=alert(1)>"}}`,
+			},
+			ruleID:   "xss-event-handler",
+			targetID: "body.comment.text",
+		},
+		"path traversal in path": {
+			attrs:    map[string]interface{}{"http.url": "/static/../../etc/passwd"},
+			ruleID:   "path-traversal-dot-dot",
+			targetID: "url.path",
+		},
+		"encoded path traversal in query": {
+			attrs:    map[string]interface{}{"http.url": "/download?file=..%252f..%252fetc%252fpasswd"},
+			ruleID:   "path-traversal-dot-dot",
+			targetID: "query.file",
+		},
+		"sqli in header": {
+			attrs:    map[string]interface{}{"http.request.header.x-user": "admin' or '1'='1"},
+			ruleID:   "sqli-tautology",
+			targetID: "header.x-user",
+		},
+		"sqli in form body": {
+			attrs: map[string]interface{}{
+				"http.request.header.content-type": "application/x-www-form-urlencoded",
+				"http.request.body":                "user=admin&password=x%27%3B%20DROP%20TABLE%20users",
+			},
+			ruleID:   "sqli-stacked-query",
+			targetID: "body.password",
+		},
+		"sqli in rpc body": {
+			attrs: map[string]interface{}{
+				"rpc.service":      "helloworld.Greeter",
+				"rpc.method":       "SayHello",
+				"rpc.request.body": `{"name":"1 AND sleep(5)"}`,
+			},
+			ruleID:   "sqli-function",
+			targetID: "body.name",
+		},
+	}
+
+	f := NewFilter(Options{Mode: Block})
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			span := newSpan(tc.attrs)
+			res := f.Evaluate(span)
+			assert.True(t, res.Block)
+			assert.Equal(t, int32(403), res.ResponseStatusCode)
+
+			event, ok := span.ReadEvent("waf.detection")
+			require.True(t, ok)
+			assert.Equal(t, tc.ruleID, event["waf.rule.id"])
+			assert.Equal(t, tc.targetID, event["waf.target"])
+			assert.Equal(t, "blocked", event["waf.action"])
+		})
+	}
+}
+
+func TestFilterLetsBenignRequestsThrough(t *testing.T) {
+	f := NewFilter(Options{Mode: Block})
+
+	span := newSpan(map[string]interface{}{
+		"http.url":                    "http://localhost/users/123?name=O%27Reilly&sort=name,-created&q=rock+and+roll",
+		"http.request.header.accept":  "text/html,application/xhtml+xml,*/*;q=0.8",
+		"http.request.header.cookie":  "session=abc; theme=dark",
+		"http.request.header.referer": "https://example.com/page?a=1&b=2",
+		"http.request.body":           `{"title":"Tom & Jerry","tags":["a","b"],"description":"1 + 1 = 2; obviously"}`,
+	})
+	assert.False(t, f.Evaluate(span).Block)
+	_, ok := span.ReadEvent("waf.detection")
+	assert.False(t, ok)
+}
+
+func TestFilterDetectOnly(t *testing.T) {
+	f := NewFilter(Options{})
+
+	span := newSpan(map[string]interface{}{
+		"http.url": "/items?id=1;DROP+TABLE+items&redirect=javascript:alert(1)",
+	})
+	assert.False(t, f.Evaluate(span).Block)
+
+	// all detections are recorded
+	events := span.ReadEvents("waf.detection")
+	require.Len(t, events, 2)
+	assert.Equal(t, "detected", events[0]["waf.action"])
+	assert.Equal(t, "sqli-stacked-query", events[0]["waf.rule.id"])
+	assert.Equal(t, "xss-javascript-uri", events[1]["waf.rule.id"])
+}
+
+func TestFilterParanoiaLevel(t *testing.T) {
+	span := newSpan(map[string]interface{}{"http.url": "/profile?bio=%3Cb%3Ehello%3C%2Fb%3E"})
+	assert.False(t, NewFilter(Options{Mode: Block}).Evaluate(span).Block)
+	assert.True(t, NewFilter(Options{Mode: Block, ParanoiaLevel: 3}).Evaluate(span).Block)
+
+	event, ok := span.ReadEvent("waf.detection")
+	require.True(t, ok)
+	assert.Equal(t, "xss-html-tag", event["waf.rule.id"])
+	assert.Equal(t, 3, event["waf.rule.paranoia_level"])
+}
+
+func TestFilterExclusions(t *testing.T) {
+	f := NewFilter(Options{
+		Mode: Block,
+		Exclusions: []Exclusion{
+			{Route: "/grpc.health.v1.Health/*"},
+			{Route: "/articles/{id}", Targets: []string{"body.content"}},
+			{Route: "/search", RuleIDs: []string{"sqli-tautology"}},
+		},
+	})
+
+	span := newSpan(map[string]interface{}{
+		"rpc.service":                      "grpc.health.v1.Health",
+		"rpc.method":                       "Check",
+		"rpc.request.metadata.x-forwarded": "' or 1=1",
+	})
+	assert.False(t, f.Evaluate(span).Block)
+
+	req := filter.NewRequest("POST", "/articles/{id}", "", nil, nil)
+	span = newSpan(map[string]interface{}{
+		"http.url":          "/articles/1",
+		"http.request.body": `{"content":"<script>alert(1)</script>"}`,
+	})
+	assert.False(t, f.EvaluateWithContext(context.Background(), span, req).Block)
+
+	span = newSpan(map[string]interface{}{
+		"http.url":          "/articles/1",
+		"http.request.body": `{"title":"<script>alert(1)</script>"}`,
+	})
+	assert.True(t, f.EvaluateWithContext(context.Background(), span, req).Block)
+
+	span = newSpan(map[string]interface{}{"http.url": "/search?q=%27+or+1%3D1"})
+	assert.False(t, f.Evaluate(span).Block)
+
+	span = newSpan(map[string]interface{}{"http.url": "/search?q=1+union+select+1"})
+	assert.True(t, f.Evaluate(span).Block)
+}
+
+func TestFilterReadsBodyFromRequest(t *testing.T) {
+	f := NewFilter(Options{Mode: Block})
+
+	req := filter.NewRequest("POST", "", "", nil, func() ([]byte, error) {
+		return []byte("../../etc/passwd"), nil
+	})
+	assert.True(t, f.EvaluateWithContext(context.Background(), newSpan(nil), req).Block)
+}
+
+func TestFilterReadsHeadersFromRequest(t *testing.T) {
+	f := NewFilter(Options{Mode: Block})
+
+	// the headers aren't captured in the span, e.g. for the excluded requests
+	headers := sdkhttp.NewHeaderMapAccessor(http.Header{"User-Agent": {"<script>alert(1)</script>"}})
+	span := newSpan(nil)
+	assert.True(t, f.EvaluateWithContext(context.Background(), span, filter.NewRequest("GET", "", "", headers, nil)).Block)
+
+	attrs, ok := span.ReadEvent("waf.detection")
+	require.True(t, ok)
+	assert.Equal(t, "header.user-agent", attrs["waf.target"])
+}
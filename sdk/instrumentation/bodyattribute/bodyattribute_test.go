@@ -30,6 +30,17 @@ func TestBodyTruncationEmptyBody(t *testing.T) {
 	assert.Zero(t, s.RemainingAttributes())
 }
 
+func TestTruncateBody(t *testing.T) {
+	body, truncated := TruncateBody([]byte("text"), 7)
+	assert.Equal(t, []byte("text"), body)
+	assert.False(t, truncated)
+
+	// does not split the two bytes rune
+	body, truncated = TruncateBody([]byte("teñt"), 3)
+	assert.Equal(t, []byte("te"), body)
+	assert.True(t, truncated)
+}
+
 func TestSetTruncatedEncodedBodyAttributeNoTruncation(t *testing.T) {
 	s := mock.NewSpan()
 	SetTruncatedEncodedBodyAttribute("http.request.body", []byte("text"), 7, s)
@@ -23,7 +23,8 @@ type interceptor struct {
 
 func setError(s sdk.Span, err error) {
 	if err != nil {
-		s.SetError(err)
+		// the stack trace starts at the interceptor method rather than at this helper
+		s.SetError(err, sdk.WithCallerSkip(1))
 		s.SetStatus(sdk.StatusCodeError, "")
 	} else {
 		s.SetStatus(sdk.StatusCodeOk, "")
@@ -0,0 +1,68 @@
+package grpc // import "github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc"
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/hypertrace/goagent/sdk"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+)
+
+// attemptCounter numbers the attempts of an RPC. grpc-go tags every attempt of a call,
+// including the retries and hedged calls, from the same call context, so the counter is
+// shared by all of them.
+type attemptCounter struct {
+	attempts int64
+}
+
+type attemptCounterKey struct{}
+
+func contextWithAttemptCounter(ctx context.Context) context.Context {
+	return context.WithValue(ctx, attemptCounterKey{}, &attemptCounter{})
+}
+
+// nextAttempt returns the number of the attempt starting, 0 when the attempts are not counted.
+func nextAttempt(ctx context.Context) int64 {
+	counter, ok := ctx.Value(attemptCounterKey{}).(*attemptCounter)
+	if !ok {
+		return 0
+	}
+	return atomic.AddInt64(&counter.attempts, 1)
+}
+
+// UnaryClientAttemptsInterceptor numbers the attempts of the unary RPCs recorded by the
+// client stats handler returned by WrapStatsHandler.
+func UnaryClientAttemptsInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(contextWithAttemptCounter(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientAttemptsInterceptor numbers the attempts of the streaming RPCs recorded by
+// the client stats handler returned by WrapStatsHandler.
+func StreamClientAttemptsInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(contextWithAttemptCounter(ctx), desc, cc, method, opts...)
+	}
+}
+
+// setAttemptAttributes records the attempt of a client RPC. Every attempt has its own
+// span when the delegate stats handler starts the spans in TagRPC.
+func setAttemptAttributes(ctx context.Context, rs stats.RPCStats, span sdk.Span) {
+	switch rs := rs.(type) {
+	case *stats.Begin:
+		if attempt := nextAttempt(ctx); attempt > 0 {
+			span.SetAttribute("rpc.grpc.attempt.number", attempt)
+		}
+		span.SetAttribute("rpc.grpc.attempt.transparent_retry", rs.IsTransparentRetryAttempt)
+	case *stats.OutHeader:
+		if rs.RemoteAddr != nil {
+			span.SetAttribute("rpc.grpc.attempt.peer.address", rs.RemoteAddr.String())
+		}
+	case *stats.End:
+		span.SetAttribute("rpc.grpc.attempt.duration_ms", float64(rs.EndTime.Sub(rs.BeginTime).Microseconds())/1000)
+		span.SetAttribute("rpc.grpc.attempt.status_code", int64(status.Code(rs.Error)))
+	}
+}
@@ -0,0 +1,165 @@
+package grpc
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc/internal/helloworld"
+	internalconfig "github.com/hypertrace/goagent/sdk/internal/config"
+	"github.com/hypertrace/goagent/sdk/internal/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+const retryServiceConfig = `{
+  "methodConfig": [{
+    "name": [{"service": "helloworld.Greeter"}],
+    "retryPolicy": {
+      "maxAttempts": 3,
+      "initialBackoff": "0.01s",
+      "maxBackoff": "0.01s",
+      "backoffMultiplier": 1.0,
+      "retryableStatusCodes": ["UNAVAILABLE"]
+    }
+  }]
+}`
+
+// flakyServer fails the first calls before sending any header so they can be retried.
+type flakyServer struct {
+	failures int
+	*helloworld.UnimplementedGreeterServer
+}
+
+func (s *flakyServer) SayHello(_ context.Context, req *helloworld.HelloRequest) (*helloworld.HelloReply, error) {
+	if s.failures > 0 {
+		s.failures--
+		return nil, status.Error(codes.Unavailable, "try again")
+	}
+	return &helloworld.HelloReply{Message: "Hello " + req.GetName()}, nil
+}
+
+func TestClientHandlerRecordsAttempts(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	s := grpc.NewServer()
+	defer s.Stop()
+	helloworld.RegisterGreeterServer(s, &flakyServer{failures: 2})
+
+	mockHandler := &mockHandler{}
+	conn, err := grpc.NewClient(
+		"passthrough:///bufnet",
+		grpc.WithContextDialer(createDialer(s)),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultServiceConfig(retryServiceConfig),
+		grpc.WithStatsHandler(WrapStatsHandler(mockHandler, mock.SpanFromContext, &Options{})),
+		grpc.WithUnaryInterceptor(UnaryClientAttemptsInterceptor()),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = helloworld.NewGreeterClient(conn).SayHello(context.Background(), &helloworld.HelloRequest{Name: "Pupo"})
+	require.NoError(t, err)
+
+	require.Equal(t, 3, len(mockHandler.Spans))
+	for i, span := range mockHandler.Spans {
+		assert.Equal(t, int64(i+1), span.ReadAttribute("rpc.grpc.attempt.number"))
+		assert.Equal(t, false, span.ReadAttribute("rpc.grpc.attempt.transparent_retry"))
+		assert.Equal(t, "bufconn", span.ReadAttribute("rpc.grpc.attempt.peer.address"))
+		assert.GreaterOrEqual(t, span.ReadAttribute("rpc.grpc.attempt.duration_ms"), float64(0))
+	}
+
+	assert.Equal(t, int64(codes.Unavailable), mockHandler.Spans[0].ReadAttribute("rpc.grpc.attempt.status_code"))
+	assert.Equal(t, int64(codes.Unavailable), mockHandler.Spans[1].ReadAttribute("rpc.grpc.attempt.status_code"))
+	assert.Equal(t, int64(codes.OK), mockHandler.Spans[2].ReadAttribute("rpc.grpc.attempt.status_code"))
+}
+
+func TestClientHandlerAttemptsAreNotNumberedWithoutInterceptor(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	s := grpc.NewServer()
+	defer s.Stop()
+	helloworld.RegisterGreeterServer(s, &flakyServer{})
+
+	mockHandler := &mockHandler{}
+	conn, err := grpc.NewClient(
+		"passthrough:///bufnet",
+		grpc.WithContextDialer(createDialer(s)),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(WrapStatsHandler(mockHandler, mock.SpanFromContext, &Options{})),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = helloworld.NewGreeterClient(conn).SayHello(context.Background(), &helloworld.HelloRequest{Name: "Pupo"})
+	require.NoError(t, err)
+
+	require.Equal(t, 1, len(mockHandler.Spans))
+	assert.Nil(t, mockHandler.Spans[0].ReadAttribute("rpc.grpc.attempt.number"))
+	assert.Equal(t, int64(codes.OK), mockHandler.Spans[0].ReadAttribute("rpc.grpc.attempt.status_code"))
+}
+
+func TestClientConnStats(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	s := grpc.NewServer()
+	helloworld.RegisterGreeterServer(s, &flakyServer{})
+
+	var (
+		mux   sync.Mutex
+		spans []*mock.Span
+	)
+	startSpan := func(ctx context.Context, name string, opts *sdk.SpanOptions) (context.Context, sdk.Span, func()) {
+		ctx, span, end := mock.StartSpan(ctx, name, opts)
+		mux.Lock()
+		spans = append(spans, span.(*mock.Span))
+		mux.Unlock()
+		return ctx, span, end
+	}
+
+	connStats := WrapClientConnStats(&mockHandler{}, startSpan)
+	conn, err := grpc.NewClient(
+		"passthrough:///bufnet",
+		grpc.WithContextDialer(createDialer(s)),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(connStats),
+	)
+	require.NoError(t, err)
+
+	watched := make(chan struct{})
+	go func() {
+		connStats.Watch(context.Background(), conn)
+		close(watched)
+	}()
+
+	_, err = helloworld.NewGreeterClient(conn).SayHello(context.Background(), &helloworld.HelloRequest{Name: "Pupo"})
+	require.NoError(t, err)
+
+	require.NoError(t, conn.Close())
+	<-watched
+	s.Stop()
+
+	mux.Lock()
+	defer mux.Unlock()
+
+	events := map[string][]*mock.Span{}
+	for _, span := range spans {
+		assert.Equal(t, "grpc.client.connection", span.Name)
+		event := span.ReadAttribute("rpc.grpc.connection.event").(string)
+		events[event] = append(events[event], span)
+	}
+
+	require.Len(t, events["connect"], 1)
+	assert.Equal(t, "bufconn", events["connect"][0].ReadAttribute("rpc.grpc.connection.remote_address"))
+
+	require.NotEmpty(t, events["state_change"])
+	last := events["state_change"][len(events["state_change"])-1]
+	assert.Equal(t, connectivity.Shutdown.String(), last.ReadAttribute("rpc.grpc.connectivity.state"))
+	assert.Equal(t, "passthrough:///bufnet", last.ReadAttribute("rpc.grpc.connection.target"))
+}
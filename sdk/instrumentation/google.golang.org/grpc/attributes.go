@@ -3,8 +3,11 @@ package grpc // import "github.com/hypertrace/goagent/sdk/instrumentation/google
 import (
 	"context"
 	"fmt"
+	"sync"
 
 	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/filter"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 )
 
@@ -38,3 +41,99 @@ func setAttributesFromRequestIncomingMetadata(ctx context.Context, span sdk.Span
 		setAttributesFromMetadata("request", md, span)
 	}
 }
+
+// metadataRecorder keeps a copy of the header and trailer set by a server handler so
+// they can be recorded once the handler returns, including when it fails.
+type metadataRecorder struct {
+	mux     sync.Mutex
+	header  metadata.MD
+	trailer metadata.MD
+}
+
+func (r *metadataRecorder) recordHeader(md metadata.MD) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.header = metadata.Join(r.header, md)
+}
+
+func (r *metadataRecorder) recordTrailer(md metadata.MD) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.trailer = metadata.Join(r.trailer, md)
+}
+
+// setAttributes records the metadata as response attributes, it is a noop on a nil recorder.
+func (r *metadataRecorder) setAttributes(span sdk.Span) {
+	if r == nil {
+		return
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	setAttributesFromMetadata("response", r.header, span)
+	setAttributesFromMetadata("response", r.trailer, span)
+}
+
+// recordingTransportStream intercepts the metadata set through grpc.SetHeader,
+// grpc.SendHeader and grpc.SetTrailer in unary handlers.
+type recordingTransportStream struct {
+	grpc.ServerTransportStream
+	recorder *metadataRecorder
+}
+
+func (s *recordingTransportStream) SetHeader(md metadata.MD) error {
+	err := s.ServerTransportStream.SetHeader(md)
+	if err == nil {
+		s.recorder.recordHeader(md)
+	}
+	return err
+}
+
+func (s *recordingTransportStream) SendHeader(md metadata.MD) error {
+	err := s.ServerTransportStream.SendHeader(md)
+	if err == nil {
+		s.recorder.recordHeader(md)
+	}
+	return err
+}
+
+func (s *recordingTransportStream) SetTrailer(md metadata.MD) error {
+	err := s.ServerTransportStream.SetTrailer(md)
+	if err == nil {
+		s.recorder.recordTrailer(md)
+	}
+	return err
+}
+
+// contextWithMetadataRecorder returns a context whose transport stream records the response
+// metadata. The recorder is nil when there is no transport stream in the context.
+func contextWithMetadataRecorder(ctx context.Context) (context.Context, *metadataRecorder) {
+	ts := grpc.ServerTransportStreamFromContext(ctx)
+	if ts == nil {
+		return ctx, nil
+	}
+	recorder := &metadataRecorder{}
+	return grpc.NewContextWithServerTransportStream(ctx, &recordingTransportStream{ts, recorder}), recorder
+}
+
+// metadataAccessor allows accessing gRPC metadata as headers.
+type metadataAccessor struct {
+	md metadata.MD
+}
+
+// NewMetadataAccessor returns a filter.HeaderAccessor for the gRPC metadata
+func NewMetadataAccessor(md metadata.MD) filter.HeaderAccessor {
+	return &metadataAccessor{md}
+}
+
+func (a *metadataAccessor) Lookup(key string) []string {
+	return a.md.Get(key)
+}
+
+func (a *metadataAccessor) ForEachHeader(callback func(key string, values []string) error) error {
+	for key, values := range a.md {
+		if err := callback(key, values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,11 +2,10 @@ package grpc // import "github.com/hypertrace/goagent/sdk/instrumentation/google
 
 import (
 	"context"
-	"strings"
 
 	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/filter"
 	internalconfig "github.com/hypertrace/goagent/sdk/internal/config"
-	"github.com/hypertrace/goagent/sdk/internal/container"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 )
@@ -14,18 +13,16 @@ import (
 // WrapUnaryClientInterceptor returns an interceptor that records the request and response message's body
 // and serialize it as JSON.
 func WrapUnaryClientInterceptor(delegateInterceptor grpc.UnaryClientInterceptor, spanFromContext sdk.SpanFromContext,
-	spanAttributes map[string]string) grpc.UnaryClientInterceptor {
-	defaultAttributes := map[string]string{
-		"rpc.system": "grpc",
-	}
-	for k, v := range spanAttributes {
-		defaultAttributes[k] = v
-	}
-	if containerID, err := container.GetID(); err == nil {
-		defaultAttributes["container_id"] = containerID
-	}
+	options *Options, spanAttributes map[string]string, mh sdk.RpcOperationMetricsHandler) grpc.UnaryClientInterceptor {
+	defaultAttributes := newDefaultAttributes(spanAttributes)
 
 	dataCaptureConfig := internalconfig.GetConfig().GetDataCapture()
+	marshaler := newMessageMarshaler(options)
+
+	var f filter.Filter = &filter.NoopFilter{}
+	if options != nil && options.Filter != nil {
+		f = options.Filter
+	}
 
 	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
 		var header metadata.MD
@@ -43,34 +40,51 @@ func WrapUnaryClientInterceptor(delegateInterceptor grpc.UnaryClientInterceptor,
 				// round tripper.
 				return invoker(ctx, method, req, reply, cc, opts...)
 			}
-			for key, value := range defaultAttributes {
-				span.SetAttribute(key, value)
-			}
 
-			pieces := strings.Split(method[1:], "/")
-			span.SetAttribute("rpc.service", pieces[0])
-			span.SetAttribute("rpc.method", pieces[1])
+			excluded := options != nil && isExcludedClientRPC(options.Exclusions, method)
+			if !excluded {
+				for key, value := range defaultAttributes {
+					span.SetAttribute(key, value)
+				}
 
-			reqBody, err := marshalMessageableJSON(req)
-			if dataCaptureConfig.RpcBody.Request.Value && len(reqBody) > 0 && err == nil {
-				setTruncatedBodyAttribute("request", reqBody, int(dataCaptureConfig.BodyMaxSizeBytes.Value), span)
+				setMethodAttributes(method, span)
+
+				reqBody, err := marshaler.marshal(ctx, method, "request", req)
+				if dataCaptureConfig.RpcBody.Request.Value && len(reqBody) > 0 && err == nil {
+					setTruncatedBodyAttribute("request", reqBody, int(dataCaptureConfig.BodyMaxSizeBytes.Value), span)
+				}
+
+				if dataCaptureConfig.RpcMetadata.Request.Value {
+					setAttributesFromRequestOutgoingMetadata(ctx, span)
+				}
 			}
 
-			if dataCaptureConfig.RpcMetadata.Request.Value {
-				setAttributesFromRequestOutgoingMetadata(ctx, span)
+			// single evaluation call to filter after capturing the configured parameters
+			filterResult := filter.EvaluateRequest(ctx, f, span, newClientFilterRequest(ctx, method, cc, req, marshaler))
+			if filterResult.Block {
+				return blockedError(filterResult)
+			} else if filterResult.Decorations != nil {
+				md, _ := metadata.FromOutgoingContext(ctx)
+				ctx = metadata.NewOutgoingContext(ctx, applyDecorations(md, filterResult.Decorations, span))
 			}
 
-			err = invoker(ctx, method, req, reply, cc, opts...)
-			if err != nil {
-				return err
+			if excluded {
+				return invoker(ctx, method, req, reply, cc, opts...)
 			}
 
+			err := invoker(ctx, method, req, reply, cc, opts...)
+			// header and trailer are available on failures as well
 			if dataCaptureConfig.RpcMetadata.Response.Value {
 				setAttributesFromMetadata("response", header, span)
 				setAttributesFromMetadata("response", trailer, span)
 			}
 
-			resBody, err := marshalMessageableJSON(reply)
+			if err != nil {
+				setErrorAttributes(err, span, int(dataCaptureConfig.BodyMaxSizeBytes.Value))
+				return err
+			}
+
+			resBody, err := marshaler.marshal(ctx, method, "response", reply)
 			if dataCaptureConfig.RpcBody.Response.Value && len(resBody) > 0 && err == nil {
 				setTruncatedBodyAttribute("response", resBody, int(dataCaptureConfig.BodyMaxSizeBytes.Value), span)
 			}
@@ -82,6 +96,28 @@ func WrapUnaryClientInterceptor(delegateInterceptor grpc.UnaryClientInterceptor,
 		// in all the headers and trailers registered.
 		opts = append(opts, grpc.Header(&header), grpc.Trailer(&trailer))
 
-		return delegateInterceptor(ctx, method, req, reply, cc, wrappedInvoker, opts...)
+		metrics := newRPCMetrics(mh, method, true)
+		metrics.addRequest(req)
+		err := delegateInterceptor(ctx, method, req, reply, cc, wrappedInvoker, opts...)
+		if err == nil {
+			metrics.addResponse(reply)
+		}
+		metrics.record(ctx, err)
+		return err
+	}
+}
+
+// newClientFilterRequest builds the request view passed to filters implementing filter.ContextFilter.
+// The peer is the target of the client connection.
+func newClientFilterRequest(ctx context.Context, fullMethod string, cc *grpc.ClientConn, req interface{}, marshaler *messageMarshaler) *filter.Request {
+	target := ""
+	if cc != nil {
+		target = cc.Target()
 	}
+
+	md, _ := metadata.FromOutgoingContext(ctx)
+
+	return filter.NewRequest(fullMethod, fullMethod, target, NewMetadataAccessor(md), func() ([]byte, error) {
+		return marshaler.marshal(ctx, fullMethod, "request", req)
+	})
 }
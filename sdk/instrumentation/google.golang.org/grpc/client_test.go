@@ -6,12 +6,17 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/filter"
+	"github.com/hypertrace/goagent/sdk/filter/result"
 	"github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc/internal/helloworld"
 	"github.com/hypertrace/goagent/sdk/internal/mock"
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 func makeMockUnaryClientInterceptor(mockSpans *[]*mock.Span) grpc.UnaryClientInterceptor {
@@ -46,7 +51,9 @@ func TestUnaryClientHelloWorldSuccess(t *testing.T) {
 			WrapUnaryClientInterceptor(
 				makeMockUnaryClientInterceptor(&spans),
 				mock.SpanFromContext,
+				&Options{},
 				map[string]string{"foo": "bar"},
+				nil,
 			),
 		),
 	)
@@ -120,7 +127,7 @@ func TestClientHandlerHelloWorldSuccess(t *testing.T) {
 		"bufnet",
 		grpc.WithContextDialer(dialer),
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithStatsHandler(WrapStatsHandler(mockHandler, mock.SpanFromContext)),
+		grpc.WithStatsHandler(WrapStatsHandler(mockHandler, mock.SpanFromContext, &Options{})),
 	)
 	if err != nil {
 		t.Fatalf("failed to dial bufnet: %v", err)
@@ -191,7 +198,9 @@ func TestBodyTruncation(t *testing.T) {
 			WrapUnaryClientInterceptor(
 				makeMockUnaryClientInterceptor(&spans),
 				mock.SpanFromContext,
+				&Options{},
 				map[string]string{"foo": "bar"},
+				nil,
 			),
 		),
 	)
@@ -244,3 +253,139 @@ func TestBodyTruncation(t *testing.T) {
 	_ = span.ReadAttribute("container_id") // needed in containarized envs
 	assert.Zero(t, span.RemainingAttributes(), "unexpected remaining attribute: %v", span.Attributes)
 }
+
+func TestUnaryClientFilter(t *testing.T) {
+	tCases := map[string]struct {
+		filter             filter.Filter
+		expectedStatusCode codes.Code
+		expectedMessage    string
+		expectServerCall   bool
+	}{
+		"no block": {
+			filter:             mock.Filter{},
+			expectedStatusCode: codes.OK,
+			expectServerCall:   true,
+		},
+		"block with default status": {
+			filter: mock.Filter{
+				Evaluator: func(span sdk.Span) result.FilterResult {
+					assert.Equal(t, "{\"name\":\"Pupo\"}", span.GetAttributes().GetValue("rpc.request.body"))
+					return result.FilterResult{Block: true}
+				},
+			},
+			expectedStatusCode: codes.PermissionDenied,
+			expectedMessage:    "Forbidden",
+		},
+		"block with context filter": {
+			filter: contextFilter{
+				evaluator: func(ctx context.Context, span sdk.Span, req *filter.Request) result.FilterResult {
+					assert.Equal(t, "/helloworld.Greeter/SayHello", req.Method)
+					assert.Equal(t, "bufnet", req.Peer)
+					return result.FilterResult{Block: true, ResponseStatusCode: 401, ResponseMessage: "target not allowed"}
+				},
+			},
+			expectedStatusCode: codes.Unauthenticated,
+			expectedMessage:    "target not allowed",
+		},
+	}
+
+	for name, tCase := range tCases {
+		t.Run(name, func(t *testing.T) {
+			spans := []*mock.Span{}
+
+			s := grpc.NewServer()
+			defer s.Stop()
+
+			mockServer := &server{}
+			helloworld.RegisterGreeterServer(s, mockServer)
+
+			dialer := createDialer(s)
+
+			ctx := context.Background()
+			conn, err := grpc.DialContext(
+				ctx,
+				"bufnet",
+				grpc.WithContextDialer(dialer),
+				grpc.WithTransportCredentials(insecure.NewCredentials()),
+				grpc.WithUnaryInterceptor(
+					WrapUnaryClientInterceptor(
+						makeMockUnaryClientInterceptor(&spans),
+						mock.SpanFromContext,
+						&Options{Filter: tCase.filter},
+						map[string]string{},
+						nil,
+					),
+				),
+			)
+			if err != nil {
+				t.Fatalf("failed to dial bufnet: %v", err)
+			}
+			defer conn.Close()
+
+			client := helloworld.NewGreeterClient(conn)
+
+			_, err = client.SayHello(ctx, &helloworld.HelloRequest{
+				Name: "Pupo",
+			})
+			assert.Equal(t, tCase.expectedStatusCode, status.Code(err))
+			if tCase.expectedMessage != "" {
+				assert.Equal(t, tCase.expectedMessage, status.Convert(err).Message())
+			}
+			assert.Equal(t, tCase.expectServerCall, mockServer.requestHeader != nil)
+		})
+	}
+}
+
+func TestUnaryClientFilterDecorations(t *testing.T) {
+	spans := []*mock.Span{}
+
+	s := grpc.NewServer()
+	defer s.Stop()
+
+	mockServer := &server{}
+	helloworld.RegisterGreeterServer(s, mockServer)
+
+	dialer := createDialer(s)
+
+	ctx := context.Background()
+	conn, err := grpc.DialContext(
+		ctx,
+		"bufnet",
+		grpc.WithContextDialer(dialer),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(
+			WrapUnaryClientInterceptor(
+				makeMockUnaryClientInterceptor(&spans),
+				mock.SpanFromContext,
+				&Options{Filter: mock.Filter{
+					Evaluator: func(span sdk.Span) result.FilterResult {
+						return result.FilterResult{Decorations: &result.Decorations{
+							RequestHeaderInjections: []result.KeyValueString{{Key: "injected-key", Value: "injected-value"}},
+							RequestHeaderRemovals:   []string{"authorization"},
+						}}
+					},
+				}},
+				map[string]string{},
+				nil,
+			),
+		),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial bufnet: %v", err)
+	}
+	defer conn.Close()
+
+	client := helloworld.NewGreeterClient(conn)
+
+	ctx = metadata.NewOutgoingContext(ctx, metadata.Pairs("authorization", "Bearer abc", "test_key", "test_value"))
+	_, err = client.SayHello(ctx, &helloworld.HelloRequest{
+		Name: "Pupo",
+	})
+	assert.NoError(t, err)
+
+	md := mockServer.requestHeader
+	assert.Equal(t, []string{"injected-value"}, md.Get("injected-key"))
+	assert.Equal(t, []string{"test_value"}, md.Get("test_key"))
+	assert.Empty(t, md.Get("authorization"))
+	assert.Equal(t, "injected-value", spans[0].ReadAttribute("rpc.request.metadata.injected-key"))
+}
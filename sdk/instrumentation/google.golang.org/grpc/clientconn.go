@@ -0,0 +1,99 @@
+package grpc // import "github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc"
+
+import (
+	"context"
+	"net"
+
+	"github.com/hypertrace/goagent/sdk"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/stats"
+)
+
+const clientConnSpanName = "grpc.client.connection"
+
+var _ stats.Handler = (*ClientConnStats)(nil)
+
+// ClientConnStats records the connection events of a gRPC client: the transport connections
+// established and closed, through the stats handler of the client, and the connectivity state
+// transitions of the ClientConn once watched. Each event is recorded as a span of its own as
+// connections outlive the RPCs.
+type ClientConnStats struct {
+	stats.Handler
+	startSpan sdk.StartSpan
+}
+
+// WrapClientConnStats wraps the stats handler of a gRPC client, usually the one returned by
+// WrapStatsHandler, so it also records the connection events.
+func WrapClientConnStats(delegate stats.Handler, startSpan sdk.StartSpan) *ClientConnStats {
+	return &ClientConnStats{Handler: delegate, startSpan: startSpan}
+}
+
+type connTagInfoKey struct{}
+
+// TagConn keeps the connection addresses for the connection events.
+func (s *ClientConnStats) TagConn(ctx context.Context, info *stats.ConnTagInfo) context.Context {
+	ctx = s.Handler.TagConn(ctx, info)
+	return context.WithValue(ctx, connTagInfoKey{}, info)
+}
+
+// HandleConn records the connection and disconnection events.
+func (s *ClientConnStats) HandleConn(ctx context.Context, cs stats.ConnStats) {
+	defer s.Handler.HandleConn(ctx, cs)
+
+	if !cs.IsClient() {
+		return
+	}
+
+	var event string
+	switch cs.(type) {
+	case *stats.ConnBegin:
+		event = "connect"
+	case *stats.ConnEnd:
+		event = "disconnect"
+	default:
+		return
+	}
+
+	_, span, end := s.startSpan(context.Background(), clientConnSpanName, &sdk.SpanOptions{Kind: sdk.SpanKindClient})
+	defer end()
+
+	span.SetAttribute("rpc.system", "grpc")
+	span.SetAttribute("rpc.grpc.connection.event", event)
+	if info, ok := ctx.Value(connTagInfoKey{}).(*stats.ConnTagInfo); ok {
+		setAddressAttribute("rpc.grpc.connection.remote_address", info.RemoteAddr, span)
+		setAddressAttribute("rpc.grpc.connection.local_address", info.LocalAddr, span)
+	}
+}
+
+// Watch records the connectivity state transitions of cc until it shuts down or ctx is done.
+// It blocks, hence it is usually run in its own goroutine.
+func (s *ClientConnStats) Watch(ctx context.Context, cc *grpc.ClientConn) {
+	state := cc.GetState()
+	for state != connectivity.Shutdown {
+		if !cc.WaitForStateChange(ctx, state) {
+			return
+		}
+
+		newState := cc.GetState()
+		s.recordStateChange(cc.Target(), state, newState)
+		state = newState
+	}
+}
+
+func (s *ClientConnStats) recordStateChange(target string, previous, current connectivity.State) {
+	_, span, end := s.startSpan(context.Background(), clientConnSpanName, &sdk.SpanOptions{Kind: sdk.SpanKindClient})
+	defer end()
+
+	span.SetAttribute("rpc.system", "grpc")
+	span.SetAttribute("rpc.grpc.connection.event", "state_change")
+	span.SetAttribute("rpc.grpc.connection.target", target)
+	span.SetAttribute("rpc.grpc.connectivity.previous_state", previous.String())
+	span.SetAttribute("rpc.grpc.connectivity.state", current.String())
+}
+
+func setAddressAttribute(key string, addr net.Addr, span sdk.Span) {
+	if addr != nil {
+		span.SetAttribute(key, addr.String())
+	}
+}
@@ -0,0 +1,22 @@
+package grpc // import "github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc"
+
+import (
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/filter/result"
+	"google.golang.org/grpc/metadata"
+)
+
+// applyDecorations removes and injects the request metadata as decided by the filters
+// and records the injected metadata in the span. The passed metadata is not modified.
+func applyDecorations(md metadata.MD, decorations *result.Decorations, span sdk.Span) metadata.MD {
+	md = md.Copy()
+	for _, key := range decorations.RequestHeaderRemovals {
+		md.Delete(key)
+	}
+
+	for _, header := range decorations.RequestHeaderInjections {
+		md.Append(header.Key, header.Value)
+		span.SetAttribute("rpc.request.metadata."+header.Key, header.Value)
+	}
+	return md
+}
@@ -0,0 +1,232 @@
+package grpc // import "github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// DescriptorResolver finds the descriptor of a gRPC method. It is used to decode the
+// raw frames of RPCs handled without generated types, e.g. by proxies using
+// grpc.UnknownServiceHandler or a raw bytes codec.
+type DescriptorResolver interface {
+	// FindMethodDescriptor returns the descriptor of a method given its full name
+	// as in "/package.Service/Method".
+	FindMethodDescriptor(ctx context.Context, fullMethod string) (protoreflect.MethodDescriptor, error)
+}
+
+var _ DescriptorResolver = (*registryResolver)(nil)
+
+// registryResolver resolves the methods from a set of file descriptors.
+type registryResolver struct {
+	files *protoregistry.Files
+}
+
+// NewRegistryDescriptorResolver returns a resolver looking up the methods in the given
+// registry, protoregistry.GlobalFiles is used when files is nil.
+func NewRegistryDescriptorResolver(files *protoregistry.Files) DescriptorResolver {
+	if files == nil {
+		files = protoregistry.GlobalFiles
+	}
+	return &registryResolver{files: files}
+}
+
+// NewFileDescriptorSetResolver returns a resolver looking up the methods in a serialized
+// FileDescriptorSet, as generated by `protoc --include_imports --descriptor_set_out`.
+func NewFileDescriptorSetResolver(path string) (DescriptorResolver, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read descriptor set: %v", err)
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(content, set); err != nil {
+		return nil, fmt.Errorf("failed to parse descriptor set: %v", err)
+	}
+
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load descriptor set: %v", err)
+	}
+
+	return &registryResolver{files: files}, nil
+}
+
+func (r *registryResolver) FindMethodDescriptor(_ context.Context, fullMethod string) (protoreflect.MethodDescriptor, error) {
+	return findMethodDescriptor(r.files, fullMethod)
+}
+
+const defaultReflectionTimeout = 5 * time.Second
+
+var _ DescriptorResolver = (*reflectionResolver)(nil)
+
+// reflectionResolver resolves the methods by querying the server reflection service.
+type reflectionResolver struct {
+	cc      grpc.ClientConnInterface
+	timeout time.Duration
+}
+
+// NewReflectionDescriptorResolver returns a resolver querying the v1 server reflection
+// service through the given connection, usually the connection to the backend of a proxy.
+// Each query is bounded by a timeout of 5 seconds.
+func NewReflectionDescriptorResolver(cc grpc.ClientConnInterface) DescriptorResolver {
+	return &reflectionResolver{cc: cc, timeout: defaultReflectionTimeout}
+}
+
+func (r *reflectionResolver) FindMethodDescriptor(ctx context.Context, fullMethod string) (protoreflect.MethodDescriptor, error) {
+	service, _, err := splitFullMethod(fullMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	// the descriptors are cached so the query should not be tied to the
+	// cancellation of the RPC being instrumented.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), r.timeout)
+	defer cancel()
+
+	stream, err := reflectionpb.NewServerReflectionClient(r.cc).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query server reflection: %v", err)
+	}
+	defer stream.CloseSend() // nolint:errcheck
+
+	err = stream.Send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: service},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query server reflection: %v", err)
+	}
+
+	res, err := stream.Recv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query server reflection: %v", err)
+	}
+	if errRes := res.GetErrorResponse(); errRes != nil {
+		return nil, fmt.Errorf("server reflection error for %q: %s", service, errRes.GetErrorMessage())
+	}
+
+	// the response includes the dependencies of the file
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, rawFile := range res.GetFileDescriptorResponse().GetFileDescriptorProto() {
+		file := &descriptorpb.FileDescriptorProto{}
+		if err := proto.Unmarshal(rawFile, file); err != nil {
+			return nil, fmt.Errorf("failed to parse file descriptor: %v", err)
+		}
+		set.File = append(set.File, file)
+	}
+
+	files, err := protodesc.FileOptions{AllowUnresolvable: true}.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load file descriptors: %v", err)
+	}
+
+	return findMethodDescriptor(files, fullMethod)
+}
+
+func findMethodDescriptor(files *protoregistry.Files, fullMethod string) (protoreflect.MethodDescriptor, error) {
+	service, method, err := splitFullMethod(fullMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, err
+	}
+
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a service", service)
+	}
+
+	md := sd.Methods().ByName(protoreflect.Name(method))
+	if md == nil {
+		return nil, fmt.Errorf("method %q not found in service %q", method, service)
+	}
+	return md, nil
+}
+
+// splitFullMethod splits "/package.Service/Method" into the service and the method names.
+func splitFullMethod(fullMethod string) (string, string, error) {
+	service, method, ok := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	if !ok || service == "" || method == "" {
+		return "", "", errors.New("invalid method name " + fullMethod)
+	}
+	return service, method, nil
+}
+
+const (
+	// descriptorLookupTimeout bounds the lookups done on behalf of the cache.
+	descriptorLookupTimeout = 5 * time.Second
+	// descriptorRetryBackoff is how long a failed lookup is cached before being retried.
+	descriptorRetryBackoff = 30 * time.Second
+)
+
+// descriptorCache caches the method descriptors. Failed lookups are cached for a while
+// so a missing descriptor is not looked up on every RPC, but are retried afterwards
+// as the failure might be transient.
+type descriptorCache struct {
+	resolver     DescriptorResolver
+	retryBackoff time.Duration
+	methods      sync.Map // map[string]*cachedDescriptor
+}
+
+type cachedDescriptor struct {
+	mu        sync.Mutex
+	md        protoreflect.MethodDescriptor
+	err       error
+	retryTime time.Time
+}
+
+func newDescriptorCache(resolver DescriptorResolver) *descriptorCache {
+	return &descriptorCache{resolver: resolver, retryBackoff: descriptorRetryBackoff}
+}
+
+// messageDescriptor returns the descriptor of the request or response message of the method.
+func (c *descriptorCache) messageDescriptor(ctx context.Context, fullMethod, _type string) (protoreflect.MessageDescriptor, error) {
+	entry, _ := c.methods.LoadOrStore(fullMethod, &cachedDescriptor{})
+	md, err := c.methodDescriptor(ctx, entry.(*cachedDescriptor), fullMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	if _type == "request" {
+		return md.Input(), nil
+	}
+	return md.Output(), nil
+}
+
+func (c *descriptorCache) methodDescriptor(ctx context.Context, cached *cachedDescriptor, fullMethod string) (protoreflect.MethodDescriptor, error) {
+	cached.mu.Lock()
+	defer cached.mu.Unlock()
+
+	if cached.md != nil {
+		return cached.md, nil
+	}
+	if cached.err != nil && time.Now().Before(cached.retryTime) {
+		return nil, cached.err
+	}
+
+	// the result is shared by the RPCs of the method so the lookup should not be
+	// tied to the cancellation of the RPC doing it.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), descriptorLookupTimeout)
+	defer cancel()
+
+	cached.md, cached.err = c.resolver.FindMethodDescriptor(ctx, fullMethod)
+	if cached.err != nil {
+		cached.retryTime = time.Now().Add(c.retryBackoff)
+	}
+	return cached.md, cached.err
+}
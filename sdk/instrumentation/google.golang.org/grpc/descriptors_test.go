@@ -0,0 +1,248 @@
+package grpc
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc/internal/helloworld"
+	internalconfig "github.com/hypertrace/goagent/sdk/internal/config"
+	"github.com/hypertrace/goagent/sdk/internal/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const sayHelloMethod = "/helloworld.Greeter/SayHello"
+
+func assertSayHelloDescriptor(t *testing.T, resolver DescriptorResolver) {
+	md, err := resolver.FindMethodDescriptor(context.Background(), sayHelloMethod)
+	require.NoError(t, err)
+	assert.Equal(t, "helloworld.HelloRequest", string(md.Input().FullName()))
+	assert.Equal(t, "helloworld.HelloReply", string(md.Output().FullName()))
+
+	_, err = resolver.FindMethodDescriptor(context.Background(), "/helloworld.Greeter/SayGoodbye")
+	assert.Error(t, err)
+}
+
+func TestRegistryDescriptorResolver(t *testing.T) {
+	assertSayHelloDescriptor(t, NewRegistryDescriptorResolver(nil))
+}
+
+func TestFileDescriptorSetResolver(t *testing.T) {
+	set := &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{protodesc.ToFileDescriptorProto(helloworld.File_helloworld_proto)},
+	}
+	content, err := proto.Marshal(set)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "helloworld.pb")
+	require.NoError(t, os.WriteFile(path, content, 0600))
+
+	resolver, err := NewFileDescriptorSetResolver(path)
+	require.NoError(t, err)
+	assertSayHelloDescriptor(t, resolver)
+
+	_, err = NewFileDescriptorSetResolver(filepath.Join(t.TempDir(), "missing.pb"))
+	assert.Error(t, err)
+}
+
+func TestReflectionDescriptorResolver(t *testing.T) {
+	s := grpc.NewServer()
+	defer s.Stop()
+	helloworld.RegisterGreeterServer(s, &server{})
+	reflection.Register(s)
+
+	conn, err := grpc.DialContext(
+		context.Background(),
+		"bufnet",
+		grpc.WithContextDialer(createDialer(s)),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	assertSayHelloDescriptor(t, NewReflectionDescriptorResolver(conn))
+}
+
+type countingResolver struct {
+	DescriptorResolver
+	lookups int
+}
+
+func (r *countingResolver) FindMethodDescriptor(ctx context.Context, fullMethod string) (protoreflect.MethodDescriptor, error) {
+	r.lookups++
+	return r.DescriptorResolver.FindMethodDescriptor(ctx, fullMethod)
+}
+
+func TestMessageMarshalerDecodesRawFrames(t *testing.T) {
+	resolver := &countingResolver{DescriptorResolver: NewRegistryDescriptorResolver(nil)}
+	marshaler := newMessageMarshaler(&Options{DescriptorResolver: resolver})
+
+	raw, err := proto.Marshal(&helloworld.HelloRequest{Name: "Pupo"})
+	require.NoError(t, err)
+
+	body, err := marshaler.marshal(context.Background(), sayHelloMethod, "request", raw)
+	require.NoError(t, err)
+	assert.Equal(t, `{"name":"Pupo"}`, strings.ReplaceAll(string(body), " ", ""))
+
+	raw, err = proto.Marshal(&helloworld.HelloReply{Message: "Hello Pupo"})
+	require.NoError(t, err)
+
+	body, err = marshaler.marshal(context.Background(), sayHelloMethod, "response", &raw)
+	require.NoError(t, err)
+	assert.Equal(t, `{"message":"HelloPupo"}`, strings.ReplaceAll(string(body), " ", ""))
+
+	// descriptors are cached per method, including the failed lookups for a while
+	assert.Equal(t, 1, resolver.lookups)
+	for i := 0; i < 2; i++ {
+		body, err = marshaler.marshal(context.Background(), "/unknown.Service/Method", "request", raw)
+		require.NoError(t, err)
+		assert.Equal(t, base64.StdEncoding.EncodeToString(raw), string(body))
+	}
+	assert.Equal(t, 2, resolver.lookups)
+}
+
+// cancellableResolver fails the lookups done with a cancelled context.
+type cancellableResolver struct {
+	DescriptorResolver
+}
+
+func (r cancellableResolver) FindMethodDescriptor(ctx context.Context, fullMethod string) (protoreflect.MethodDescriptor, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return r.DescriptorResolver.FindMethodDescriptor(ctx, fullMethod)
+}
+
+func TestDescriptorCacheRetriesFailedLookups(t *testing.T) {
+	resolver := &countingResolver{DescriptorResolver: cancellableResolver{NewRegistryDescriptorResolver(nil)}}
+	cache := newDescriptorCache(resolver)
+	cache.retryBackoff = 0
+
+	// a lookup done for a cancelled RPC still succeeds
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	md, err := cache.messageDescriptor(ctx, sayHelloMethod, "request")
+	require.NoError(t, err)
+	assert.Equal(t, "helloworld.HelloRequest", string(md.FullName()))
+
+	for i := 0; i < 2; i++ {
+		_, err = cache.messageDescriptor(context.Background(), "/unknown.Service/Method", "request")
+		assert.Error(t, err)
+	}
+	// the successful lookup is cached, the failed one is retried once the backoff elapsed
+	_, err = cache.messageDescriptor(context.Background(), sayHelloMethod, "response")
+	require.NoError(t, err)
+	assert.Equal(t, 3, resolver.lookups)
+}
+
+func TestMessageMarshalerWithoutResolver(t *testing.T) {
+	marshaler := newMessageMarshaler(nil)
+
+	body, err := marshaler.marshal(context.Background(), sayHelloMethod, "request", []byte("raw"))
+	require.NoError(t, err)
+	assert.Equal(t, "cmF3", string(body))
+
+	body, err = marshaler.marshal(context.Background(), sayHelloMethod, "request", &helloworld.HelloRequest{Name: "Pupo"})
+	require.NoError(t, err)
+	assert.Equal(t, `{"name":"Pupo"}`, strings.ReplaceAll(string(body), " ", ""))
+
+	body, err = marshaler.marshal(context.Background(), sayHelloMethod, "request", struct{}{})
+	assert.NoError(t, err)
+	assert.Nil(t, body)
+}
+
+// rawCodec passes the frames through as bytes, like the codecs used by gRPC proxies.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	if b, ok := v.(*[]byte); ok {
+		return *b, nil
+	}
+	return proto.Marshal(v.(proto.Message))
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	if b, ok := v.(*[]byte); ok {
+		*b = append([]byte(nil), data...)
+		return nil
+	}
+	return proto.Unmarshal(data, v.(proto.Message))
+}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
+
+// rawGreeter answers SayHello on raw frames as a proxy would.
+func rawGreeter(_ interface{}, stream grpc.ServerStream) error {
+	for {
+		frame := []byte{}
+		err := stream.RecvMsg(&frame)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		req := &helloworld.HelloRequest{}
+		if err := proto.Unmarshal(frame, req); err != nil {
+			return err
+		}
+		reply, err := proto.Marshal(&helloworld.HelloReply{Message: "Hello " + req.GetName()})
+		if err != nil {
+			return err
+		}
+		if err := stream.SendMsg(&reply); err != nil {
+			return err
+		}
+	}
+}
+
+func TestStreamServerInterceptorDecodesRawFrames(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	spans := []*mock.Span{}
+	s := grpc.NewServer(
+		grpc.ForceServerCodec(rawCodec{}),
+		grpc.UnknownServiceHandler(rawGreeter),
+		grpc.StreamInterceptor(WrapStreamServerInterceptor(
+			makeMockStreamServerInterceptor(&spans),
+			mock.SpanFromContext,
+			&Options{DescriptorResolver: NewRegistryDescriptorResolver(nil)},
+			nil,
+			nil,
+		)),
+	)
+	defer s.Stop()
+
+	conn, err := grpc.DialContext(
+		context.Background(),
+		"bufnet",
+		grpc.WithContextDialer(createDialer(s)),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	reply, err := helloworld.NewGreeterClient(conn).SayHello(context.Background(), &helloworld.HelloRequest{Name: "Pupo"})
+	require.NoError(t, err)
+	assert.Equal(t, "Hello Pupo", reply.GetMessage())
+
+	require.Equal(t, 1, len(spans))
+	assert.Equal(t, `{"name":"Pupo"}`, strings.ReplaceAll(spans[0].ReadAttribute("rpc.request.body").(string), " ", ""))
+	assert.Equal(t, `{"message":"HelloPupo"}`, strings.ReplaceAll(spans[0].ReadAttribute("rpc.response.body").(string), " ", ""))
+}
@@ -0,0 +1,58 @@
+package grpc // import "github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc"
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/instrumentation/bodyattribute"
+	// registers the google.rpc error details (ErrorInfo, BadRequest, RetryInfo...)
+	// so they can be serialized
+	_ "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// setErrorAttributes records the status of a failed RPC in the span: the status code,
+// the message and the google.rpc.Status details serialized as JSON.
+func setErrorAttributes(err error, span sdk.Span, detailsMaxSize int) {
+	s := status.Convert(err)
+	span.SetError(err, sdk.WithCallerSkip(1))
+	span.SetStatus(sdk.StatusCodeError, s.Message())
+	span.SetAttribute("rpc.grpc.status_code", int(s.Code()))
+	if s.Message() != "" {
+		span.SetAttribute("rpc.grpc.status_message", s.Message())
+	}
+
+	details := s.Proto().GetDetails()
+	if len(details) == 0 {
+		return
+	}
+
+	serializedDetails, err := marshalStatusDetails(details)
+	if err != nil {
+		return
+	}
+	bodyattribute.SetTruncatedBodyAttribute("rpc.grpc.status_details", serializedDetails, detailsMaxSize, span)
+}
+
+// marshalStatusDetails serializes the details as a JSON array. Details whose type
+// is unknown are serialized with their type URL and the base64 encoded value.
+func marshalStatusDetails(details []*anypb.Any) ([]byte, error) {
+	serialized := make([]json.RawMessage, 0, len(details))
+	for _, detail := range details {
+		detailJSON, err := protojson.Marshal(detail)
+		if err != nil {
+			detailJSON, err = json.Marshal(map[string]string{
+				"@type": detail.GetTypeUrl(),
+				"value": base64.StdEncoding.EncodeToString(detail.GetValue()),
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		serialized = append(serialized, detailJSON)
+	}
+	return json.Marshal(serialized)
+}
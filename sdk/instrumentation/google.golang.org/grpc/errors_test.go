@@ -0,0 +1,183 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc/internal/helloworld"
+	internalconfig "github.com/hypertrace/goagent/sdk/internal/config"
+	"github.com/hypertrace/goagent/sdk/internal/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+const expectedStatusDetails = `[{"@type":"type.googleapis.com/google.rpc.ErrorInfo","reason":"QUOTA_EXCEEDED","domain":"hypertrace.org"}]`
+
+func newStatusWithDetails(t *testing.T) error {
+	s, err := status.New(codes.ResourceExhausted, "quota exceeded").
+		WithDetails(&errdetails.ErrorInfo{Reason: "QUOTA_EXCEEDED", Domain: "hypertrace.org"})
+	require.NoError(t, err)
+	return s.Err()
+}
+
+// failingServer returns a server answering with a status with details, a header and a trailer.
+func failingServer(t *testing.T) *server {
+	return &server{
+		err:          newStatusWithDetails(t),
+		replyHeader:  metadata.Pairs("test_header_key", "test_header_value"),
+		replyTrailer: metadata.Pairs("test_trailer_key", "test_trailer_value"),
+	}
+}
+
+func assertErrorAttributes(t *testing.T, span *mock.Span) {
+	assert.Equal(t, codes.ResourceExhausted, status.Code(span.Err))
+	assert.Equal(t, 1, span.ErrOptions.CallerSkip)
+	assert.Equal(t, sdk.StatusCodeError, span.Status.Code)
+	assert.Equal(t, "quota exceeded", span.Status.Message)
+	assert.Equal(t, int(codes.ResourceExhausted), span.ReadAttribute("rpc.grpc.status_code"))
+	assert.Equal(t, "quota exceeded", span.ReadAttribute("rpc.grpc.status_message"))
+
+	details, ok := span.ReadAttribute("rpc.grpc.status_details").(string)
+	require.True(t, ok)
+	ok, err := jsonEqual(expectedStatusDetails, details)
+	require.NoError(t, err)
+	assert.True(t, ok, "unexpected status details: %s", details)
+}
+
+func TestServerInterceptorErrorCapture(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	spans := []*mock.Span{}
+	s := grpc.NewServer(grpc.UnaryInterceptor(
+		WrapUnaryServerInterceptor(makeMockUnaryServerInterceptor(&spans), mock.SpanFromContext, &Options{}, nil, nil),
+	))
+	defer s.Stop()
+	helloworld.RegisterGreeterServer(s, failingServer(t))
+
+	conn, err := grpc.DialContext(
+		context.Background(),
+		"bufnet",
+		grpc.WithContextDialer(createDialer(s)),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = helloworld.NewGreeterClient(conn).SayHello(context.Background(), &helloworld.HelloRequest{Name: "Pupo"})
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	require.Equal(t, 1, len(spans))
+	assertErrorAttributes(t, spans[0])
+	assert.Equal(t, "test_header_value", spans[0].ReadAttribute("rpc.response.metadata.test_header_key"))
+	assert.Equal(t, "test_trailer_value", spans[0].ReadAttribute("rpc.response.metadata.test_trailer_key"))
+}
+
+func TestUnaryClientErrorCapture(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	s := grpc.NewServer()
+	defer s.Stop()
+	helloworld.RegisterGreeterServer(s, failingServer(t))
+
+	spans := []*mock.Span{}
+	conn, err := grpc.DialContext(
+		context.Background(),
+		"bufnet",
+		grpc.WithContextDialer(createDialer(s)),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(
+			WrapUnaryClientInterceptor(makeMockUnaryClientInterceptor(&spans), mock.SpanFromContext, &Options{}, nil, nil),
+		),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = helloworld.NewGreeterClient(conn).SayHello(context.Background(), &helloworld.HelloRequest{Name: "Pupo"})
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	require.Equal(t, 1, len(spans))
+	assertErrorAttributes(t, spans[0])
+	assert.Equal(t, "test_header_value", spans[0].ReadAttribute("rpc.response.metadata.test_header_key"))
+	assert.Equal(t, "test_trailer_value", spans[0].ReadAttribute("rpc.response.metadata.test_trailer_key"))
+	assert.Nil(t, spans[0].ReadAttribute("rpc.response.body"))
+}
+
+func TestClientHandlerErrorCapture(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	s := grpc.NewServer()
+	defer s.Stop()
+	helloworld.RegisterGreeterServer(s, failingServer(t))
+
+	mockHandler := &mockHandler{}
+	conn, err := grpc.DialContext(
+		context.Background(),
+		"bufnet",
+		grpc.WithContextDialer(createDialer(s)),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(WrapStatsHandler(mockHandler, mock.SpanFromContext, &Options{})),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = helloworld.NewGreeterClient(conn).SayHello(context.Background(), &helloworld.HelloRequest{Name: "Pupo"})
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	require.Equal(t, 1, len(mockHandler.Spans))
+	assertErrorAttributes(t, mockHandler.Spans[0])
+}
+
+func TestStreamClientErrorCapture(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	spans := []*mock.Span{}
+	conn := dialChat(t, []grpc.ServerOption{
+		grpc.StreamInterceptor(func(_ interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, _ grpc.StreamHandler) error {
+			ss.SetTrailer(metadata.Pairs("test_trailer_key", "test_trailer_value"))
+			return newStatusWithDetails(t)
+		}),
+	}, grpc.WithStreamInterceptor(WrapStreamClientInterceptor(
+		makeMockStreamClientInterceptor(&spans),
+		mock.SpanFromContext,
+		&Options{},
+		nil,
+		nil,
+	)))
+
+	_, err := chat(context.Background(), conn, "Pupo")
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	require.Equal(t, 1, len(spans))
+	assertErrorAttributes(t, spans[0])
+	assert.Equal(t, "test_trailer_value", spans[0].ReadAttribute("rpc.response.metadata.test_trailer_key"))
+}
+
+func TestSetErrorAttributesWithoutStatus(t *testing.T) {
+	span := mock.NewSpan()
+	setErrorAttributes(errors.New("connection reset"), span, 128)
+
+	assert.Equal(t, sdk.StatusCodeError, span.Status.Code)
+	assert.Equal(t, int(codes.Unknown), span.ReadAttribute("rpc.grpc.status_code"))
+	assert.Equal(t, "connection reset", span.ReadAttribute("rpc.grpc.status_message"))
+	assert.Nil(t, span.ReadAttribute("rpc.grpc.status_details"))
+}
+
+func TestMarshalStatusDetailsUnknownType(t *testing.T) {
+	details, err := marshalStatusDetails([]*anypb.Any{
+		{TypeUrl: "type.googleapis.com/acme.Unknown", Value: []byte("raw")},
+	})
+	require.NoError(t, err)
+
+	ok, err := jsonEqual(`[{"@type":"type.googleapis.com/acme.Unknown","value":"cmF3"}]`, string(details))
+	require.NoError(t, err)
+	assert.True(t, ok, "unexpected details: %s", details)
+}
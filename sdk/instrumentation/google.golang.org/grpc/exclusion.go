@@ -0,0 +1,50 @@
+package grpc // import "github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc"
+
+import (
+	"context"
+
+	"github.com/hypertrace/goagent/sdk/exclusion"
+	"google.golang.org/grpc/metadata"
+)
+
+// isExcludedServerRPC tells whether an incoming RPC matches an exclusion rule, in which
+// case the data is not captured. The filter is evaluated for the excluded RPCs as well,
+// so neither a matching method nor a spoofed user agent skips it.
+func isExcludedServerRPC(ctx context.Context, rules exclusion.Rules, fullMethod string) bool {
+	if len(rules) == 0 {
+		return false
+	}
+
+	req := exclusion.Request{FullMethod: fullMethod}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if userAgent := md.Get("user-agent"); len(userAgent) > 0 {
+			req.UserAgent = userAgent[0]
+		}
+	}
+
+	_, excluded := rules.Match(req)
+	return excluded
+}
+
+// isExcludedClientRPC tells whether an outgoing RPC matches an exclusion rule. The user
+// agent is set by the client connection hence only the method is matched.
+func isExcludedClientRPC(rules exclusion.Rules, fullMethod string) bool {
+	if len(rules) == 0 {
+		return false
+	}
+
+	_, excluded := rules.Match(exclusion.Request{FullMethod: fullMethod})
+	return excluded
+}
+
+type excludedKey struct{}
+
+// contextWithExcluded marks the RPC as excluded for the stats handler.
+func contextWithExcluded(ctx context.Context) context.Context {
+	return context.WithValue(ctx, excludedKey{}, true)
+}
+
+func isExcludedFromContext(ctx context.Context) bool {
+	excluded, _ := ctx.Value(excludedKey{}).(bool)
+	return excluded
+}
@@ -0,0 +1,163 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/exclusion"
+	"github.com/hypertrace/goagent/sdk/filter/result"
+	"github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc/internal/helloworld"
+	internalconfig "github.com/hypertrace/goagent/sdk/internal/config"
+	"github.com/hypertrace/goagent/sdk/internal/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// blockAllFilter blocks every request it evaluates.
+var blockAllFilter = mock.Filter{
+	Evaluator: func(span sdk.Span) result.FilterResult {
+		return result.FilterResult{Block: true, ResponseStatusCode: 403}
+	},
+}
+
+func TestServerInterceptorExclusions(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	spans := []*mock.Span{}
+	s := grpc.NewServer(grpc.UnaryInterceptor(WrapUnaryServerInterceptor(
+		makeMockUnaryServerInterceptor(&spans),
+		mock.SpanFromContext,
+		&Options{
+			Filter: blockAllFilter,
+			Exclusions: exclusion.Rules{
+				{FullMethod: "/helloworld.Greeter/*", UserAgent: "grpc-go/*", Action: exclusion.SkipDataCapture},
+			},
+		},
+		nil,
+		nil,
+	)))
+	defer s.Stop()
+	helloworld.RegisterGreeterServer(s, &server{})
+
+	conn, err := grpc.DialContext(
+		context.Background(),
+		"bufnet",
+		grpc.WithContextDialer(createDialer(s)),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// the data of excluded RPCs is not captured but the filter is still evaluated
+	_, err = helloworld.NewGreeterClient(conn).SayHello(context.Background(), &helloworld.HelloRequest{Name: "Pupo"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	require.Equal(t, 1, len(spans))
+	assert.Zero(t, spans[0].RemainingAttributes())
+}
+
+func TestServerHandlerExclusions(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	mockHandler := &mockHandler{}
+	s := grpc.NewServer(
+		grpc.StatsHandler(WrapStatsHandler(mockHandler, mock.SpanFromContext, &Options{
+			Filter: blockAllFilter,
+			Exclusions: exclusion.Rules{
+				{FullMethod: "/helloworld.Greeter/SayHello", UserAgent: "grpc-go/*", Action: exclusion.SkipDataCapture},
+			},
+		})),
+		grpc.UnaryInterceptor(FilterUnaryServerInterceptor()),
+	)
+	defer s.Stop()
+	helloworld.RegisterGreeterServer(s, &server{})
+
+	conn, err := grpc.DialContext(
+		context.Background(),
+		"bufnet",
+		grpc.WithContextDialer(createDialer(s)),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithBlock(),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = helloworld.NewGreeterClient(conn).SayHello(context.Background(), &helloworld.HelloRequest{Name: "Pupo"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	s.GracefulStop()
+	require.Equal(t, 1, len(mockHandler.Spans))
+	assert.Zero(t, mockHandler.Spans[0].RemainingAttributes())
+}
+
+func TestStreamClientInterceptorExclusions(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	spans := []*mock.Span{}
+	conn := dialChat(t, nil, grpc.WithStreamInterceptor(WrapStreamClientInterceptor(
+		makeMockStreamClientInterceptor(&spans),
+		mock.SpanFromContext,
+		&Options{
+			Filter:     blockAllFilter,
+			Exclusions: exclusion.DefaultRules(exclusion.SkipSpan),
+		},
+		nil,
+		nil,
+	)))
+
+	_, err := chat(context.Background(), conn, "Pupo")
+	assert.Error(t, err)
+
+	filterCalls := 0
+	conn = dialChat(t, nil, grpc.WithStreamInterceptor(WrapStreamClientInterceptor(
+		makeMockStreamClientInterceptor(&spans),
+		mock.SpanFromContext,
+		&Options{
+			Filter: mock.Filter{
+				Evaluator: func(span sdk.Span) result.FilterResult {
+					filterCalls++
+					return result.FilterResult{}
+				},
+			},
+			Exclusions: exclusion.Rules{{FullMethod: "/helloworld.Chat/*", Action: exclusion.SkipSpan}},
+		},
+		nil,
+		nil,
+	)))
+
+	replies, err := chat(context.Background(), conn, "Pupo")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Hello Pupo"}, replies)
+	assert.Equal(t, 1, filterCalls)
+
+	require.Equal(t, 2, len(spans))
+	assert.Zero(t, spans[1].RemainingAttributes())
+}
+
+func TestStreamServerInterceptorExclusions(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	spans := []*mock.Span{}
+	conn := dialChat(t, []grpc.ServerOption{grpc.StreamInterceptor(WrapStreamServerInterceptor(
+		makeMockStreamServerInterceptor(&spans),
+		mock.SpanFromContext,
+		&Options{
+			Filter:     blockAllFilter,
+			Exclusions: exclusion.Rules{{UserAgent: "grpc-go/*"}},
+		},
+		nil,
+		nil,
+	))})
+
+	// a client can't skip the filter by spoofing its user agent
+	_, err := chat(context.Background(), conn, "Pupo")
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	require.Equal(t, 1, len(spans))
+	assert.Zero(t, spans[0].RemainingAttributes())
+}
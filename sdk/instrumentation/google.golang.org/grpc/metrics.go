@@ -0,0 +1,135 @@
+package grpc // import "github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc"
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hypertrace/goagent/sdk"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// rpcMetrics measures an RPC for the metrics handler. Its methods are no-op on a nil
+// receiver so the RPCs are measured only when a handler is set.
+type rpcMetrics struct {
+	mh           sdk.RpcOperationMetricsHandler
+	fullMethod   string
+	isClient     bool
+	start        time.Time
+	requestSize  int64
+	responseSize int64
+	recordOnce   sync.Once
+}
+
+func newRPCMetrics(mh sdk.RpcOperationMetricsHandler, fullMethod string, isClient bool) *rpcMetrics {
+	if mh == nil {
+		return nil
+	}
+	return &rpcMetrics{mh: mh, fullMethod: fullMethod, isClient: isClient, start: time.Now()}
+}
+
+func (m *rpcMetrics) addRequest(msg interface{}) {
+	if m != nil {
+		atomic.AddInt64(&m.requestSize, messageSize(msg))
+	}
+}
+
+func (m *rpcMetrics) addResponse(msg interface{}) {
+	if m != nil {
+		atomic.AddInt64(&m.responseSize, messageSize(msg))
+	}
+}
+
+// record reports the RPC once, io.EOF being the successful end of a stream.
+func (m *rpcMetrics) record(ctx context.Context, err error) {
+	if m == nil {
+		return
+	}
+
+	if errors.Is(err, io.EOF) {
+		err = nil
+	}
+
+	m.recordOnce.Do(func() {
+		m.mh.RecordRpcOperation(ctx, sdk.RpcOperation{
+			FullMethod:   m.fullMethod,
+			IsClient:     m.isClient,
+			StatusCode:   int(status.Code(err)),
+			Duration:     time.Since(m.start),
+			RequestSize:  atomic.LoadInt64(&m.requestSize),
+			ResponseSize: atomic.LoadInt64(&m.responseSize),
+		})
+	})
+}
+
+// messageSize returns the size of the encoded message, raw frames being already encoded.
+func messageSize(msg interface{}) int64 {
+	switch m := msg.(type) {
+	case proto.Message:
+		return int64(proto.Size(m))
+	case []byte:
+		return int64(len(m))
+	case *[]byte:
+		if m != nil {
+			return int64(len(*m))
+		}
+	}
+	return 0
+}
+
+// meteredServerStream measures the messages of a server stream.
+type meteredServerStream struct {
+	grpc.ServerStream
+	metrics *rpcMetrics
+}
+
+func (s *meteredServerStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.metrics.addResponse(m)
+	}
+	return err
+}
+
+func (s *meteredServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.metrics.addRequest(m)
+	}
+	return err
+}
+
+// meteredClientStream measures the messages of a client stream and records the RPC once
+// the response is fully received. The RPC is not recorded when the stream isn't drained.
+type meteredClientStream struct {
+	grpc.ClientStream
+	metrics       *rpcMetrics
+	serverStreams bool
+}
+
+func (s *meteredClientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		s.metrics.addRequest(m)
+	} else if !errors.Is(err, io.EOF) {
+		s.metrics.record(s.Context(), err)
+	}
+	return err
+}
+
+func (s *meteredClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == nil {
+		s.metrics.addResponse(m)
+	}
+
+	if err != nil || !s.serverStreams {
+		s.metrics.record(s.Context(), err)
+	}
+	return err
+}
@@ -0,0 +1,148 @@
+package grpc
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc/internal/helloworld"
+	internalconfig "github.com/hypertrace/goagent/sdk/internal/config"
+	"github.com/hypertrace/goagent/sdk/internal/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+var _ sdk.RpcOperationMetricsHandler = (*mockMetricsHandler)(nil)
+
+type mockMetricsHandler struct {
+	mux        sync.Mutex
+	operations []sdk.RpcOperation
+}
+
+func (h *mockMetricsHandler) RecordRpcOperation(_ context.Context, op sdk.RpcOperation) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	h.operations = append(h.operations, op)
+}
+
+// operation returns the single operation recorded on the given side.
+func (h *mockMetricsHandler) operation(t *testing.T, isClient bool) sdk.RpcOperation {
+	var ops []sdk.RpcOperation
+	require.Eventually(t, func() bool {
+		h.mux.Lock()
+		defer h.mux.Unlock()
+
+		ops = nil
+		for _, op := range h.operations {
+			if op.IsClient == isClient {
+				ops = append(ops, op)
+			}
+		}
+		return len(ops) > 0
+	}, time.Second, 10*time.Millisecond)
+
+	require.Len(t, ops, 1)
+	return ops[0]
+}
+
+func TestUnaryInterceptorsRecordMetrics(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	mh := &mockMetricsHandler{}
+	spans := []*mock.Span{}
+	s := grpc.NewServer(grpc.UnaryInterceptor(WrapUnaryServerInterceptor(
+		makeMockUnaryServerInterceptor(&spans), mock.SpanFromContext, &Options{}, nil, mh,
+	)))
+	defer s.Stop()
+	helloworld.RegisterGreeterServer(s, &server{})
+
+	conn, err := grpc.DialContext(
+		context.Background(),
+		"bufnet",
+		grpc.WithContextDialer(createDialer(s)),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(WrapUnaryClientInterceptor(
+			makeMockUnaryClientInterceptor(&spans), mock.SpanFromContext, &Options{}, nil, mh,
+		)),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	req := &helloworld.HelloRequest{Name: "Pupo"}
+	_, err = helloworld.NewGreeterClient(conn).SayHello(context.Background(), req)
+	require.NoError(t, err)
+
+	reply := &helloworld.HelloReply{Message: "Hello Pupo"}
+	for _, isClient := range []bool{true, false} {
+		op := mh.operation(t, isClient)
+		assert.Equal(t, "/helloworld.Greeter/SayHello", op.FullMethod)
+		assert.Equal(t, int(codes.OK), op.StatusCode)
+		assert.Equal(t, int64(proto.Size(req)), op.RequestSize)
+		assert.Equal(t, int64(proto.Size(reply)), op.ResponseSize)
+		assert.Greater(t, op.Duration, time.Duration(0))
+	}
+}
+
+func TestUnaryServerInterceptorRecordsFailures(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	mh := &mockMetricsHandler{}
+	spans := []*mock.Span{}
+	s := grpc.NewServer(grpc.UnaryInterceptor(WrapUnaryServerInterceptor(
+		makeMockUnaryServerInterceptor(&spans), mock.SpanFromContext, &Options{}, nil, mh,
+	)))
+	defer s.Stop()
+	helloworld.RegisterGreeterServer(s, &server{err: status.Error(codes.NotFound, "not found")})
+
+	conn, err := grpc.DialContext(
+		context.Background(),
+		"bufnet",
+		grpc.WithContextDialer(createDialer(s)),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = helloworld.NewGreeterClient(conn).SayHello(context.Background(), &helloworld.HelloRequest{Name: "Pupo"})
+	require.Error(t, err)
+
+	op := mh.operation(t, false)
+	assert.Equal(t, int(codes.NotFound), op.StatusCode)
+	assert.Zero(t, op.ResponseSize)
+}
+
+func TestStreamInterceptorsRecordMetrics(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	mh := &mockMetricsHandler{}
+	spans := []*mock.Span{}
+	conn := dialChat(t,
+		[]grpc.ServerOption{grpc.StreamInterceptor(WrapStreamServerInterceptor(
+			makeMockStreamServerInterceptor(&spans), mock.SpanFromContext, &Options{}, nil, mh,
+		))},
+		grpc.WithStreamInterceptor(WrapStreamClientInterceptor(
+			makeMockStreamClientInterceptor(&spans), mock.SpanFromContext, &Options{}, nil, mh,
+		)),
+	)
+
+	replies, err := chat(context.Background(), conn, "Pupo", "Rudy")
+	require.NoError(t, err)
+	require.Len(t, replies, 2)
+
+	requestSize := int64(proto.Size(&helloworld.HelloRequest{Name: "Pupo"}) + proto.Size(&helloworld.HelloRequest{Name: "Rudy"}))
+	responseSize := int64(proto.Size(&helloworld.HelloReply{Message: "Hello Pupo"}) + proto.Size(&helloworld.HelloReply{Message: "Hello Rudy"}))
+	for _, isClient := range []bool{true, false} {
+		op := mh.operation(t, isClient)
+		assert.Equal(t, "/helloworld.Chat/Chat", op.FullMethod)
+		assert.Equal(t, int(codes.OK), op.StatusCode)
+		assert.Equal(t, requestSize, op.RequestSize)
+		assert.Equal(t, responseSize, op.ResponseSize)
+	}
+}
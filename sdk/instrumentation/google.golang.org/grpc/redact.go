@@ -0,0 +1,193 @@
+package grpc // import "github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc"
+
+import (
+	"sync"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	// sensitiveFieldOptionNumber is the number of the (hypertrace.sensitive) field option
+	// declared in proto/hypertrace/options.proto.
+	sensitiveFieldOptionNumber = 50127
+	sensitiveFieldOptionName   = "hypertrace.sensitive"
+
+	redactedValue = "[REDACTED]"
+)
+
+// redactor removes the masked fields and the fields nested deeper than the max depth
+// from the messages before they are serialized.
+type redactor struct {
+	maskedFields  map[protoreflect.FullName]struct{}
+	maskSensitive bool
+	maxDepth      int
+
+	// sensitiveFields caches whether a field has the (hypertrace.sensitive) option.
+	sensitiveFields sync.Map // map[protoreflect.FullName]bool
+}
+
+func newRedactor(opts *MarshalOptions) *redactor {
+	if opts == nil || (len(opts.MaskedFields) == 0 && opts.MaxDepth <= 0 && !opts.MaskSensitiveFields) {
+		return nil
+	}
+
+	r := &redactor{
+		maskedFields:  make(map[protoreflect.FullName]struct{}, len(opts.MaskedFields)),
+		maskSensitive: opts.MaskSensitiveFields,
+		maxDepth:      opts.MaxDepth,
+	}
+	for _, name := range opts.MaskedFields {
+		r.maskedFields[protoreflect.FullName(name)] = struct{}{}
+	}
+	return r
+}
+
+// redact returns a redacted copy of the message, the original message is left untouched.
+func (r *redactor) redact(msg proto.Message) proto.Message {
+	if r == nil {
+		return msg
+	}
+
+	msg = proto.Clone(msg)
+	r.redactMessage(msg.ProtoReflect(), 1)
+	return msg
+}
+
+func (r *redactor) redactMessage(m protoreflect.Message, depth int) {
+	// the fields are collected first as the message can't be modified while ranging over it
+	var fields []protoreflect.FieldDescriptor
+	m.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		fields = append(fields, fd)
+		return true
+	})
+
+	for _, fd := range fields {
+		v := m.Get(fd)
+		if r.isMasked(fd) {
+			r.mask(m, fd, v)
+			continue
+		}
+
+		if !isMessageField(fd) {
+			continue
+		}
+
+		if r.maxDepth > 0 && depth >= r.maxDepth {
+			m.Clear(fd)
+			continue
+		}
+
+		switch {
+		case fd.IsList():
+			list := v.List()
+			for i := 0; i < list.Len(); i++ {
+				r.redactMessage(list.Get(i).Message(), depth+1)
+			}
+		case fd.IsMap():
+			v.Map().Range(func(_ protoreflect.MapKey, mv protoreflect.Value) bool {
+				r.redactMessage(mv.Message(), depth+1)
+				return true
+			})
+		default:
+			r.redactMessage(v.Message(), depth+1)
+		}
+	}
+}
+
+// mask replaces the string values by a placeholder and clears the fields of other kinds.
+func (r *redactor) mask(m protoreflect.Message, fd protoreflect.FieldDescriptor, v protoreflect.Value) {
+	if fd.Kind() != protoreflect.StringKind || fd.IsMap() {
+		m.Clear(fd)
+		return
+	}
+
+	if fd.IsList() {
+		list := v.List()
+		for i := 0; i < list.Len(); i++ {
+			list.Set(i, protoreflect.ValueOfString(redactedValue))
+		}
+		return
+	}
+
+	m.Set(fd, protoreflect.ValueOfString(redactedValue))
+}
+
+func (r *redactor) isMasked(fd protoreflect.FieldDescriptor) bool {
+	if _, ok := r.maskedFields[fd.FullName()]; ok {
+		return true
+	}
+
+	if !r.maskSensitive {
+		return false
+	}
+
+	if sensitive, ok := r.sensitiveFields.Load(fd.FullName()); ok {
+		return sensitive.(bool)
+	}
+	sensitive := hasSensitiveOption(fd)
+	r.sensitiveFields.Store(fd.FullName(), sensitive)
+	return sensitive
+}
+
+func isMessageField(fd protoreflect.FieldDescriptor) bool {
+	if fd.IsMap() {
+		return isMessageField(fd.MapValue())
+	}
+	return fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind
+}
+
+// hasSensitiveOption tells whether the field is annotated with (hypertrace.sensitive) = true.
+// The option is looked up both as a known extension, when the generated code of the options
+// is linked, and in the unknown fields of the options otherwise.
+func hasSensitiveOption(fd protoreflect.FieldDescriptor) bool {
+	opts, ok := fd.Options().(proto.Message)
+	if !ok || opts == nil {
+		return false
+	}
+
+	m := opts.ProtoReflect()
+	if !m.IsValid() {
+		return false
+	}
+
+	sensitive := false
+	m.Range(func(ext protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if ext.IsExtension() && ext.FullName() == sensitiveFieldOptionName {
+			sensitive = v.Bool()
+			return false
+		}
+		return true
+	})
+	if sensitive {
+		return true
+	}
+
+	unknown := m.GetUnknown()
+	for len(unknown) > 0 {
+		num, typ, n := protowire.ConsumeTag(unknown)
+		if n < 0 {
+			return false
+		}
+		unknown = unknown[n:]
+
+		if num == sensitiveFieldOptionNumber && typ == protowire.VarintType {
+			v, n := protowire.ConsumeVarint(unknown)
+			if n < 0 {
+				return false
+			}
+			// the last occurrence wins
+			sensitive = v != 0
+			unknown = unknown[n:]
+			continue
+		}
+
+		n = protowire.ConsumeFieldValue(num, typ, unknown)
+		if n < 0 {
+			return false
+		}
+		unknown = unknown[n:]
+	}
+	return sensitive
+}
@@ -0,0 +1,169 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc/internal/helloworld"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// sensitiveOptions returns field options with (hypertrace.sensitive) = true as they are
+// parsed when the generated code of the option is not linked.
+func sensitiveOptions() *descriptorpb.FieldOptions {
+	opts := &descriptorpb.FieldOptions{}
+	raw := protowire.AppendTag(nil, sensitiveFieldOptionNumber, protowire.VarintType)
+	opts.ProtoReflect().SetUnknown(protowire.AppendVarint(raw, 1))
+	return opts
+}
+
+// loginDescriptor builds the descriptor of:
+//
+//	enum Role { GUEST = 0; ADMIN = 1; }
+//	message Credentials {
+//	  string user_name = 1;
+//	  string password = 2 [(hypertrace.sensitive) = true];
+//	  int64 pin = 3 [(hypertrace.sensitive) = true];
+//	}
+//	message Login {
+//	  Credentials credentials = 1;
+//	  repeated string tokens = 2;
+//	  Role role = 3;
+//	  bool remember = 4;
+//	}
+func loginDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Type:     typ.Enum(),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		}
+	}
+
+	userName := field("user_name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING)
+	userName.JsonName = proto.String("userName")
+	password := field("password", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING)
+	password.Options = sensitiveOptions()
+	pin := field("pin", 3, descriptorpb.FieldDescriptorProto_TYPE_INT64)
+	pin.Options = sensitiveOptions()
+
+	credentials := field("credentials", 1, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE)
+	credentials.TypeName = proto.String(".acme.Credentials")
+	tokens := field("tokens", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING)
+	tokens.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	role := field("role", 3, descriptorpb.FieldDescriptorProto_TYPE_ENUM)
+	role.TypeName = proto.String(".acme.Role")
+	remember := field("remember", 4, descriptorpb.FieldDescriptorProto_TYPE_BOOL)
+
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("acme/login.proto"),
+		Package: proto.String("acme"),
+		Syntax:  proto.String("proto3"),
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Role"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("GUEST"), Number: proto.Int32(0)},
+				{Name: proto.String("ADMIN"), Number: proto.Int32(1)},
+			},
+		}},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("Credentials"), Field: []*descriptorpb.FieldDescriptorProto{userName, password, pin}},
+			{Name: proto.String("Login"), Field: []*descriptorpb.FieldDescriptorProto{credentials, tokens, role, remember}},
+		},
+	}, nil)
+	require.NoError(t, err)
+	return fd.Messages().ByName("Login")
+}
+
+func newLogin(t *testing.T) *dynamicpb.Message {
+	desc := loginDescriptor(t)
+	credentialsDesc := desc.Fields().ByName("credentials").Message()
+
+	credentials := dynamicpb.NewMessage(credentialsDesc)
+	credentials.Set(credentialsDesc.Fields().ByName("user_name"), protoreflect.ValueOfString("pupo"))
+	credentials.Set(credentialsDesc.Fields().ByName("password"), protoreflect.ValueOfString("s3cr3t"))
+	credentials.Set(credentialsDesc.Fields().ByName("pin"), protoreflect.ValueOfInt64(1234))
+
+	login := dynamicpb.NewMessage(desc)
+	login.Set(desc.Fields().ByName("credentials"), protoreflect.ValueOfMessage(credentials))
+	tokens := login.Mutable(desc.Fields().ByName("tokens")).List()
+	tokens.Append(protoreflect.ValueOfString("token-1"))
+	tokens.Append(protoreflect.ValueOfString("token-2"))
+	login.Set(desc.Fields().ByName("role"), protoreflect.ValueOfEnum(1))
+	return login
+}
+
+func marshalLogin(t *testing.T, opts *MarshalOptions, login proto.Message) string {
+	body, err := newMessageMarshaler(&Options{MarshalOptions: opts}).marshal(context.Background(), "/acme.Auth/Login", "request", login)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func assertJSONEqual(t *testing.T, expected, actual string) {
+	ok, err := jsonEqual(expected, actual)
+	require.NoError(t, err)
+	assert.True(t, ok, "unexpected JSON:\nwant %s,\nhave %s", expected, actual)
+}
+
+func TestMarshalOptions(t *testing.T) {
+	login := newLogin(t)
+
+	assertJSONEqual(t,
+		`{"credentials":{"userName":"pupo","password":"s3cr3t","pin":"1234"},"tokens":["token-1","token-2"],"role":"ADMIN"}`,
+		marshalLogin(t, nil, login),
+	)
+
+	assertJSONEqual(t,
+		`{"credentials":{"user_name":"pupo","password":"s3cr3t","pin":"1234"},"tokens":["token-1","token-2"],"role":1,"remember":false}`,
+		marshalLogin(t, &MarshalOptions{EmitUnpopulated: true, UseProtoNames: true, UseEnumNumbers: true}, login),
+	)
+}
+
+func TestMarshalOptionsMasking(t *testing.T) {
+	login := newLogin(t)
+
+	assertJSONEqual(t,
+		`{"credentials":{"userName":"pupo","password":"[REDACTED]"},"tokens":["token-1","token-2"],"role":"ADMIN"}`,
+		marshalLogin(t, &MarshalOptions{MaskSensitiveFields: true}, login),
+	)
+
+	assertJSONEqual(t,
+		`{"credentials":{"userName":"[REDACTED]","password":"s3cr3t","pin":"1234"},"tokens":["[REDACTED]","[REDACTED]"],"role":"ADMIN"}`,
+		marshalLogin(t, &MarshalOptions{MaskedFields: []string{"acme.Credentials.user_name", "acme.Login.tokens"}}, login),
+	)
+
+	// the original message is not modified
+	assertJSONEqual(t,
+		`{"credentials":{"userName":"pupo","password":"s3cr3t","pin":"1234"},"tokens":["token-1","token-2"],"role":"ADMIN"}`,
+		marshalLogin(t, nil, login),
+	)
+}
+
+func TestMarshalOptionsMaxDepth(t *testing.T) {
+	assertJSONEqual(t,
+		`{"tokens":["token-1","token-2"],"role":"ADMIN"}`,
+		marshalLogin(t, &MarshalOptions{MaxDepth: 1}, newLogin(t)),
+	)
+
+	assertJSONEqual(t,
+		`{"credentials":{"userName":"pupo","password":"s3cr3t","pin":"1234"},"tokens":["token-1","token-2"],"role":"ADMIN"}`,
+		marshalLogin(t, &MarshalOptions{MaxDepth: 2}, newLogin(t)),
+	)
+}
+
+func TestMarshalOptionsMaskingGeneratedMessages(t *testing.T) {
+	body := marshalLogin(t,
+		&MarshalOptions{MaskedFields: []string{"helloworld.HelloRequest.name"}, MaskSensitiveFields: true},
+		&helloworld.HelloRequest{Name: "Pupo"},
+	)
+	assertJSONEqual(t, `{"name":"[REDACTED]"}`, body)
+}
@@ -1,14 +1,38 @@
 package grpc // import "github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc"
 
 import (
+	"context"
+	"encoding/base64"
+
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
 )
 
-// We need a marshaller that does not omit the zero (e.g. 0 or false) to not to lose potentially
-// interesting information.
+// marshaler is the default JSON marshaler, zero values (e.g. 0 or false) are omitted unless
+// MarshalOptions.EmitUnpopulated is set.
 var marshaler = protojson.MarshalOptions{EmitUnpopulated: false}
 
+// MarshalOptions configures the serialization of the messages recorded as RPC bodies.
+type MarshalOptions struct {
+	// EmitUnpopulated emits the fields with zero values (e.g. 0 or false) which
+	// might be interesting information.
+	EmitUnpopulated bool
+	// UseProtoNames uses the proto field names instead of the lowerCamelCase names.
+	UseProtoNames bool
+	// UseEnumNumbers emits the enum values as numbers instead of their names.
+	UseEnumNumbers bool
+	// MaxDepth is the number of nested message levels recorded, deeper messages are
+	// omitted. Zero means no limit.
+	MaxDepth int
+	// MaskedFields are the full names of the fields redacted from the bodies,
+	// e.g. "acme.v1.LoginRequest.password".
+	MaskedFields []string
+	// MaskSensitiveFields redacts the fields annotated with the (hypertrace.sensitive)
+	// option declared in proto/hypertrace/options.proto.
+	MaskSensitiveFields bool
+}
+
 // MarshalMessageableJSON marshals a value that can be cast as proto.Message into JSON.
 func marshalMessageableJSON(messageable interface{}) ([]byte, error) {
 	if msg, ok := messageable.(proto.Message); ok {
@@ -17,3 +41,102 @@ func marshalMessageableJSON(messageable interface{}) ([]byte, error) {
 
 	return nil, nil
 }
+
+// messageMarshaler marshals the messages of an RPC into JSON. Raw frames ([]byte or *[]byte
+// messages) are decoded using the descriptors of the method when a resolver is configured
+// and recorded base64 encoded when the descriptors aren't available.
+type messageMarshaler struct {
+	json        protojson.MarshalOptions
+	redactor    *redactor
+	descriptors *descriptorCache
+}
+
+func newMessageMarshaler(options *Options) *messageMarshaler {
+	m := &messageMarshaler{json: marshaler}
+	if options == nil {
+		return m
+	}
+
+	if opts := options.MarshalOptions; opts != nil {
+		m.json = protojson.MarshalOptions{
+			EmitUnpopulated: opts.EmitUnpopulated,
+			UseProtoNames:   opts.UseProtoNames,
+			UseEnumNumbers:  opts.UseEnumNumbers,
+		}
+		m.redactor = newRedactor(opts)
+	}
+
+	if options.DescriptorResolver != nil {
+		m.descriptors = newDescriptorCache(options.DescriptorResolver)
+	}
+	return m
+}
+
+// marshal marshals a request or response message of the given method, _type being
+// "request" or "response".
+func (m *messageMarshaler) marshal(ctx context.Context, fullMethod, _type string, messageable interface{}) ([]byte, error) {
+	if m == nil {
+		return marshalMessageableJSON(messageable)
+	}
+
+	raw, ok := rawFrame(messageable)
+	if !ok {
+		if msg, ok := messageable.(proto.Message); ok {
+			return m.marshalProto(msg)
+		}
+		return nil, nil
+	}
+
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	if m.descriptors != nil {
+		if body, err := m.decode(ctx, fullMethod, _type, raw); err == nil {
+			return body, nil
+		}
+	}
+
+	return []byte(base64.StdEncoding.EncodeToString(raw)), nil
+}
+
+func (m *messageMarshaler) marshalProto(msg proto.Message) ([]byte, error) {
+	return m.json.Marshal(m.redactor.redact(msg))
+}
+
+func (m *messageMarshaler) decode(ctx context.Context, fullMethod, _type string, raw []byte) ([]byte, error) {
+	desc, err := m.descriptors.messageDescriptor(ctx, fullMethod, _type)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := dynamicpb.NewMessage(desc)
+	if err := proto.Unmarshal(raw, msg); err != nil {
+		return nil, err
+	}
+	return m.marshalProto(msg)
+}
+
+// requestBodyReader returns the body reader of the filter requests, nil when there is no
+// request message.
+func (m *messageMarshaler) requestBodyReader(ctx context.Context, fullMethod string, req interface{}) func() ([]byte, error) {
+	if req == nil {
+		return nil
+	}
+	return func() ([]byte, error) {
+		return m.marshal(ctx, fullMethod, "request", req)
+	}
+}
+
+func rawFrame(messageable interface{}) ([]byte, bool) {
+	switch frame := messageable.(type) {
+	case []byte:
+		return frame, true
+	case *[]byte:
+		if frame == nil {
+			return nil, true
+		}
+		return *frame, true
+	}
+	return nil, false
+}
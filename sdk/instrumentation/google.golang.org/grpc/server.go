@@ -3,24 +3,38 @@ package grpc // import "github.com/hypertrace/goagent/sdk/instrumentation/google
 import (
 	"context"
 	"net/http"
-	"strings"
 
 	config "github.com/hypertrace/agent-config/gen/go/v1"
 	"github.com/hypertrace/goagent/sdk"
-	codes "github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/exclusion"
 	"github.com/hypertrace/goagent/sdk/filter"
 	internalconfig "github.com/hypertrace/goagent/sdk/internal/config"
-	"github.com/hypertrace/goagent/sdk/internal/container"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/stats"
 	"google.golang.org/grpc/status"
 )
 
-// Options for gRPC instrumentation
+// Options for gRPC server and client instrumentation
 type Options struct {
 	Filter filter.Filter
+	// MaxStreamMessages is the number of messages recorded per direction in streaming
+	// RPCs, defaults to 5. A negative value disables the recording of the messages.
+	MaxStreamMessages int
+	// DescriptorResolver finds the descriptors used to decode the raw frames of RPCs
+	// handled without generated types. Raw frames are recorded base64 encoded when nil.
+	DescriptorResolver DescriptorResolver
+	// MarshalOptions configures the serialization and the redaction of the recorded
+	// bodies, the defaults are used when nil.
+	MarshalOptions *MarshalOptions
+	// Exclusions are the rules of the RPCs whose data is not captured. Skipping the
+	// span creation is up to the instrumentation creating the spans.
+	Exclusions exclusion.Rules
+	// PanicRecovery tells whether the panics of the server handlers are recorded on the
+	// span and whether they are turned into an Internal error, disabled by default.
+	PanicRecovery sdk.PanicRecovery
 }
 
 // WrapUnaryServerInterceptor returns an interceptor that records the request and response message's body
@@ -30,16 +44,10 @@ func WrapUnaryServerInterceptor(
 	spanFromContext sdk.SpanFromContext,
 	options *Options,
 	spanAttributes map[string]string,
+	mh sdk.RpcOperationMetricsHandler,
 ) grpc.UnaryServerInterceptor {
-	defaultAttributes := map[string]string{
-		"rpc.system": "grpc",
-	}
-	for k, v := range spanAttributes {
-		defaultAttributes[k] = v
-	}
-	if containerID, err := container.GetID(); err == nil {
-		defaultAttributes["container_id"] = containerID
-	}
+	defaultAttributes := newDefaultAttributes(spanAttributes)
+	marshaler := newMessageMarshaler(options)
 
 	return func(
 		ctx context.Context,
@@ -47,15 +55,23 @@ func WrapUnaryServerInterceptor(
 		info *grpc.UnaryServerInfo,
 		handler grpc.UnaryHandler,
 	) (resp interface{}, err error) {
+		metrics := newRPCMetrics(mh, info.FullMethod, false)
+		metrics.addRequest(req)
+
 		// GRPC interceptors do not support request/response parsing so the only way to
 		// achieve it is by wrapping the handler (where we can still access the current
 		// span).
-		return delegateInterceptor(
+		resp, err = delegateInterceptor(
 			ctx,
 			req,
 			info,
-			wrapHandler(info.FullMethod, handler, spanFromContext, defaultAttributes, internalconfig.GetConfig().GetDataCapture(), options),
+			wrapHandler(info.FullMethod, recoverUnaryHandler(handler, spanFromContext, options), spanFromContext, defaultAttributes, internalconfig.GetConfig().GetDataCapture(), options, marshaler),
 		)
+		if err == nil {
+			metrics.addResponse(resp)
+		}
+		metrics.record(ctx, err)
+		return resp, err
 	}
 }
 
@@ -66,6 +82,7 @@ func wrapHandler(
 	defaultAttributes map[string]string,
 	dataCaptureConfig *config.DataCapture,
 	options *Options,
+	marshaler *messageMarshaler,
 ) grpc.UnaryHandler {
 	return func(ctx context.Context, req interface{}) (interface{}, error) {
 		span := spanFromContext(ctx)
@@ -77,58 +94,62 @@ func wrapHandler(
 			return delegateHandler(ctx, req)
 		}
 
-		var filter filter.Filter = &filter.NoopFilter{}
+		var f filter.Filter = &filter.NoopFilter{}
 		if options != nil && options.Filter != nil {
-			filter = options.Filter
+			f = options.Filter
 		}
 
-		for key, value := range defaultAttributes {
-			span.SetAttribute(key, value)
-		}
-
-		pieces := strings.Split(fullMethod[1:], "/")
-		span.SetAttribute("rpc.service", pieces[0])
-		span.SetAttribute("rpc.method", pieces[1])
+		excluded := options != nil && isExcludedServerRPC(ctx, options.Exclusions, fullMethod)
+		if !excluded {
+			for key, value := range defaultAttributes {
+				span.SetAttribute(key, value)
+			}
 
-		span.SetAttribute("rpc.request.metadata.:method", http.MethodPost)
+			setMethodAttributes(fullMethod, span)
 
-		setSchemeAttributes(ctx, span)
+			span.SetAttribute("rpc.request.metadata.:method", http.MethodPost)
 
-		if dataCaptureConfig.RpcMetadata.Request.Value {
-			setAttributesFromRequestIncomingMetadata(ctx, span)
-		}
+			setSchemeAttributes(ctx, span)
 
-		reqBody, err := marshalMessageableJSON(req)
-		if dataCaptureConfig.RpcBody.Request.Value &&
-			len(reqBody) > 0 && err == nil {
-			setTruncatedBodyAttribute("request", reqBody, int(dataCaptureConfig.BodyMaxSizeBytes.Value), span)
+			if dataCaptureConfig.RpcMetadata.Request.Value {
+				setAttributesFromRequestIncomingMetadata(ctx, span)
+			}
 
+			reqBody, err := marshaler.marshal(ctx, fullMethod, "request", req)
+			if dataCaptureConfig.RpcBody.Request.Value &&
+				len(reqBody) > 0 && err == nil {
+				setTruncatedBodyAttribute("request", reqBody, int(dataCaptureConfig.BodyMaxSizeBytes.Value), span)
+			}
 		}
 
 		// TODO: decide what should be passed as URL in GRPC
 		// single evaluation call to filter after capturing the configured parameters
-		filterResult := filter.Evaluate(span)
+		filterResult := filter.EvaluateRequest(ctx, f, span, newFilterRequest(ctx, fullMethod, req, marshaler))
 		if filterResult.Block {
-			return nil, status.Error(StatusCode(int(filterResult.ResponseStatusCode)), StatusText(int(filterResult.ResponseStatusCode)))
+			return nil, blockedError(filterResult)
 		} else if filterResult.Decorations != nil {
 			if md, ok := metadata.FromIncomingContext(ctx); ok {
-				for _, header := range filterResult.Decorations.RequestHeaderInjections {
-					md.Append(header.Key, header.Value)
-					span.SetAttribute("rpc.request.metadata."+header.Key, header.Value)
-				}
-				ctx = metadata.NewIncomingContext(ctx, md)
+				ctx = metadata.NewIncomingContext(ctx, applyDecorations(md, filterResult.Decorations, span))
 			}
 		}
 
+		if excluded {
+			return delegateHandler(ctx, req)
+		}
+
+		var responseMetadata *metadataRecorder
+		if dataCaptureConfig.RpcMetadata.Response.Value {
+			ctx, responseMetadata = contextWithMetadataRecorder(ctx)
+		}
+
 		res, err := delegateHandler(ctx, req)
+		responseMetadata.setAttributes(span)
 		if err != nil {
-			s, _ := status.FromError(err)
-			span.SetStatus(codes.StatusCodeError, s.Message())
-			span.SetAttribute("rpc.grpc.status_code", s.Code())
+			setErrorAttributes(err, span, int(dataCaptureConfig.BodyMaxSizeBytes.Value))
 			return res, err
 		}
 
-		resBody, err := marshalMessageableJSON(res)
+		resBody, err := marshaler.marshal(ctx, fullMethod, "response", res)
 		if dataCaptureConfig.RpcBody.Response.Value &&
 			len(resBody) > 0 && err == nil {
 			setTruncatedBodyAttribute("response", resBody, int(dataCaptureConfig.BodyMaxSizeBytes.Value), span)
@@ -138,6 +159,53 @@ func wrapHandler(
 	}
 }
 
+// recoverUnaryHandler records the panics of the handler on the span when enabled, either
+// panicking again or returning an Internal error.
+func recoverUnaryHandler(delegateHandler grpc.UnaryHandler, spanFromContext sdk.SpanFromContext, options *Options) grpc.UnaryHandler {
+	if options == nil || options.PanicRecovery == sdk.PanicRecoveryDisabled {
+		return delegateHandler
+	}
+
+	return func(ctx context.Context, req interface{}) (resp interface{}, err error) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				err = handlePanic(spanFromContext(ctx), recovered, options.PanicRecovery)
+			}
+		}()
+
+		return delegateHandler(ctx, req)
+	}
+}
+
+// recoverStreamHandler is the streaming counterpart of recoverUnaryHandler.
+func recoverStreamHandler(delegateHandler grpc.StreamHandler, spanFromContext sdk.SpanFromContext, options *Options) grpc.StreamHandler {
+	if options == nil || options.PanicRecovery == sdk.PanicRecoveryDisabled {
+		return delegateHandler
+	}
+
+	return func(srv interface{}, ss grpc.ServerStream) (err error) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				err = handlePanic(spanFromContext(ss.Context()), recovered, options.PanicRecovery)
+			}
+		}()
+
+		return delegateHandler(srv, ss)
+	}
+}
+
+// handlePanic records the recovered panic on the span and returns the error the RPC
+// finishes with, unless the panic has to be propagated. It must be called from the
+// deferred function recovering the panic.
+func handlePanic(span sdk.Span, recovered interface{}, recovery sdk.PanicRecovery) error {
+	respond := recovery == sdk.PanicRecoveryRespond
+	sdk.RecordPanic(span, recovered, !respond)
+	if !respond {
+		panic(recovered)
+	}
+	return status.Error(codes.Internal, "internal error")
+}
+
 var _ stats.Handler = (*handler)(nil)
 
 type handler struct {
@@ -145,6 +213,9 @@ type handler struct {
 	spanFromContext   sdk.SpanFromContext
 	defaultAttributes map[string]string
 	dataCaptureConfig *config.DataCapture
+	filter            filter.Filter
+	marshaler         *messageMarshaler
+	exclusions        exclusion.Rules
 }
 
 // HandleRPC implements per-RPC tracing and stats instrumentation.
@@ -160,21 +231,41 @@ func (s *handler) HandleRPC(ctx context.Context, rs stats.RPCStats) {
 		return
 	}
 
+	if isExcludedFromContext(ctx) {
+		filterExcludedRPC(ctx, span, rs)
+		return
+	}
+
+	if rs.IsClient() {
+		setAttemptAttributes(ctx, rs, span)
+	}
+
 	switch rs := rs.(type) {
 	case *stats.Begin:
 		for key, value := range s.defaultAttributes {
 			span.SetAttribute(key, value)
 		}
+	case *stats.End:
+		if rs.Error != nil {
+			setErrorAttributes(rs.Error, span, int(s.dataCaptureConfig.BodyMaxSizeBytes.Value))
+		}
 	case *stats.InPayload:
-		body, err := marshalMessageableJSON(rs.Payload)
-		if len(body) == 0 || err != nil {
-			return
+		_type := "request"
+		if rs.IsClient() {
+			_type = "response"
+		}
+		body, err := s.marshaler.marshal(ctx, fullMethodFromContext(ctx), _type, rs.Payload)
+		if len(body) > 0 && err == nil {
+			if rs.IsClient() && s.dataCaptureConfig.RpcBody.Response.Value {
+				setTruncatedBodyAttribute("response", body, int(s.dataCaptureConfig.BodyMaxSizeBytes.Value), span)
+			} else if !rs.IsClient() && s.dataCaptureConfig.RpcBody.Request.Value {
+				setTruncatedBodyAttribute("request", body, int(s.dataCaptureConfig.BodyMaxSizeBytes.Value), span)
+			}
 		}
 
-		if rs.IsClient() && s.dataCaptureConfig.RpcBody.Response.Value {
-			setTruncatedBodyAttribute("response", body, int(s.dataCaptureConfig.BodyMaxSizeBytes.Value), span)
-		} else if !rs.IsClient() && s.dataCaptureConfig.RpcBody.Request.Value {
-			setTruncatedBodyAttribute("request", body, int(s.dataCaptureConfig.BodyMaxSizeBytes.Value), span)
+		if state := filterStateFromContext(ctx); state != nil && !rs.IsClient() {
+			// single evaluation call to filter after capturing the first message
+			state.evaluate(ctx, span, rs.Payload)
 		}
 	case *stats.InHeader:
 		if rs.IsClient() && s.dataCaptureConfig.RpcMetadata.Response.Value {
@@ -182,6 +273,10 @@ func (s *handler) HandleRPC(ctx context.Context, rs stats.RPCStats) {
 		} else if !rs.IsClient() && s.dataCaptureConfig.RpcMetadata.Request.Value {
 			setAttributesFromMetadata("request", rs.Header, span)
 		}
+
+		if state := filterStateFromContext(ctx); state != nil && !rs.IsClient() {
+			state.setHeader(span, rs)
+		}
 	case *stats.InTrailer:
 		if rs.IsClient() && s.dataCaptureConfig.RpcMetadata.Response.Value {
 			setAttributesFromMetadata("response", rs.Trailer, span)
@@ -189,7 +284,11 @@ func (s *handler) HandleRPC(ctx context.Context, rs stats.RPCStats) {
 			setAttributesFromMetadata("request", rs.Trailer, span)
 		}
 	case *stats.OutPayload:
-		body, err := marshalMessageableJSON(rs.Payload)
+		_type := "response"
+		if rs.IsClient() {
+			_type = "request"
+		}
+		body, err := s.marshaler.marshal(ctx, fullMethodFromContext(ctx), _type, rs.Payload)
 		if len(body) == 0 || err != nil {
 			return
 		}
@@ -214,6 +313,21 @@ func (s *handler) HandleRPC(ctx context.Context, rs stats.RPCStats) {
 	}
 }
 
+// filterExcludedRPC feeds the filter of an excluded server RPC without capturing its data.
+func filterExcludedRPC(ctx context.Context, span sdk.Span, rs stats.RPCStats) {
+	state := filterStateFromContext(ctx)
+	if state == nil || rs.IsClient() {
+		return
+	}
+
+	switch rs := rs.(type) {
+	case *stats.InHeader:
+		state.setHeader(span, rs)
+	case *stats.InPayload:
+		state.evaluate(ctx, span, rs.Payload)
+	}
+}
+
 func (s *handler) TagRPC(ctx context.Context, rti *stats.RPCTagInfo) context.Context {
 	ctx = s.Handler.TagRPC(ctx, rti)
 	span := s.spanFromContext(ctx)
@@ -225,21 +339,37 @@ func (s *handler) TagRPC(ctx context.Context, rti *stats.RPCTagInfo) context.Con
 		return ctx
 	}
 
-	pieces := strings.Split(rti.FullMethodName[1:], "/")
-	span.SetAttribute("rpc.service", pieces[0])
-	span.SetAttribute("rpc.method", pieces[1])
+	if isExcludedServerRPC(ctx, s.exclusions, rti.FullMethodName) {
+		ctx = contextWithExcluded(ctx)
+	} else {
+		setMethodAttributes(rti.FullMethodName, span)
+	}
+
+	if s.marshaler.descriptors != nil {
+		// raw frames are decoded using the method descriptors
+		ctx = contextWithFullMethod(ctx, rti.FullMethodName)
+	}
+
+	if s.filter != nil {
+		ctx = contextWithFilterState(ctx, &filterState{filter: s.filter, fullMethod: rti.FullMethodName, marshaler: s.marshaler})
+	}
 
 	return ctx
 }
 
 // WrapStatsHandler wraps an instrumented StatsHandler and returns a new one that records
-// the request/response body and metadata.
-func WrapStatsHandler(delegate stats.Handler, spanFromContext sdk.SpanFromContext) stats.Handler {
-	defaultAttributes := map[string]string{
-		"rpc.system": "grpc",
-	}
-	if containerID, err := container.GetID(); err == nil {
-		defaultAttributes["container_id"] = containerID
+// the request/response body and metadata. On the server side, the filter is evaluated once
+// the request metadata and the first request message are received, but as stats handlers
+// can't abort RPCs, blocking the request requires adding the FilterUnaryServerInterceptor
+// and FilterStreamServerInterceptor interceptors to the server.
+func WrapStatsHandler(delegate stats.Handler, spanFromContext sdk.SpanFromContext, options *Options) stats.Handler {
+	defaultAttributes := newDefaultAttributes(nil)
+
+	var f filter.Filter
+	var exclusions exclusion.Rules
+	if options != nil {
+		f = options.Filter
+		exclusions = options.Exclusions
 	}
 
 	return &handler{
@@ -247,7 +377,36 @@ func WrapStatsHandler(delegate stats.Handler, spanFromContext sdk.SpanFromContex
 		spanFromContext:   spanFromContext,
 		defaultAttributes: defaultAttributes,
 		dataCaptureConfig: internalconfig.GetConfig().GetDataCapture(),
+		filter:            f,
+		marshaler:         newMessageMarshaler(options),
+		exclusions:        exclusions,
+	}
+}
+
+type fullMethodKey struct{}
+
+func contextWithFullMethod(ctx context.Context, fullMethod string) context.Context {
+	return context.WithValue(ctx, fullMethodKey{}, fullMethod)
+}
+
+func fullMethodFromContext(ctx context.Context) string {
+	fullMethod, _ := ctx.Value(fullMethodKey{}).(string)
+	return fullMethod
+}
+
+// newFilterRequest builds the request view passed to filters implementing filter.ContextFilter.
+// The message is only serialized when a filter asks for the body.
+func newFilterRequest(ctx context.Context, fullMethod string, req interface{}, marshaler *messageMarshaler) *filter.Request {
+	peerAddress := ""
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		peerAddress = p.Addr.String()
 	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	return filter.NewRequest(fullMethod, fullMethod, peerAddress, NewMetadataAccessor(md), func() ([]byte, error) {
+		return marshaler.marshal(ctx, fullMethod, "request", req)
+	})
 }
 
 func setSchemeAttributes(ctx context.Context, span sdk.Span) {
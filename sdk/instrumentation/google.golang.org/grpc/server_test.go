@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	config "github.com/hypertrace/agent-config/gen/go/v1"
 	"github.com/hypertrace/goagent/sdk"
@@ -39,7 +40,7 @@ func TestServerInterceptorHelloWorldSuccess(t *testing.T) {
 
 	s := grpc.NewServer(
 		grpc.UnaryInterceptor(
-			WrapUnaryServerInterceptor(mockUnaryInterceptor, mock.SpanFromContext, &Options{}, map[string]string{"foo": "bar"}),
+			WrapUnaryServerInterceptor(mockUnaryInterceptor, mock.SpanFromContext, &Options{}, map[string]string{"foo": "bar"}, nil),
 		),
 	)
 	defer s.Stop()
@@ -106,6 +107,7 @@ func TestServerInterceptorFilter(t *testing.T) {
 	tCases := map[string]struct {
 		expectedFilterResult bool
 		expectedStatusCode   codes.Code
+		expectedMessage      string
 		multiFilter          *filter.MultiFilter
 	}{
 		"no filter": {
@@ -143,6 +145,16 @@ func TestServerInterceptorFilter(t *testing.T) {
 				},
 			}),
 		},
+		"filter with response message": {
+			expectedFilterResult: true,
+			expectedStatusCode:   codes.ResourceExhausted,
+			expectedMessage:      "slow down",
+			multiFilter: filter.NewMultiFilter(mock.Filter{
+				Evaluator: func(span sdk.Span) result.FilterResult {
+					return result.FilterResult{Block: true, ResponseStatusCode: 429, ResponseMessage: "slow down"}
+				},
+			}),
+		},
 	}
 
 	spans := []*mock.Span{}
@@ -153,7 +165,7 @@ func TestServerInterceptorFilter(t *testing.T) {
 			// wrap interceptor with filter
 			s := grpc.NewServer(
 				grpc.UnaryInterceptor(
-					WrapUnaryServerInterceptor(mockUnaryInterceptor, mock.SpanFromContext, &Options{Filter: tCase.multiFilter}, map[string]string{}),
+					WrapUnaryServerInterceptor(mockUnaryInterceptor, mock.SpanFromContext, &Options{Filter: tCase.multiFilter}, map[string]string{}, nil),
 				),
 			)
 			defer s.Stop()
@@ -183,6 +195,9 @@ func TestServerInterceptorFilter(t *testing.T) {
 			})
 			if tCase.expectedFilterResult {
 				assert.Equal(t, tCase.expectedStatusCode, status.Code(err))
+				if tCase.expectedMessage != "" {
+					assert.Equal(t, tCase.expectedMessage, status.Convert(err).Message())
+				}
 			} else {
 				assert.Nil(t, err)
 			}
@@ -216,7 +231,7 @@ func TestServerInterceptorFilterWithMaxProcessingBodyLen(t *testing.T) {
 					assert.Equal(t, "{", span.GetAttributes().GetValue("rpc.request.body")) // body is truncated
 					return result.FilterResult{}
 				},
-			}}, nil),
+			}}, nil, nil),
 		),
 	)
 	defer s.Stop()
@@ -265,7 +280,7 @@ func TestServerInterceptorFilterDecorations(t *testing.T) {
 						},
 					}}
 				},
-			}}, nil),
+			}}, nil, nil),
 		),
 	)
 	defer s.Stop()
@@ -332,7 +347,7 @@ func TestServerInterceptorFilterEmptyDecorations(t *testing.T) {
 				Evaluator: func(span sdk.Span) result.FilterResult {
 					return result.FilterResult{Block: false, Decorations: &result.Decorations{}}
 				},
-			}}, nil),
+			}}, nil, nil),
 		),
 	)
 	defer s.Stop()
@@ -378,7 +393,7 @@ func TestServerHandlerHelloWorldSuccess(t *testing.T) {
 	mockHandler := &mockHandler{}
 
 	s := grpc.NewServer(
-		grpc.StatsHandler(WrapStatsHandler(mockHandler, mock.SpanFromContext)),
+		grpc.StatsHandler(WrapStatsHandler(mockHandler, mock.SpanFromContext, &Options{})),
 	)
 	defer s.Stop()
 
@@ -481,3 +496,112 @@ func TestSetSchemeAttributes(t *testing.T) {
 		})
 	}
 }
+
+type contextFilter struct {
+	mock.Filter
+	evaluator func(ctx context.Context, span sdk.Span, req *filter.Request) result.FilterResult
+}
+
+func (f contextFilter) EvaluateWithContext(ctx context.Context, span sdk.Span, req *filter.Request) result.FilterResult {
+	return f.evaluator(ctx, span, req)
+}
+
+func TestServerInterceptorContextFilter(t *testing.T) {
+	cfg := &config.AgentConfig{
+		DataCapture: &config.DataCapture{
+			RpcBody: &config.Message{
+				Request:  config.Bool(false),
+				Response: config.Bool(false),
+			},
+		},
+	}
+	cfg.LoadFromEnv()
+
+	internalconfig.InitConfig(cfg)
+	defer internalconfig.ResetConfig()
+
+	spans := []*mock.Span{}
+	mockUnaryInterceptor := makeMockUnaryServerInterceptor(&spans)
+
+	s := grpc.NewServer(
+		grpc.UnaryInterceptor(
+			WrapUnaryServerInterceptor(mockUnaryInterceptor, mock.SpanFromContext, &Options{Filter: contextFilter{
+				evaluator: func(ctx context.Context, span sdk.Span, req *filter.Request) result.FilterResult {
+					_, hasDeadline := ctx.Deadline()
+					assert.True(t, hasDeadline)
+					assert.Equal(t, "/helloworld.Greeter/SayHello", req.Method)
+					assert.Equal(t, "/helloworld.Greeter/SayHello", req.Route)
+					assert.Equal(t, []string{"test_value"}, req.Headers.Lookup("test_key"))
+
+					// body is not captured but it is still accessible to the filter
+					assert.Nil(t, span.GetAttributes().GetValue("rpc.request.body"))
+					body, err := req.Body()
+					assert.NoError(t, err)
+					assert.JSONEq(t, `{"name":"Pupo"}`, string(body))
+					return result.FilterResult{Block: true, ResponseStatusCode: 403}
+				},
+			}}, nil, nil),
+		),
+	)
+	defer s.Stop()
+
+	helloworld.RegisterGreeterServer(s, &server{})
+
+	dialer := createDialer(s)
+
+	ctx := context.Background()
+	conn, err := grpc.DialContext(
+		ctx,
+		"bufnet",
+		grpc.WithContextDialer(dialer),
+		grpc.WithBlock(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial bufnet: %v", err)
+	}
+	defer conn.Close()
+
+	client := helloworld.NewGreeterClient(conn)
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	ctx = metadata.NewOutgoingContext(ctx, metadata.Pairs("test_key", "test_value"))
+	_, err = client.SayHello(ctx, &helloworld.HelloRequest{
+		Name: "Pupo",
+	})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestServerInterceptorRecordsPanics(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/helloworld.Greeter/SayHello"}
+	panickingHandler := func(context.Context, interface{}) (interface{}, error) {
+		panic("boom")
+	}
+
+	spans := []*mock.Span{}
+	interceptor := WrapUnaryServerInterceptor(makeMockUnaryServerInterceptor(&spans), mock.SpanFromContext,
+		&Options{PanicRecovery: sdk.PanicRecoveryRecord}, map[string]string{}, nil)
+	assert.PanicsWithValue(t, "boom", func() {
+		_, _ = interceptor(context.Background(), &helloworld.HelloRequest{}, info, panickingHandler)
+	})
+
+	event, ok := spans[0].ReadEvent("exception")
+	assert.True(t, ok)
+	assert.Equal(t, "boom", event["exception.message"])
+	assert.Contains(t, event["exception.stacktrace"], "server_test.go")
+	assert.Equal(t, true, event["exception.escaped"])
+	assert.Equal(t, sdk.StatusCodeError, spans[0].Status.Code)
+
+	spans = []*mock.Span{}
+	interceptor = WrapUnaryServerInterceptor(makeMockUnaryServerInterceptor(&spans), mock.SpanFromContext,
+		&Options{PanicRecovery: sdk.PanicRecoveryRespond}, map[string]string{}, nil)
+	_, err := interceptor(context.Background(), &helloworld.HelloRequest{}, info, panickingHandler)
+	assert.Equal(t, codes.Internal, status.Code(err))
+
+	event, ok = spans[0].ReadEvent("exception")
+	assert.True(t, ok)
+	assert.Equal(t, false, event["exception.escaped"])
+}
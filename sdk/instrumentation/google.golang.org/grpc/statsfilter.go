@@ -0,0 +1,170 @@
+package grpc // import "github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc"
+
+import (
+	"context"
+	"sync"
+
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/filter"
+	"github.com/hypertrace/goagent/sdk/filter/result"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/stats"
+)
+
+type filterStateKey struct{}
+
+// filterState holds the filter evaluation of a server RPC instrumented with a stats
+// handler so the filter interceptors can act on it.
+type filterState struct {
+	filter     filter.Filter
+	fullMethod string
+	marshaler  *messageMarshaler
+
+	mux    sync.Mutex
+	span   sdk.Span
+	header metadata.MD
+	peer   string
+
+	once         sync.Once
+	result       result.FilterResult
+	decorateOnce sync.Once
+}
+
+func contextWithFilterState(ctx context.Context, state *filterState) context.Context {
+	return context.WithValue(ctx, filterStateKey{}, state)
+}
+
+func filterStateFromContext(ctx context.Context) *filterState {
+	state, _ := ctx.Value(filterStateKey{}).(*filterState)
+	return state
+}
+
+func (s *filterState) setHeader(span sdk.Span, rs *stats.InHeader) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.span = span
+	s.header = rs.Header
+	if rs.RemoteAddr != nil {
+		s.peer = rs.RemoteAddr.String()
+	}
+}
+
+// evaluate runs the filter once, on the first message received or, when the RPC has
+// no request message, on the metadata only. Later calls return the first result.
+func (s *filterState) evaluate(ctx context.Context, span sdk.Span, firstMessage interface{}) result.FilterResult {
+	s.once.Do(func() {
+		s.mux.Lock()
+		header, peerAddress := s.header, s.peer
+		if span == nil {
+			span = s.span
+		}
+		s.mux.Unlock()
+
+		if span == nil || span.IsNoop() {
+			return
+		}
+
+		req := filter.NewRequest(s.fullMethod, s.fullMethod, peerAddress, NewMetadataAccessor(header), s.marshaler.requestBodyReader(ctx, s.fullMethod, firstMessage))
+		s.result = filter.EvaluateRequest(ctx, s.filter, span, req)
+	})
+	return s.result
+}
+
+// FilterUnaryServerInterceptor rejects the unary RPCs blocked by the filter of the stats
+// handler returned by WrapStatsHandler and applies the metadata decorations.
+func FilterUnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		state := filterStateFromContext(ctx)
+		if state == nil {
+			return handler(ctx, req)
+		}
+
+		// the request message was already received so the filter has been evaluated
+		filterResult := state.evaluate(ctx, nil, nil)
+		if filterResult.Block {
+			return nil, blockedError(filterResult)
+		}
+		return handler(state.decorate(ctx, filterResult), req)
+	}
+}
+
+// FilterStreamServerInterceptor rejects the streaming RPCs blocked by the filter of the
+// stats handler returned by WrapStatsHandler. The stream fails on the first message
+// received or sent.
+func FilterStreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		state := filterStateFromContext(ss.Context())
+		if state == nil {
+			return handler(srv, ss)
+		}
+		return handler(srv, &filteredServerStream{ServerStream: ss, state: state, ctx: ss.Context()})
+	}
+}
+
+type filteredServerStream struct {
+	grpc.ServerStream
+	state *filterState
+
+	ctxMux sync.RWMutex
+	ctx    context.Context
+}
+
+func (s *filteredServerStream) Context() context.Context {
+	s.ctxMux.RLock()
+	defer s.ctxMux.RUnlock()
+	return s.ctx
+}
+
+func (s *filteredServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if filterErr := s.check(); filterErr != nil {
+		return filterErr
+	}
+	return err
+}
+
+func (s *filteredServerStream) SendMsg(m interface{}) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+// check returns the blocking error once the filter has been evaluated, either by
+// the stats handler when the first message was received or here when there is none.
+func (s *filteredServerStream) check() error {
+	ctx := s.Context()
+	filterResult := s.state.evaluate(ctx, nil, nil)
+	if filterResult.Block {
+		return blockedError(filterResult)
+	}
+
+	decorated := s.state.decorate(ctx, filterResult)
+	if decorated != ctx {
+		s.ctxMux.Lock()
+		s.ctx = decorated
+		s.ctxMux.Unlock()
+	}
+	return nil
+}
+
+// decorate applies the metadata decorations to the incoming context, only once per RPC.
+func (s *filterState) decorate(ctx context.Context, filterResult result.FilterResult) context.Context {
+	if filterResult.Decorations == nil {
+		return ctx
+	}
+
+	decorated := ctx
+	s.decorateOnce.Do(func() {
+		s.mux.Lock()
+		span := s.span
+		s.mux.Unlock()
+
+		if md, ok := metadata.FromIncomingContext(ctx); ok && span != nil {
+			decorated = metadata.NewIncomingContext(ctx, applyDecorations(md, filterResult.Decorations, span))
+		}
+	})
+	return decorated
+}
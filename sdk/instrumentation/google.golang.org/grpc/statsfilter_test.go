@@ -0,0 +1,117 @@
+package grpc
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/filter/result"
+	"github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc/internal/helloworld"
+	internalconfig "github.com/hypertrace/goagent/sdk/internal/config"
+	"github.com/hypertrace/goagent/sdk/internal/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// blockBadNamesFilter blocks the requests whose body contains "Bad" and injects
+// a metadata entry otherwise.
+var blockBadNamesFilter = mock.Filter{
+	Evaluator: func(span sdk.Span) result.FilterResult {
+		body, _ := span.GetAttributes().GetValue("rpc.request.body").(string)
+		if strings.Contains(body, "Bad") {
+			return result.FilterResult{Block: true, ResponseStatusCode: 403}
+		}
+		return result.FilterResult{Decorations: &result.Decorations{
+			RequestHeaderInjections: []result.KeyValueString{{Key: "x-filtered", Value: "true"}},
+		}}
+	},
+}
+
+func TestServerHandlerFilter(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	mockHandler := &mockHandler{}
+	mockServer := &server{}
+
+	s := grpc.NewServer(
+		grpc.StatsHandler(WrapStatsHandler(mockHandler, mock.SpanFromContext, &Options{Filter: blockBadNamesFilter})),
+		grpc.UnaryInterceptor(FilterUnaryServerInterceptor()),
+	)
+	defer s.Stop()
+
+	helloworld.RegisterGreeterServer(s, mockServer)
+
+	conn, err := grpc.DialContext(
+		context.Background(),
+		"bufnet",
+		grpc.WithContextDialer(createDialer(s)),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithBlock(),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	client := helloworld.NewGreeterClient(conn)
+
+	_, err = client.SayHello(context.Background(), &helloworld.HelloRequest{Name: "Bad Pupo"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Nil(t, mockServer.requestHeader)
+
+	_, err = client.SayHello(context.Background(), &helloworld.HelloRequest{Name: "Pupo"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"true"}, mockServer.requestHeader.Get("x-filtered"))
+
+	require.Equal(t, 2, len(mockHandler.Spans))
+	assert.Equal(t, "true", mockHandler.Spans[1].ReadAttribute("rpc.request.metadata.x-filtered"))
+}
+
+func TestServerHandlerFilterWithoutInterceptor(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	mockHandler := &mockHandler{}
+
+	s := grpc.NewServer(
+		grpc.StatsHandler(WrapStatsHandler(mockHandler, mock.SpanFromContext, &Options{Filter: blockBadNamesFilter})),
+	)
+	defer s.Stop()
+
+	helloworld.RegisterGreeterServer(s, &server{})
+
+	conn, err := grpc.DialContext(
+		context.Background(),
+		"bufnet",
+		grpc.WithContextDialer(createDialer(s)),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithBlock(),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// the stats handler alone can't block the request
+	_, err = helloworld.NewGreeterClient(conn).SayHello(context.Background(), &helloworld.HelloRequest{Name: "Bad Pupo"})
+	assert.NoError(t, err)
+}
+
+func TestServerHandlerStreamFilter(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	mockHandler := &mockHandler{}
+	conn := dialChat(t, []grpc.ServerOption{
+		grpc.StatsHandler(WrapStatsHandler(mockHandler, mock.SpanFromContext, &Options{Filter: blockBadNamesFilter})),
+		grpc.StreamInterceptor(FilterStreamServerInterceptor()),
+	})
+
+	replies, err := chat(context.Background(), conn, "Bad Pupo", "Cuco")
+	assert.Empty(t, replies)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// only the first message is evaluated
+	replies, err = chat(context.Background(), conn, "Pupo", "Bad Cuco")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Hello Pupo", "Hello Bad Cuco"}, replies)
+}
@@ -1,7 +1,11 @@
 package grpc
 
 import (
+	"net/http"
+
+	"github.com/hypertrace/goagent/sdk/filter/result"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func StatusText(code int) string {
@@ -96,3 +100,17 @@ func StatusCode(code int) codes.Code {
 		return codes.Unknown
 	}
 }
+
+// blockedError returns the status error for a request blocked by a filter. The status
+// code defaults to 403 (PermissionDenied) and the message to its status text.
+func blockedError(filterResult result.FilterResult) error {
+	code := int(filterResult.ResponseStatusCode)
+	if code == 0 {
+		code = http.StatusForbidden
+	}
+	message := filterResult.ResponseMessage
+	if message == "" {
+		message = StatusText(code)
+	}
+	return status.Error(StatusCode(code), message)
+}
@@ -0,0 +1,466 @@
+package grpc // import "github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	config "github.com/hypertrace/agent-config/gen/go/v1"
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/filter"
+	"github.com/hypertrace/goagent/sdk/instrumentation/bodyattribute"
+	internalconfig "github.com/hypertrace/goagent/sdk/internal/config"
+	"github.com/hypertrace/goagent/sdk/internal/container"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+const defaultMaxStreamMessages = 5
+
+// WrapStreamServerInterceptor returns an interceptor that records the metadata, the message
+// counts and the first messages of each direction of the stream. The filter runs once on the
+// initial metadata and the first request message.
+func WrapStreamServerInterceptor(
+	delegateInterceptor grpc.StreamServerInterceptor,
+	spanFromContext sdk.SpanFromContext,
+	options *Options,
+	spanAttributes map[string]string,
+	mh sdk.RpcOperationMetricsHandler,
+) grpc.StreamServerInterceptor {
+	defaultAttributes := newDefaultAttributes(spanAttributes)
+	dataCaptureConfig := internalconfig.GetConfig().GetDataCapture()
+	f, maxMessages := streamOptions(options)
+	marshaler := newMessageMarshaler(options)
+
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		metrics := newRPCMetrics(mh, info.FullMethod, false)
+		if metrics != nil {
+			ss = &meteredServerStream{ServerStream: ss, metrics: metrics}
+		}
+
+		// like in the unary interceptor, messages can only be accessed by wrapping the
+		// handler, where the span is already in the stream context.
+		handler = recoverStreamHandler(handler, spanFromContext, options)
+		err := delegateInterceptor(srv, ss, info, func(srv interface{}, ss grpc.ServerStream) error {
+			ctx := ss.Context()
+			span := spanFromContext(ctx)
+			if span.IsNoop() {
+				return handler(srv, ss)
+			}
+
+			if options != nil && isExcludedServerRPC(ctx, options.Exclusions, info.FullMethod) {
+				return handler(srv, &serverStream{
+					ServerStream: ss,
+					ctx:          ctx,
+					span:         span,
+					fullMethod:   info.FullMethod,
+					filter:       f,
+					marshaler:    marshaler,
+				})
+			}
+
+			for key, value := range defaultAttributes {
+				span.SetAttribute(key, value)
+			}
+			setMethodAttributes(info.FullMethod, span)
+			span.SetAttribute("rpc.request.metadata.:method", http.MethodPost)
+			setSchemeAttributes(ctx, span)
+
+			if dataCaptureConfig.RpcMetadata.Request.Value {
+				setAttributesFromRequestIncomingMetadata(ctx, span)
+			}
+
+			var responseMetadata *metadataRecorder
+			if dataCaptureConfig.RpcMetadata.Response.Value {
+				responseMetadata = &metadataRecorder{}
+			}
+
+			err := handler(srv, &serverStream{
+				ServerStream:     ss,
+				ctx:              ctx,
+				span:             span,
+				fullMethod:       info.FullMethod,
+				filter:           f,
+				marshaler:        marshaler,
+				requests:         newMessageRecorder(ctx, info.FullMethod, "request", span, marshaler, dataCaptureConfig, dataCaptureConfig.RpcBody.Request.Value, maxMessages),
+				responses:        newMessageRecorder(ctx, info.FullMethod, "response", span, marshaler, dataCaptureConfig, dataCaptureConfig.RpcBody.Response.Value, maxMessages),
+				responseMetadata: responseMetadata,
+			})
+			responseMetadata.setAttributes(span)
+			if err != nil {
+				setErrorAttributes(err, span, int(dataCaptureConfig.BodyMaxSizeBytes.Value))
+			}
+			return err
+		})
+		metrics.record(ss.Context(), err)
+		return err
+	}
+}
+
+// serverStream records the messages going through the stream and evaluates the filter
+// before the first request message is handed to the handler.
+type serverStream struct {
+	grpc.ServerStream
+	span       sdk.Span
+	fullMethod string
+	filter     filter.Filter
+	marshaler  *messageMarshaler
+	// requests and responses are nil when the RPC is excluded from the data capture
+	requests  *messageRecorder
+	responses *messageRecorder
+	// responseMetadata is nil when the response metadata is not captured
+	responseMetadata *metadataRecorder
+
+	ctxMux sync.RWMutex
+	ctx    context.Context
+
+	filterOnce    sync.Once
+	filterErr     error
+	halfCloseOnce sync.Once
+}
+
+// Context returns the stream context, including the metadata decorations once the
+// filter ran.
+func (s *serverStream) Context() context.Context {
+	s.ctxMux.RLock()
+	defer s.ctxMux.RUnlock()
+	return s.ctx
+}
+
+func (s *serverStream) SetHeader(md metadata.MD) error {
+	err := s.ServerStream.SetHeader(md)
+	if err == nil && s.responseMetadata != nil {
+		s.responseMetadata.recordHeader(md)
+	}
+	return err
+}
+
+func (s *serverStream) SendHeader(md metadata.MD) error {
+	err := s.ServerStream.SendHeader(md)
+	if err == nil && s.responseMetadata != nil {
+		s.responseMetadata.recordHeader(md)
+	}
+	return err
+}
+
+func (s *serverStream) SetTrailer(md metadata.MD) {
+	s.ServerStream.SetTrailer(md)
+	if s.responseMetadata != nil {
+		s.responseMetadata.recordTrailer(md)
+	}
+}
+
+func (s *serverStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if errors.Is(err, io.EOF) {
+		s.halfCloseOnce.Do(func() {
+			if s.requests != nil {
+				s.span.AddEvent("rpc.request.half_close", time.Now(), map[string]interface{}{
+					"rpc.request.message_count": s.requests.count(),
+				})
+			}
+		})
+		// the client did not send any message
+		if filterErr := s.evaluateFilter(nil); filterErr != nil {
+			return filterErr
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	s.requests.record(m)
+	return s.evaluateFilter(m)
+}
+
+func (s *serverStream) SendMsg(m interface{}) error {
+	// the handler might respond before reading any message
+	if err := s.evaluateFilter(nil); err != nil {
+		return err
+	}
+
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.responses.record(m)
+	}
+	return err
+}
+
+// evaluateFilter runs the filter once and returns the blocking error, if any, on every call.
+func (s *serverStream) evaluateFilter(firstMessage interface{}) error {
+	s.filterOnce.Do(func() {
+		ctx := s.Context()
+		filterResult := filter.EvaluateRequest(ctx, s.filter, s.span, newStreamFilterRequest(ctx, s.fullMethod, s.peer(), s.marshaler.requestBodyReader(ctx, s.fullMethod, firstMessage)))
+		if filterResult.Block {
+			s.filterErr = blockedError(filterResult)
+		} else if filterResult.Decorations != nil {
+			if md, ok := metadata.FromIncomingContext(ctx); ok {
+				s.ctxMux.Lock()
+				s.ctx = metadata.NewIncomingContext(ctx, applyDecorations(md, filterResult.Decorations, s.span))
+				s.ctxMux.Unlock()
+			}
+		}
+	})
+	return s.filterErr
+}
+
+func (s *serverStream) peer() string {
+	if p, ok := peer.FromContext(s.Context()); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return ""
+}
+
+// WrapStreamClientInterceptor returns an interceptor that records the metadata, the message
+// counts and the first messages of each direction of the stream. The filter runs on the
+// outgoing metadata before the stream is opened so header decorations are sent with it.
+func WrapStreamClientInterceptor(
+	delegateInterceptor grpc.StreamClientInterceptor,
+	spanFromContext sdk.SpanFromContext,
+	options *Options,
+	spanAttributes map[string]string,
+	mh sdk.RpcOperationMetricsHandler,
+) grpc.StreamClientInterceptor {
+	defaultAttributes := newDefaultAttributes(spanAttributes)
+	dataCaptureConfig := internalconfig.GetConfig().GetDataCapture()
+	f, maxMessages := streamOptions(options)
+	marshaler := newMessageMarshaler(options)
+
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		wrappedStreamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			span := spanFromContext(ctx)
+			if span == nil || span.IsNoop() {
+				return streamer(ctx, desc, cc, method, opts...)
+			}
+
+			excluded := options != nil && isExcludedClientRPC(options.Exclusions, method)
+			if !excluded {
+				for key, value := range defaultAttributes {
+					span.SetAttribute(key, value)
+				}
+				setMethodAttributes(method, span)
+
+				if dataCaptureConfig.RpcMetadata.Request.Value {
+					setAttributesFromRequestOutgoingMetadata(ctx, span)
+				}
+			}
+
+			// the filter runs before the stream is opened so the metadata decorations
+			// are sent, hence without the request messages.
+			md, _ := metadata.FromOutgoingContext(ctx)
+			filterResult := filter.EvaluateRequest(ctx, f, span, filter.NewRequest(method, method, cc.Target(), NewMetadataAccessor(md), nil))
+			if filterResult.Block {
+				return nil, blockedError(filterResult)
+			} else if filterResult.Decorations != nil {
+				ctx = metadata.NewOutgoingContext(ctx, applyDecorations(md, filterResult.Decorations, span))
+			}
+
+			if excluded {
+				return streamer(ctx, desc, cc, method, opts...)
+			}
+
+			cs, err := streamer(ctx, desc, cc, method, opts...)
+			if err != nil {
+				return cs, err
+			}
+
+			return &clientStream{
+				ClientStream:    cs,
+				span:            span,
+				captureMetadata: dataCaptureConfig.RpcMetadata.Response.Value,
+				bodyMaxSize:     int(dataCaptureConfig.BodyMaxSizeBytes.Value),
+				requests:        newMessageRecorder(ctx, method, "request", span, marshaler, dataCaptureConfig, dataCaptureConfig.RpcBody.Request.Value, maxMessages),
+				responses:       newMessageRecorder(ctx, method, "response", span, marshaler, dataCaptureConfig, dataCaptureConfig.RpcBody.Response.Value, maxMessages),
+				serverStreams:   desc.ServerStreams,
+			}, nil
+		}
+
+		metrics := newRPCMetrics(mh, method, true)
+		cs, err := delegateInterceptor(ctx, desc, cc, method, wrappedStreamer, opts...)
+		if err != nil {
+			metrics.record(ctx, err)
+			return cs, err
+		}
+
+		if metrics == nil {
+			return cs, nil
+		}
+		return &meteredClientStream{ClientStream: cs, metrics: metrics, serverStreams: desc.ServerStreams}, nil
+	}
+}
+
+// clientStream records the messages going through the stream.
+type clientStream struct {
+	grpc.ClientStream
+	span            sdk.Span
+	captureMetadata bool
+	bodyMaxSize     int
+	requests        *messageRecorder
+	responses       *messageRecorder
+	serverStreams   bool
+
+	finishOnce sync.Once
+}
+
+func (s *clientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		s.requests.record(m)
+	}
+	return err
+}
+
+func (s *clientStream) CloseSend() error {
+	err := s.ClientStream.CloseSend()
+	s.span.AddEvent("rpc.request.half_close", time.Now(), map[string]interface{}{
+		"rpc.request.message_count": s.requests.count(),
+	})
+	return err
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == nil {
+		s.responses.record(m)
+	}
+
+	if err != nil && !errors.Is(err, io.EOF) {
+		setErrorAttributes(err, s.span, s.bodyMaxSize)
+	}
+
+	if err != nil || !s.serverStreams {
+		// the stream is done, header and trailer are available without blocking
+		s.finish()
+	}
+	return err
+}
+
+// finish records the response metadata.
+func (s *clientStream) finish() {
+	s.finishOnce.Do(func() {
+		if s.captureMetadata {
+			if header, err := s.ClientStream.Header(); err == nil {
+				setAttributesFromMetadata("response", header, s.span)
+			}
+			setAttributesFromMetadata("response", s.ClientStream.Trailer(), s.span)
+		}
+	})
+}
+
+// messageRecorder keeps count of the messages sent in one direction of the stream and
+// records the first ones as span events. The first message is also recorded as the
+// body attribute so it is available for filters like in unary RPCs.
+type messageRecorder struct {
+	ctx         context.Context
+	fullMethod  string
+	_type       string
+	span        sdk.Span
+	marshaler   *messageMarshaler
+	captureBody bool
+	bodyMaxSize int
+	maxMessages int
+	messages    int64
+}
+
+func newMessageRecorder(
+	ctx context.Context,
+	fullMethod string,
+	_type string,
+	span sdk.Span,
+	marshaler *messageMarshaler,
+	dataCaptureConfig *config.DataCapture,
+	captureBody bool,
+	maxMessages int,
+) *messageRecorder {
+	return &messageRecorder{
+		ctx:         ctx,
+		fullMethod:  fullMethod,
+		_type:       _type,
+		span:        span,
+		marshaler:   marshaler,
+		captureBody: captureBody,
+		bodyMaxSize: int(dataCaptureConfig.BodyMaxSizeBytes.Value),
+		maxMessages: maxMessages,
+	}
+}
+
+func (r *messageRecorder) count() int64 {
+	return atomic.LoadInt64(&r.messages)
+}
+
+func (r *messageRecorder) record(m interface{}) {
+	if r == nil {
+		return
+	}
+
+	id := atomic.AddInt64(&r.messages, 1)
+	r.span.SetAttribute(fmt.Sprintf("rpc.%s.message_count", r._type), id)
+
+	if !r.captureBody || id > int64(r.maxMessages) {
+		return
+	}
+
+	body, err := r.marshaler.marshal(r.ctx, r.fullMethod, r._type, m)
+	if len(body) == 0 || err != nil {
+		return
+	}
+
+	if id == 1 {
+		setTruncatedBodyAttribute(r._type, body, r.bodyMaxSize, r.span)
+	}
+
+	body, truncated := bodyattribute.TruncateBody(body, r.bodyMaxSize)
+	r.span.AddEvent(fmt.Sprintf("rpc.%s.message", r._type), time.Now(), map[string]interface{}{
+		"message.id":             id,
+		"message.body":           string(body),
+		"message.body.truncated": truncated,
+	})
+}
+
+// newStreamFilterRequest builds the request view passed to filters implementing
+// filter.ContextFilter, the body is empty when the stream has no request message.
+func newStreamFilterRequest(ctx context.Context, fullMethod, peerAddress string, bodyReader func() ([]byte, error)) *filter.Request {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return filter.NewRequest(fullMethod, fullMethod, peerAddress, NewMetadataAccessor(md), bodyReader)
+}
+
+func streamOptions(options *Options) (filter.Filter, int) {
+	var f filter.Filter = &filter.NoopFilter{}
+	maxMessages := defaultMaxStreamMessages
+	if options != nil {
+		if options.Filter != nil {
+			f = options.Filter
+		}
+		if options.MaxStreamMessages != 0 {
+			maxMessages = options.MaxStreamMessages
+		}
+	}
+	return f, maxMessages
+}
+
+func newDefaultAttributes(spanAttributes map[string]string) map[string]string {
+	defaultAttributes := map[string]string{
+		"rpc.system": "grpc",
+	}
+	for k, v := range spanAttributes {
+		defaultAttributes[k] = v
+	}
+	if containerID, err := container.GetID(); err == nil {
+		defaultAttributes["container_id"] = containerID
+	}
+	return defaultAttributes
+}
+
+func setMethodAttributes(fullMethod string, span sdk.Span) {
+	pieces := strings.Split(fullMethod[1:], "/")
+	span.SetAttribute("rpc.service", pieces[0])
+	span.SetAttribute("rpc.method", pieces[1])
+}
@@ -0,0 +1,331 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/filter/result"
+	"github.com/hypertrace/goagent/sdk/instrumentation/google.golang.org/grpc/internal/helloworld"
+	internalconfig "github.com/hypertrace/goagent/sdk/internal/config"
+	"github.com/hypertrace/goagent/sdk/internal/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// chatServiceDesc describes a bidirectional streaming service registered by hand as
+// the helloworld proto only defines unary RPCs.
+var chatServiceDesc = grpc.ServiceDesc{
+	ServiceName: "helloworld.Chat",
+	HandlerType: (*interface{})(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Chat",
+			Handler:       chatHandler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+}
+
+var chatStreamDesc = &chatServiceDesc.Streams[0]
+
+func chatHandler(_ interface{}, stream grpc.ServerStream) error {
+	if err := stream.SendHeader(metadata.Pairs("chat_header", "chat_header_value")); err != nil {
+		return err
+	}
+	stream.SetTrailer(metadata.Pairs("chat_trailer", "chat_trailer_value"))
+
+	for {
+		req := &helloworld.HelloRequest{}
+		err := stream.RecvMsg(req)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := stream.SendMsg(&helloworld.HelloReply{Message: "Hello " + req.GetName()}); err != nil {
+			return err
+		}
+	}
+}
+
+type spanServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *spanServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func makeMockStreamServerInterceptor(mockSpans *[]*mock.Span) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		span := mock.NewSpan()
+		*mockSpans = append(*mockSpans, span)
+		return handler(srv, &spanServerStream{ss, mock.ContextWithSpan(ss.Context(), span)})
+	}
+}
+
+func makeMockStreamClientInterceptor(mockSpans *[]*mock.Span) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		span := mock.NewSpan()
+		*mockSpans = append(*mockSpans, span)
+		return streamer(mock.ContextWithSpan(ctx, span), desc, cc, method, opts...)
+	}
+}
+
+func dialChat(t *testing.T, serverOpts []grpc.ServerOption, dialOpts ...grpc.DialOption) *grpc.ClientConn {
+	s := grpc.NewServer(serverOpts...)
+	t.Cleanup(s.Stop)
+	s.RegisterService(&chatServiceDesc, struct{}{})
+
+	dialer := createDialer(s)
+	conn, err := grpc.DialContext(
+		context.Background(),
+		"bufnet",
+		append([]grpc.DialOption{
+			grpc.WithContextDialer(dialer),
+			grpc.WithBlock(),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		}, dialOpts...)...,
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// chat sends a message per name, reads the replies and returns the error of the first
+// failing operation.
+func chat(ctx context.Context, conn *grpc.ClientConn, names ...string) ([]string, error) {
+	stream, err := conn.NewStream(ctx, chatStreamDesc, "/helloworld.Chat/Chat")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		if err := stream.SendMsg(&helloworld.HelloRequest{Name: name}); err != nil {
+			return nil, err
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+
+	var replies []string
+	for {
+		reply := &helloworld.HelloReply{}
+		err := stream.RecvMsg(reply)
+		if errors.Is(err, io.EOF) {
+			return replies, nil
+		}
+		if err != nil {
+			return replies, err
+		}
+		replies = append(replies, reply.GetMessage())
+	}
+}
+
+func TestStreamServerInterceptorRecordsMessages(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	spans := []*mock.Span{}
+	conn := dialChat(t, []grpc.ServerOption{
+		grpc.StreamInterceptor(WrapStreamServerInterceptor(
+			makeMockStreamServerInterceptor(&spans),
+			mock.SpanFromContext,
+			&Options{MaxStreamMessages: 2},
+			map[string]string{"foo": "bar"},
+			nil,
+		)),
+	})
+
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("test_key", "test_value"))
+	replies, err := chat(ctx, conn, "Pupo", "Cuco", "Tito")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Hello Pupo", "Hello Cuco", "Hello Tito"}, replies)
+
+	require.Equal(t, 1, len(spans))
+	span := spans[0]
+
+	assert.Equal(t, "grpc", span.ReadAttribute("rpc.system"))
+	assert.Equal(t, "helloworld.Chat", span.ReadAttribute("rpc.service"))
+	assert.Equal(t, "Chat", span.ReadAttribute("rpc.method"))
+	assert.Equal(t, "bar", span.ReadAttribute("foo"))
+	assert.Equal(t, "test_value", span.ReadAttribute("rpc.request.metadata.test_key"))
+	assert.Equal(t, int64(3), span.ReadAttribute("rpc.request.message_count"))
+	assert.Equal(t, int64(3), span.ReadAttribute("rpc.response.message_count"))
+	assert.Equal(t, `{"name":"Pupo"}`, strings.ReplaceAll(span.ReadAttribute("rpc.request.body").(string), " ", ""))
+	assert.Equal(t, `{"message":"HelloPupo"}`, strings.ReplaceAll(span.ReadAttribute("rpc.response.body").(string), " ", ""))
+
+	requests := span.ReadEvents("rpc.request.message")
+	require.Len(t, requests, 2)
+	assert.Equal(t, int64(2), requests[1]["message.id"])
+	assert.Equal(t, `{"name":"Cuco"}`, strings.ReplaceAll(requests[1]["message.body"].(string), " ", ""))
+	assert.Len(t, span.ReadEvents("rpc.response.message"), 2)
+
+	halfClose, ok := span.ReadEvent("rpc.request.half_close")
+	require.True(t, ok)
+	assert.Equal(t, int64(3), halfClose["rpc.request.message_count"])
+}
+
+func TestStreamServerInterceptorFilter(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	var evaluations int
+	spans := []*mock.Span{}
+	conn := dialChat(t, []grpc.ServerOption{
+		grpc.StreamInterceptor(WrapStreamServerInterceptor(
+			makeMockStreamServerInterceptor(&spans),
+			mock.SpanFromContext,
+			&Options{Filter: mock.Filter{
+				Evaluator: func(span sdk.Span) result.FilterResult {
+					evaluations++
+					body, _ := span.GetAttributes().GetValue("rpc.request.body").(string)
+					if strings.Contains(body, "Bad") {
+						return result.FilterResult{Block: true, ResponseStatusCode: 403}
+					}
+					return result.FilterResult{}
+				},
+			}},
+			nil,
+			nil,
+		)),
+	})
+
+	replies, err := chat(context.Background(), conn, "Bad Pupo", "Cuco")
+	assert.Empty(t, replies)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	replies, err = chat(context.Background(), conn, "Pupo", "Bad Cuco")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Hello Pupo", "Hello Bad Cuco"}, replies)
+
+	// the filter runs once per stream
+	assert.Equal(t, 2, evaluations)
+}
+
+func TestStreamClientInterceptorRecordsMessages(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	spans := []*mock.Span{}
+	conn := dialChat(t, nil, grpc.WithStreamInterceptor(WrapStreamClientInterceptor(
+		makeMockStreamClientInterceptor(&spans),
+		mock.SpanFromContext,
+		&Options{},
+		map[string]string{"foo": "bar"},
+		nil,
+	)))
+
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("test_key", "test_value"))
+	replies, err := chat(ctx, conn, "Pupo", "Cuco")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Hello Pupo", "Hello Cuco"}, replies)
+
+	require.Equal(t, 1, len(spans))
+	span := spans[0]
+
+	assert.Equal(t, "grpc", span.ReadAttribute("rpc.system"))
+	assert.Equal(t, "helloworld.Chat", span.ReadAttribute("rpc.service"))
+	assert.Equal(t, "Chat", span.ReadAttribute("rpc.method"))
+	assert.Equal(t, "bar", span.ReadAttribute("foo"))
+	assert.Equal(t, "test_value", span.ReadAttribute("rpc.request.metadata.test_key"))
+	assert.Equal(t, "chat_header_value", span.ReadAttribute("rpc.response.metadata.chat_header"))
+	assert.Equal(t, "chat_trailer_value", span.ReadAttribute("rpc.response.metadata.chat_trailer"))
+	assert.Equal(t, int64(2), span.ReadAttribute("rpc.request.message_count"))
+	assert.Equal(t, int64(2), span.ReadAttribute("rpc.response.message_count"))
+	assert.Len(t, span.ReadEvents("rpc.request.message"), 2)
+	assert.Len(t, span.ReadEvents("rpc.response.message"), 2)
+
+	halfClose, ok := span.ReadEvent("rpc.request.half_close")
+	require.True(t, ok)
+	assert.Equal(t, int64(2), halfClose["rpc.request.message_count"])
+}
+
+func TestStreamClientInterceptorFilter(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	spans := []*mock.Span{}
+	conn := dialChat(t, nil, grpc.WithStreamInterceptor(WrapStreamClientInterceptor(
+		makeMockStreamClientInterceptor(&spans),
+		mock.SpanFromContext,
+		&Options{Filter: mock.Filter{
+			Evaluator: func(span sdk.Span) result.FilterResult {
+				return result.FilterResult{Block: true, ResponseStatusCode: 429, ResponseMessage: "slow down"}
+			},
+		}},
+		nil,
+		nil,
+	)))
+
+	_, err := chat(context.Background(), conn, "Pupo")
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, "slow down", status.Convert(err).Message())
+	assert.Nil(t, spans[0].ReadAttribute("rpc.request.message_count"))
+}
+
+func TestStreamClientInterceptorFilterDecorationsAreSent(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	var received metadata.MD
+	captureMetadata := func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		received, _ = metadata.FromIncomingContext(ss.Context())
+		return handler(srv, ss)
+	}
+
+	spans := []*mock.Span{}
+	conn := dialChat(t, []grpc.ServerOption{grpc.StreamInterceptor(captureMetadata)}, grpc.WithStreamInterceptor(WrapStreamClientInterceptor(
+		makeMockStreamClientInterceptor(&spans),
+		mock.SpanFromContext,
+		&Options{Filter: mock.Filter{
+			Evaluator: func(span sdk.Span) result.FilterResult {
+				return result.FilterResult{Decorations: &result.Decorations{
+					RequestHeaderInjections: []result.KeyValueString{{Key: "x-injected", Value: "yes"}},
+				}}
+			},
+		}},
+		nil,
+		nil,
+	)))
+
+	replies, err := chat(context.Background(), conn, "Pupo")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Hello Pupo"}, replies)
+	assert.Equal(t, []string{"yes"}, received.Get("x-injected"))
+}
+
+func TestStreamServerInterceptorRecoversPanics(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	spans := []*mock.Span{}
+	interceptor := WrapStreamServerInterceptor(
+		makeMockStreamServerInterceptor(&spans),
+		mock.SpanFromContext,
+		&Options{PanicRecovery: sdk.PanicRecoveryRespond},
+		map[string]string{},
+		nil,
+	)
+
+	err := interceptor(nil, &spanServerStream{ctx: context.Background()}, &grpc.StreamServerInfo{FullMethod: "/helloworld.Chat/Chat"},
+		func(interface{}, grpc.ServerStream) error {
+			panic(errors.New("boom"))
+		})
+	assert.Equal(t, codes.Internal, status.Code(err))
+
+	require.Equal(t, 1, len(spans))
+	event, ok := spans[0].ReadEvent("exception")
+	require.True(t, ok)
+	assert.Equal(t, "*errors.errorString", event["exception.type"])
+	assert.Equal(t, "boom", event["exception.message"])
+	assert.Equal(t, sdk.StatusCodeError, spans[0].Status.Code)
+}
@@ -0,0 +1,22 @@
+package http // import "github.com/hypertrace/goagent/sdk/instrumentation/net/http"
+
+import (
+	"net/http"
+
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/filter/result"
+)
+
+// applyDecorations removes and injects the request headers as decided by the filters
+// and records the injected headers in the span.
+func applyDecorations(header http.Header, decorations *result.Decorations, span sdk.Span) {
+	for _, key := range decorations.RequestHeaderRemovals {
+		header.Del(key)
+	}
+
+	headersAccessor := NewHeaderMapAccessor(header)
+	for _, h := range decorations.RequestHeaderInjections {
+		headersAccessor.AddHeader(h.Key, h.Value)
+		span.SetAttribute("http.request.header."+h.Key, h.Value)
+	}
+}
@@ -1,13 +1,17 @@
 package http // import "github.com/hypertrace/goagent/sdk/instrumentation/net/http"
 
 import (
+	"bufio"
 	"bytes"
 	"io"
+	"net"
 	"net/http"
 	"strings"
+	"time"
 
 	config "github.com/hypertrace/agent-config/gen/go/v1"
 	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/exclusion"
 	"github.com/hypertrace/goagent/sdk/filter"
 	internalconfig "github.com/hypertrace/goagent/sdk/internal/config"
 	"github.com/hypertrace/goagent/sdk/internal/container"
@@ -20,11 +24,23 @@ type handler struct {
 	dataCaptureConfig        *config.DataCapture
 	filter                   filter.Filter
 	mh                       sdk.HttpOperationMetricsHandler
+	routeTemplateGetter      func(*http.Request) string
+	exclusions               exclusion.Rules
+	panicRecovery            sdk.PanicRecovery
 }
 
-// Options for HTTP handler instrumentation
+// Options for HTTP handler and transport instrumentation
 type Options struct {
 	Filter filter.Filter
+	// RouteTemplateGetter returns the route template (e.g. /users/{id}) of the request,
+	// it is used to populate the request passed to filters implementing filter.ContextFilter.
+	RouteTemplateGetter func(*http.Request) string
+	// Exclusions are the rules of the requests whose data is not captured. Skipping the
+	// span creation is up to the instrumentation creating the spans.
+	Exclusions exclusion.Rules
+	// PanicRecovery tells whether the panics of the handler are recorded on the span
+	// and whether they are turned into a 500 response, disabled by default.
+	PanicRecovery sdk.PanicRecovery
 }
 
 // WrapHandler wraps an uninstrumented handler (e.g. a handleFunc) and returns a new one
@@ -42,17 +58,100 @@ func WrapHandler(delegate http.Handler, spanFromContext sdk.SpanFromContext, opt
 	if options != nil && options.Filter != nil {
 		f = options.Filter
 	}
+	var routeTemplateGetter func(*http.Request) string
+	var exclusions exclusion.Rules
+	panicRecovery := sdk.PanicRecoveryDisabled
+	if options != nil {
+		routeTemplateGetter = options.RouteTemplateGetter
+		exclusions = options.Exclusions
+		panicRecovery = options.PanicRecovery
+	}
 
-	return &handler{delegate, defaultAttributes, spanFromContext, internalconfig.GetConfig().GetDataCapture(), f, mh}
+	return &handler{delegate, defaultAttributes, spanFromContext, internalconfig.GetConfig().GetDataCapture(), f, mh, routeTemplateGetter, exclusions, panicRecovery}
 }
 
 func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mh.AddToRequestCount(1, r)
+
+	smh, ok := h.mh.(sdk.HttpServerMetricsHandler)
+	if !ok {
+		h.serveHTTPWithRecovery(w, r)
+		return
+	}
+
+	smh.AddToActiveRequests(1, r)
+	defer smh.AddToActiveRequests(-1, r)
+
+	start := time.Now()
+	mw := &meteredResponseWriter{ResponseWriter: w}
+	var body *meteredBody
+	if r.Body != nil && r.Body != http.NoBody {
+		body = &meteredBody{ReadCloser: r.Body}
+		r.Body = body
+	}
+
+	returned := false
+	defer func() {
+		op := sdk.HttpOperation{
+			StatusCode:   mw.status(),
+			Duration:     time.Since(start),
+			ResponseSize: mw.size,
+		}
+		if !returned {
+			// the handler panicked, the server responds with a 500 or aborts the response
+			op.StatusCode = http.StatusInternalServerError
+		}
+		if body != nil {
+			op.RequestSize = body.size
+		}
+		smh.RecordHttpOperation(r, op)
+	}()
+
+	h.serveHTTPWithRecovery(mw.wrap(), r)
+	returned = true
+}
+
+// serveHTTPWithRecovery records the panics of the handler on the span when enabled,
+// either panicking again or responding with a 500, the response being aborted when
+// the handler already wrote its header.
+func (h *handler) serveHTTPWithRecovery(w http.ResponseWriter, r *http.Request) {
+	if h.panicRecovery == sdk.PanicRecoveryDisabled {
+		h.serveHTTP(w, r)
+		return
+	}
+
+	tw := &headerTrackingWriter{ResponseWriter: w}
+	defer func() {
+		recovered := recover()
+		if recovered == nil {
+			return
+		}
+
+		// http.ErrAbortHandler is the way to abort a response on purpose
+		if recovered == http.ErrAbortHandler { // nolint:errorlint
+			panic(recovered)
+		}
+
+		respond := h.panicRecovery == sdk.PanicRecoveryRespond
+		sdk.RecordPanic(h.spanFromContextRetriever(r.Context()), recovered, !respond)
+		if !respond {
+			panic(recovered)
+		}
+		if tw.headerWritten {
+			// the response can't be turned into an error anymore
+			panic(http.ErrAbortHandler)
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}()
+
+	h.serveHTTP(tw.wrap(), r)
+}
+
+func (h *handler) serveHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	span := h.spanFromContextRetriever(ctx)
 	headersAccessor := NewHeaderMapAccessor(r.Header)
 
-	h.mh.AddToRequestCount(1, r)
-
 	if span.IsNoop() {
 		// isNoop means either the span is not sampled or there was no span
 		// in the request context which means this Handler is not used
@@ -62,6 +161,57 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// the filter is evaluated for the excluded requests as well, only the data capture
+	// is skipped
+	excluded := h.isExcluded(r)
+
+	var capturedBody []byte
+	if !excluded {
+		body, err := h.captureRequest(r, span, headersAccessor)
+		if err != nil {
+			return
+		}
+		capturedBody = body
+	}
+
+	// single evaluation call to filter after capturing the configured parameters
+	filterResult := filter.EvaluateRequest(ctx, h.filter, span, h.filterRequest(r, headersAccessor, capturedBody))
+	if filterResult.Block {
+		w.WriteHeader(int(filterResult.ResponseStatusCode))
+		return
+	} else if filterResult.Decorations != nil {
+		applyDecorations(r.Header, filterResult.Decorations, span)
+	}
+
+	if excluded {
+		h.delegate.ServeHTTP(w, r)
+		return
+	}
+
+	// create http.ResponseWriter interceptor for tracking status code
+	wi := &rwInterceptor{w: w, statusCode: 200}
+
+	// tag found status code on exit
+	defer func() {
+		responseHeadersAccessor := NewHeaderMapAccessor(wi.Header())
+		if h.dataCaptureConfig.HttpBody.Response.Value &&
+			len(wi.body) > 0 &&
+			ShouldRecordBodyOfContentType(responseHeadersAccessor) {
+			setTruncatedBodyAttribute("response", wi.body, int(h.dataCaptureConfig.BodyMaxSizeBytes.Value), span,
+				HasMultiPartFormDataContentTypeHeader(responseHeadersAccessor))
+		}
+
+		if h.dataCaptureConfig.HttpHeaders.Response.Value {
+			// Sets an attribute per each response header.
+			SetAttributesFromHeaders("response", responseHeadersAccessor, span)
+		}
+	}()
+
+	h.delegate.ServeHTTP(wi.wrap(), r)
+}
+
+// captureRequest records the request data in the span and returns the captured body, if any.
+func (h *handler) captureRequest(r *http.Request, span sdk.Span, headersAccessor HeaderAccessor) ([]byte, error) {
 	for key, value := range h.defaultAttributes {
 		span.SetAttribute(key, value)
 	}
@@ -81,12 +231,14 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		SetAttributesFromHeaders("request", headersAccessor, span)
 	}
 
+	var capturedBody []byte
+
 	// nil check for body is important as this block turns the body into another
 	// object that isn't nil and that will leverage the "Observer effect".
 	if r.Body != nil && h.dataCaptureConfig.HttpBody.Request.Value && ShouldRecordBodyOfContentType(headersAccessor) {
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
-			return
+			return nil, err
 		}
 		defer r.Body.Close()
 
@@ -100,40 +252,62 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 
 		r.Body = io.NopCloser(bytes.NewBuffer(body))
+		capturedBody = body
 	}
 
-	// single evaluation call to filter after capturing the configured parameters
-	filterResult := h.filter.Evaluate(span)
-	if filterResult.Block {
-		w.WriteHeader(int(filterResult.ResponseStatusCode))
-		return
-	} else if filterResult.Decorations != nil {
-		for _, header := range filterResult.Decorations.RequestHeaderInjections {
-			headersAccessor.AddHeader(header.Key, header.Value)
-			span.SetAttribute("http.request.header."+header.Key, header.Value)
-		}
+	return capturedBody, nil
+
+}
+
+// isExcluded tells whether the request matches an exclusion rule, in which case the
+// data is not captured.
+func (h *handler) isExcluded(r *http.Request) bool {
+	if len(h.exclusions) == 0 {
+		return false
 	}
 
-	// create http.ResponseWriter interceptor for tracking status code
-	wi := &rwInterceptor{w: w, statusCode: 200}
+	route := ""
+	if h.routeTemplateGetter != nil {
+		route = h.routeTemplateGetter(r)
+	}
+	_, excluded := h.exclusions.Match(exclusion.HTTPRequest(r, route))
+	return excluded
+}
 
-	// tag found status code on exit
-	defer func() {
-		responseHeadersAccessor := NewHeaderMapAccessor(wi.Header())
-		if h.dataCaptureConfig.HttpBody.Response.Value &&
-			len(wi.body) > 0 &&
-			ShouldRecordBodyOfContentType(responseHeadersAccessor) {
-			setTruncatedBodyAttribute("response", wi.body, int(h.dataCaptureConfig.BodyMaxSizeBytes.Value), span,
-				HasMultiPartFormDataContentTypeHeader(responseHeadersAccessor))
-		}
+// filterRequest builds the request view passed to filters implementing filter.ContextFilter.
+// The body is only read when a filter asks for it.
+func (h *handler) filterRequest(r *http.Request, headersAccessor HeaderAccessor, capturedBody []byte) *filter.Request {
+	route := ""
+	if h.routeTemplateGetter != nil {
+		route = h.routeTemplateGetter(r)
+	}
 
-		if h.dataCaptureConfig.HttpHeaders.Response.Value {
-			// Sets an attribute per each response header.
-			SetAttributesFromHeaders("response", responseHeadersAccessor, span)
+	return filter.NewRequest(r.Method, route, r.RemoteAddr, headersAccessor, func() ([]byte, error) {
+		if capturedBody != nil {
+			return capturedBody, nil
 		}
-	}()
+		return peekBody(r, int(h.dataCaptureConfig.GetBodyMaxProcessingSizeBytes().GetValue()))
+	})
+}
+
+// peekBody reads up to maxSize bytes from the request body (all of it if maxSize <= 0)
+// and restores the body so the delegate handler can still consume it entirely.
+func peekBody(r *http.Request, maxSize int) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+
+	var reader io.Reader = r.Body
+	if maxSize > 0 {
+		reader = io.LimitReader(r.Body, int64(maxSize))
+	}
 
-	h.delegate.ServeHTTP(wi, r)
+	body, err := io.ReadAll(reader)
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	return body, err
 }
 
 // Copied from Zipkin Go
@@ -165,227 +339,310 @@ func (r *rwInterceptor) getStatusCode() int {
 	return r.statusCode
 }
 
+// Unwrap gives access to the underlying writer to http.ResponseController.
+func (r *rwInterceptor) Unwrap() http.ResponseWriter {
+	return r.w
+}
+
+// wrap returns the interceptor exposing the optional interfaces of the underlying
+// writer but io.ReaderFrom, which would bypass the body capture.
 func (r *rwInterceptor) wrap() http.ResponseWriter {
+	hj, _ := r.w.(http.Hijacker)
+	cn, _ := r.w.(http.CloseNotifier)
+	pu, _ := r.w.(http.Pusher)
+	fl, _ := r.w.(http.Flusher)
+	return wrapResponseWriter(r, hj, cn, pu, fl, nil)
+}
+
+// headerTrackingWriter tracks whether the response header was written, explicitly or
+// by writing the body, flushing or hijacking the connection.
+type headerTrackingWriter struct {
+	http.ResponseWriter
+	headerWritten bool
+}
+
+func (w *headerTrackingWriter) WriteHeader(statusCode int) {
+	w.headerWritten = true
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *headerTrackingWriter) Write(b []byte) (int, error) {
+	w.headerWritten = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *headerTrackingWriter) ReadFrom(src io.Reader) (int64, error) {
+	w.headerWritten = true
+	return w.ResponseWriter.(io.ReaderFrom).ReadFrom(src)
+}
+
+func (w *headerTrackingWriter) Flush() {
+	w.headerWritten = true
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (w *headerTrackingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.headerWritten = true
+	return w.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+// Unwrap gives access to the underlying writer to http.ResponseController.
+func (w *headerTrackingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// wrap returns the writer exposing the optional interfaces of the underlying one.
+func (w *headerTrackingWriter) wrap() http.ResponseWriter {
+	cn, _ := w.ResponseWriter.(http.CloseNotifier)
+	pu, _ := w.ResponseWriter.(http.Pusher)
+
+	var (
+		hj http.Hijacker
+		fl http.Flusher
+		rf io.ReaderFrom
+	)
+	if _, ok := w.ResponseWriter.(http.Hijacker); ok {
+		hj = w
+	}
+	if _, ok := w.ResponseWriter.(http.Flusher); ok {
+		fl = w
+	}
+	if _, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		rf = w
+	}
+	return wrapResponseWriter(w, hj, cn, pu, fl, rf)
+}
+
+// unwrappableResponseWriter is a writer wrapping another one.
+type unwrappableResponseWriter interface {
+	http.ResponseWriter
+	Unwrap() http.ResponseWriter
+}
+
+// wrapResponseWriter returns w implementing the optional interfaces given as non nil,
+// so the handlers can still type assert them on a wrapped writer.
+func wrapResponseWriter(w unwrappableResponseWriter, hj http.Hijacker, cn http.CloseNotifier, pu http.Pusher,
+	fl http.Flusher, rf io.ReaderFrom) http.ResponseWriter {
 	var (
-		hj, i0 = r.w.(http.Hijacker)
-		cn, i1 = r.w.(http.CloseNotifier)
-		pu, i2 = r.w.(http.Pusher)
-		fl, i3 = r.w.(http.Flusher)
-		rf, i4 = r.w.(io.ReaderFrom)
+		i0 = hj != nil
+		i1 = cn != nil
+		i2 = pu != nil
+		i3 = fl != nil
+		i4 = rf != nil
 	)
 
 	switch {
 	case !i0 && !i1 && !i2 && !i3 && !i4:
 		return struct {
-			http.ResponseWriter
-		}{r}
+			unwrappableResponseWriter
+		}{w}
 	case !i0 && !i1 && !i2 && !i3 && i4:
 		return struct {
-			http.ResponseWriter
+			unwrappableResponseWriter
 			io.ReaderFrom
-		}{r, rf}
+		}{w, rf}
 	case !i0 && !i1 && !i2 && i3 && !i4:
 		return struct {
-			http.ResponseWriter
+			unwrappableResponseWriter
 			http.Flusher
-		}{r, fl}
+		}{w, fl}
 	case !i0 && !i1 && !i2 && i3 && i4:
 		return struct {
-			http.ResponseWriter
+			unwrappableResponseWriter
 			http.Flusher
 			io.ReaderFrom
-		}{r, fl, rf}
+		}{w, fl, rf}
 	case !i0 && !i1 && i2 && !i3 && !i4:
 		return struct {
-			http.ResponseWriter
+			unwrappableResponseWriter
 			http.Pusher
-		}{r, pu}
+		}{w, pu}
 	case !i0 && !i1 && i2 && !i3 && i4:
 		return struct {
-			http.ResponseWriter
+			unwrappableResponseWriter
 			http.Pusher
 			io.ReaderFrom
-		}{r, pu, rf}
+		}{w, pu, rf}
 	case !i0 && !i1 && i2 && i3 && !i4:
 		return struct {
-			http.ResponseWriter
+			unwrappableResponseWriter
 			http.Pusher
 			http.Flusher
-		}{r, pu, fl}
+		}{w, pu, fl}
 	case !i0 && !i1 && i2 && i3 && i4:
 		return struct {
-			http.ResponseWriter
+			unwrappableResponseWriter
 			http.Pusher
 			http.Flusher
 			io.ReaderFrom
-		}{r, pu, fl, rf}
+		}{w, pu, fl, rf}
 	case !i0 && i1 && !i2 && !i3 && !i4:
 		return struct {
-			http.ResponseWriter
+			unwrappableResponseWriter
 			http.CloseNotifier
-		}{r, cn}
+		}{w, cn}
 	case !i0 && i1 && !i2 && !i3 && i4:
 		return struct {
-			http.ResponseWriter
+			unwrappableResponseWriter
 			http.CloseNotifier
 			io.ReaderFrom
-		}{r, cn, rf}
+		}{w, cn, rf}
 	case !i0 && i1 && !i2 && i3 && !i4:
 		return struct {
-			http.ResponseWriter
+			unwrappableResponseWriter
 			http.CloseNotifier
 			http.Flusher
-		}{r, cn, fl}
+		}{w, cn, fl}
 	case !i0 && i1 && !i2 && i3 && i4:
 		return struct {
-			http.ResponseWriter
+			unwrappableResponseWriter
 			http.CloseNotifier
 			http.Flusher
 			io.ReaderFrom
-		}{r, cn, fl, rf}
+		}{w, cn, fl, rf}
 	case !i0 && i1 && i2 && !i3 && !i4:
 		return struct {
-			http.ResponseWriter
+			unwrappableResponseWriter
 			http.CloseNotifier
 			http.Pusher
-		}{r, cn, pu}
+		}{w, cn, pu}
 	case !i0 && i1 && i2 && !i3 && i4:
 		return struct {
-			http.ResponseWriter
+			unwrappableResponseWriter
 			http.CloseNotifier
 			http.Pusher
 			io.ReaderFrom
-		}{r, cn, pu, rf}
+		}{w, cn, pu, rf}
 	case !i0 && i1 && i2 && i3 && !i4:
 		return struct {
-			http.ResponseWriter
+			unwrappableResponseWriter
 			http.CloseNotifier
 			http.Pusher
 			http.Flusher
-		}{r, cn, pu, fl}
+		}{w, cn, pu, fl}
 	case !i0 && i1 && i2 && i3 && i4:
 		return struct {
-			http.ResponseWriter
+			unwrappableResponseWriter
 			http.CloseNotifier
 			http.Pusher
 			http.Flusher
 			io.ReaderFrom
-		}{r, cn, pu, fl, rf}
+		}{w, cn, pu, fl, rf}
 	case i0 && !i1 && !i2 && !i3 && !i4:
 		return struct {
-			http.ResponseWriter
+			unwrappableResponseWriter
 			http.Hijacker
-		}{r, hj}
+		}{w, hj}
 	case i0 && !i1 && !i2 && !i3 && i4:
 		return struct {
-			http.ResponseWriter
+			unwrappableResponseWriter
 			http.Hijacker
 			io.ReaderFrom
-		}{r, hj, rf}
+		}{w, hj, rf}
 	case i0 && !i1 && !i2 && i3 && !i4:
 		return struct {
-			http.ResponseWriter
+			unwrappableResponseWriter
 			http.Hijacker
 			http.Flusher
-		}{r, hj, fl}
+		}{w, hj, fl}
 	case i0 && !i1 && !i2 && i3 && i4:
 		return struct {
-			http.ResponseWriter
+			unwrappableResponseWriter
 			http.Hijacker
 			http.Flusher
 			io.ReaderFrom
-		}{r, hj, fl, rf}
+		}{w, hj, fl, rf}
 	case i0 && !i1 && i2 && !i3 && !i4:
 		return struct {
-			http.ResponseWriter
+			unwrappableResponseWriter
 			http.Hijacker
 			http.Pusher
-		}{r, hj, pu}
+		}{w, hj, pu}
 	case i0 && !i1 && i2 && !i3 && i4:
 		return struct {
-			http.ResponseWriter
+			unwrappableResponseWriter
 			http.Hijacker
 			http.Pusher
 			io.ReaderFrom
-		}{r, hj, pu, rf}
+		}{w, hj, pu, rf}
 	case i0 && !i1 && i2 && i3 && !i4:
 		return struct {
-			http.ResponseWriter
+			unwrappableResponseWriter
 			http.Hijacker
 			http.Pusher
 			http.Flusher
-		}{r, hj, pu, fl}
+		}{w, hj, pu, fl}
 	case i0 && !i1 && i2 && i3 && i4:
 		return struct {
-			http.ResponseWriter
+			unwrappableResponseWriter
 			http.Hijacker
 			http.Pusher
 			http.Flusher
 			io.ReaderFrom
-		}{r, hj, pu, fl, rf}
+		}{w, hj, pu, fl, rf}
 	case i0 && i1 && !i2 && !i3 && !i4:
 		return struct {
-			http.ResponseWriter
+			unwrappableResponseWriter
 			http.Hijacker
 			http.CloseNotifier
-		}{r, hj, cn}
+		}{w, hj, cn}
 	case i0 && i1 && !i2 && !i3 && i4:
 		return struct {
-			http.ResponseWriter
+			unwrappableResponseWriter
 			http.Hijacker
 			http.CloseNotifier
 			io.ReaderFrom
-		}{r, hj, cn, rf}
+		}{w, hj, cn, rf}
 	case i0 && i1 && !i2 && i3 && !i4:
 		return struct {
-			http.ResponseWriter
+			unwrappableResponseWriter
 			http.Hijacker
 			http.CloseNotifier
 			http.Flusher
-		}{r, hj, cn, fl}
+		}{w, hj, cn, fl}
 	case i0 && i1 && !i2 && i3 && i4:
 		return struct {
-			http.ResponseWriter
+			unwrappableResponseWriter
 			http.Hijacker
 			http.CloseNotifier
 			http.Flusher
 			io.ReaderFrom
-		}{r, hj, cn, fl, rf}
+		}{w, hj, cn, fl, rf}
 	case i0 && i1 && i2 && !i3 && !i4:
 		return struct {
-			http.ResponseWriter
+			unwrappableResponseWriter
 			http.Hijacker
 			http.CloseNotifier
 			http.Pusher
-		}{r, hj, cn, pu}
+		}{w, hj, cn, pu}
 	case i0 && i1 && i2 && !i3 && i4:
 		return struct {
-			http.ResponseWriter
+			unwrappableResponseWriter
 			http.Hijacker
 			http.CloseNotifier
 			http.Pusher
 			io.ReaderFrom
-		}{r, hj, cn, pu, rf}
+		}{w, hj, cn, pu, rf}
 	case i0 && i1 && i2 && i3 && !i4:
 		return struct {
-			http.ResponseWriter
+			unwrappableResponseWriter
 			http.Hijacker
 			http.CloseNotifier
 			http.Pusher
 			http.Flusher
-		}{r, hj, cn, pu, fl}
+		}{w, hj, cn, pu, fl}
 	case i0 && i1 && i2 && i3 && i4:
 		return struct {
-			http.ResponseWriter
+			unwrappableResponseWriter
 			http.Hijacker
 			http.CloseNotifier
 			http.Pusher
 			http.Flusher
 			io.ReaderFrom
-		}{r, hj, cn, pu, fl, rf}
+		}{w, hj, cn, pu, fl, rf}
 	default:
 		return struct {
-			http.ResponseWriter
-		}{r}
+			unwrappableResponseWriter
+		}{w}
 	}
 }
@@ -3,13 +3,17 @@ package http
 import (
 	"context"
 	"encoding/base64"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	config "github.com/hypertrace/agent-config/gen/go/v1"
 	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/exclusion"
+	"github.com/hypertrace/goagent/sdk/filter"
 	"github.com/hypertrace/goagent/sdk/filter/result"
 	internalconfig "github.com/hypertrace/goagent/sdk/internal/config"
 	"github.com/hypertrace/goagent/sdk/internal/mock"
@@ -625,3 +629,270 @@ func TestUrlAttribute(t *testing.T) {
 	assert.Nil(t, span.ReadAttribute("http.url"))
 
 }
+
+type contextFilter struct {
+	mock.Filter
+	evaluator func(ctx context.Context, span sdk.Span, req *filter.Request) result.FilterResult
+}
+
+func (f contextFilter) EvaluateWithContext(ctx context.Context, span sdk.Span, req *filter.Request) result.FilterResult {
+	return f.evaluator(ctx, span, req)
+}
+
+func TestContextFilterReceivesRequest(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	h := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		// the delegate still receives the full body
+		assert.Equal(t, `{"name":"Jacinto"}`, string(body))
+	})
+
+	wh, _ := WrapHandler(h, mock.SpanFromContext, &Options{
+		Filter: contextFilter{
+			Filter: mock.Filter{
+				Evaluator: func(span sdk.Span) result.FilterResult {
+					assert.Fail(t, "should not be called")
+					return result.FilterResult{}
+				},
+			},
+			evaluator: func(ctx context.Context, span sdk.Span, req *filter.Request) result.FilterResult {
+				assert.NotNil(t, ctx)
+				assert.Equal(t, "POST", req.Method)
+				assert.Equal(t, "/foo/{id}", req.Route)
+				assert.Equal(t, []string{"abc"}, req.Headers.Lookup("api_key"))
+
+				// body is not captured but it is still accessible to the filter
+				assert.Nil(t, span.GetAttributes().GetValue("http.request.body"))
+				body, err := req.Body()
+				assert.NoError(t, err)
+				assert.Equal(t, `{"name"`, string(body))
+				return result.FilterResult{}
+			},
+		},
+		RouteTemplateGetter: func(*http.Request) string { return "/foo/{id}" },
+	}, map[string]string{}, &metricsHandler{}).(*handler)
+	wh.dataCaptureConfig = &config.DataCapture{
+		HttpHeaders:                &config.Message{Request: config.Bool(false), Response: config.Bool(false)},
+		HttpBody:                   &config.Message{Request: config.Bool(false), Response: config.Bool(false)},
+		BodyMaxSizeBytes:           config.Int32(1000),
+		BodyMaxProcessingSizeBytes: config.Int32(7),
+	}
+
+	ih := &mockHandler{baseHandler: wh}
+
+	r, _ := http.NewRequest("POST", "http://traceable.ai/foo/1", strings.NewReader(`{"name":"Jacinto"}`))
+	r.Header.Add("Content-Type", "application/json")
+	r.Header.Add("api_key", "abc")
+	w := httptest.NewRecorder()
+
+	ih.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+}
+
+func TestLateFilterCannotReadBody(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	delegateStarted := make(chan struct{})
+	bodyErr := make(chan error, 1)
+
+	h := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		close(delegateStarted)
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"name":"Jacinto"}`, string(body))
+	})
+
+	wh := WrapHandler(h, mock.SpanFromContext, &Options{
+		Filter: filter.NewMultiFilterWithOptions(
+			filter.MultiFilterOptions{Timeout: 10 * time.Millisecond},
+			contextFilter{
+				evaluator: func(ctx context.Context, span sdk.Span, req *filter.Request) result.FilterResult {
+					<-ctx.Done()
+					// the body is being read by the delegate handler by now
+					<-delegateStarted
+					_, err := req.Body()
+					bodyErr <- err
+					return result.FilterResult{}
+				},
+			},
+		),
+	}, map[string]string{}, &metricsHandler{})
+	ih := &mockHandler{baseHandler: wh}
+
+	r, _ := http.NewRequest("POST", "http://traceable.ai/foo", strings.NewReader(`{"name":"Jacinto"}`))
+	r.Header.Add("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	ih.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.ErrorIs(t, <-bodyErr, filter.ErrRequestEvaluated)
+}
+
+func TestServerRequestExclusions(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	h := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("ok"))
+	})
+
+	filterCalls := 0
+	wh, _ := WrapHandler(h, mock.SpanFromContext, &Options{
+		Filter: mock.Filter{
+			Evaluator: func(span sdk.Span) result.FilterResult {
+				filterCalls++
+				return result.FilterResult{}
+			},
+		},
+		RouteTemplateGetter: func(r *http.Request) string { return "/internal/{name}" },
+		Exclusions: exclusion.Rules{
+			{Path: "/healthz", Action: exclusion.SkipDataCapture},
+			{Route: "/internal/*", UserAgent: "kube-probe/*", Action: exclusion.SkipDataCapture},
+		},
+	}, map[string]string{}, &metricsHandler{}).(*handler)
+	ih := &mockHandler{baseHandler: wh}
+
+	for _, tCase := range []struct {
+		url       string
+		userAgent string
+		excluded  bool
+	}{
+		{"http://traceable.ai/healthz", "curl/8.0", true},
+		{"http://traceable.ai/internal/status", "kube-probe/1.29", true},
+		{"http://traceable.ai/internal/status", "curl/8.0", false},
+	} {
+		r, _ := http.NewRequest("GET", tCase.url, nil)
+		r.Header.Set("User-Agent", tCase.userAgent)
+		w := httptest.NewRecorder()
+
+		ih.ServeHTTP(w, r)
+		assert.Equal(t, "ok", w.Body.String())
+
+		span := ih.spans[len(ih.spans)-1]
+		assert.Equal(t, tCase.excluded, span.ReadAttribute("http.url") == nil, "url %s, user agent %s", tCase.url, tCase.userAgent)
+	}
+
+	// the data capture is skipped but the filter is still evaluated
+	assert.Equal(t, 3, filterCalls)
+}
+
+func TestServerRequestExclusionsAreFiltered(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	h := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("ok"))
+	})
+
+	wh, _ := WrapHandler(h, mock.SpanFromContext, &Options{
+		Filter: mock.Filter{
+			Evaluator: func(span sdk.Span) result.FilterResult {
+				return result.FilterResult{Block: true, ResponseStatusCode: 403}
+			},
+		},
+		Exclusions: exclusion.Rules{{UserAgent: "kube-probe/*"}},
+	}, map[string]string{}, &metricsHandler{}).(*handler)
+	ih := &mockHandler{baseHandler: wh}
+
+	// a client can't skip the filters by spoofing its user agent
+	r, _ := http.NewRequest("GET", "http://traceable.ai/admin", nil)
+	r.Header.Set("User-Agent", "kube-probe/1.29")
+	w := httptest.NewRecorder()
+
+	ih.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Nil(t, ih.spans[0].ReadAttribute("http.url"))
+}
+
+func TestServerPanicIsRecordedAndPropagated(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	h := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	wh, _ := WrapHandler(h, mock.SpanFromContext, &Options{PanicRecovery: sdk.PanicRecoveryRecord}, map[string]string{}, &metricsHandler{}).(*handler)
+	wh.dataCaptureConfig = emptyTestConfig
+	ih := &mockHandler{baseHandler: wh}
+
+	r, _ := http.NewRequest("GET", "http://traceable.ai/foo", nil)
+	w := httptest.NewRecorder()
+
+	assert.PanicsWithValue(t, "boom", func() { ih.ServeHTTP(w, r) })
+
+	span := ih.spans[0]
+	event, ok := span.ReadEvent("exception")
+	assert.True(t, ok)
+	assert.Equal(t, "string", event["exception.type"])
+	assert.Equal(t, "boom", event["exception.message"])
+	assert.Contains(t, event["exception.stacktrace"], "handler_test.go")
+	assert.Equal(t, true, event["exception.escaped"])
+	assert.Equal(t, sdk.StatusCodeError, span.Status.Code)
+}
+
+func TestServerPanicIsRecoveredWithInternalServerError(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	h := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	wh, _ := WrapHandler(h, mock.SpanFromContext, &Options{PanicRecovery: sdk.PanicRecoveryRespond}, map[string]string{}, &metricsHandler{}).(*handler)
+	wh.dataCaptureConfig = emptyTestConfig
+	ih := &mockHandler{baseHandler: wh}
+
+	r, _ := http.NewRequest("GET", "http://traceable.ai/foo", nil)
+	w := httptest.NewRecorder()
+
+	assert.NotPanics(t, func() { ih.ServeHTTP(w, r) })
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	span := ih.spans[0]
+	event, ok := span.ReadEvent("exception")
+	assert.True(t, ok)
+	assert.Equal(t, false, event["exception.escaped"])
+	assert.Equal(t, sdk.StatusCodeError, span.Status.Code)
+}
+
+func TestServerPanicAfterWritingHeaderAbortsResponse(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	h := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("partial"))
+		panic("boom")
+	})
+
+	wh, _ := WrapHandler(h, mock.SpanFromContext, &Options{PanicRecovery: sdk.PanicRecoveryRespond}, map[string]string{}, &metricsHandler{}).(*handler)
+	wh.dataCaptureConfig = emptyTestConfig
+	ih := &mockHandler{baseHandler: wh}
+
+	r, _ := http.NewRequest("GET", "http://traceable.ai/foo", nil)
+	w := httptest.NewRecorder()
+
+	// the status was sent already so the response is aborted rather than turned into a 500
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() { ih.ServeHTTP(w, r) })
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	_, ok := ih.spans[0].ReadEvent("exception")
+	assert.True(t, ok)
+}
+
+func TestServerAbortHandlerPanicIsNotRecorded(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	h := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+
+	wh, _ := WrapHandler(h, mock.SpanFromContext, &Options{PanicRecovery: sdk.PanicRecoveryRespond}, map[string]string{}, &metricsHandler{}).(*handler)
+	wh.dataCaptureConfig = emptyTestConfig
+	ih := &mockHandler{baseHandler: wh}
+
+	r, _ := http.NewRequest("GET", "http://traceable.ai/foo", nil)
+
+	// aborting the handler on purpose isn't a failure to record
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() { ih.ServeHTTP(httptest.NewRecorder(), r) })
+	_, ok := ih.spans[0].ReadEvent("exception")
+	assert.False(t, ok)
+}
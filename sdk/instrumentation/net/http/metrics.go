@@ -0,0 +1,110 @@
+package http // import "github.com/hypertrace/goagent/sdk/instrumentation/net/http"
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/hypertrace/goagent/sdk"
+)
+
+// meteredResponseWriter keeps the status code and counts the bytes of the response
+// body for the metrics.
+type meteredResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	size       int64
+}
+
+func (w *meteredResponseWriter) WriteHeader(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *meteredResponseWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+// ReadFrom counts the bytes copied by the underlying io.ReaderFrom, only exposed by wrap
+// when the underlying writer implements it.
+func (w *meteredResponseWriter) ReadFrom(src io.Reader) (int64, error) {
+	n, err := w.ResponseWriter.(io.ReaderFrom).ReadFrom(src)
+	w.size += n
+	return n, err
+}
+
+// Unwrap gives access to the underlying writer to http.ResponseController.
+func (w *meteredResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// wrap returns the writer exposing the optional interfaces of the underlying one.
+func (w *meteredResponseWriter) wrap() http.ResponseWriter {
+	hj, _ := w.ResponseWriter.(http.Hijacker)
+	cn, _ := w.ResponseWriter.(http.CloseNotifier)
+	pu, _ := w.ResponseWriter.(http.Pusher)
+	fl, _ := w.ResponseWriter.(http.Flusher)
+
+	var rf io.ReaderFrom
+	if _, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		rf = w
+	}
+	return wrapResponseWriter(w, hj, cn, pu, fl, rf)
+}
+
+// status returns the status code sent, 200 being implicit when the handler doesn't
+// set any.
+func (w *meteredResponseWriter) status() int {
+	if w.statusCode == 0 {
+		return http.StatusOK
+	}
+	return w.statusCode
+}
+
+// meteredBody counts the bytes of the request body read by the handler.
+type meteredBody struct {
+	io.ReadCloser
+	size int64
+}
+
+func (b *meteredBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.size += int64(n)
+	return n, err
+}
+
+// meteredResponseBody counts the bytes of a response body received by a client and
+// records the size once the body is read entirely or closed.
+type meteredResponseBody struct {
+	io.ReadCloser
+	req        *http.Request
+	statusCode int
+	mh         sdk.HttpClientMetricsHandler
+	size       int64
+	recordOnce sync.Once
+}
+
+func (b *meteredResponseBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.size += int64(n)
+	if errors.Is(err, io.EOF) {
+		b.record()
+	}
+	return n, err
+}
+
+func (b *meteredResponseBody) Close() error {
+	b.record()
+	return b.ReadCloser.Close()
+}
+
+func (b *meteredResponseBody) record() {
+	b.recordOnce.Do(func() {
+		b.mh.RecordHttpClientResponseSize(b.req, b.statusCode, b.size)
+	})
+}
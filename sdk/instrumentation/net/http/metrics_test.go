@@ -0,0 +1,203 @@
+package http
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hypertrace/goagent/sdk"
+	internalconfig "github.com/hypertrace/goagent/sdk/internal/config"
+	"github.com/hypertrace/goagent/sdk/internal/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ sdk.HttpServerMetricsHandler = (*serverMetricsHandler)(nil)
+
+type serverMetricsHandler struct {
+	requestCount   int64
+	activeRequests []int64
+	operations     []sdk.HttpOperation
+}
+
+func (mh *serverMetricsHandler) AddToRequestCount(n int64, _ *http.Request) {
+	mh.requestCount += n
+}
+
+func (mh *serverMetricsHandler) AddToActiveRequests(n int64, _ *http.Request) {
+	mh.activeRequests = append(mh.activeRequests, n)
+}
+
+func (mh *serverMetricsHandler) RecordHttpOperation(_ *http.Request, op sdk.HttpOperation) {
+	mh.operations = append(mh.operations, op)
+}
+
+func TestServerRecordsOperationMetrics(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	h := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, `{"name":"Pupo"}`, string(body))
+
+		rw.WriteHeader(http.StatusCreated)
+		rw.Write([]byte(`{"id":1}`))
+	})
+
+	mh := &serverMetricsHandler{}
+	ih := &mockHandler{baseHandler: WrapHandler(h, mock.SpanFromContext, &Options{}, map[string]string{}, mh)}
+
+	r, _ := http.NewRequest("POST", "http://traceable.ai/users", strings.NewReader(`{"name":"Pupo"}`))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	ih.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, int64(1), mh.requestCount)
+	assert.Equal(t, []int64{1, -1}, mh.activeRequests)
+
+	require.Len(t, mh.operations, 1)
+	op := mh.operations[0]
+	assert.Equal(t, http.StatusCreated, op.StatusCode)
+	assert.Equal(t, int64(len(`{"name":"Pupo"}`)), op.RequestSize)
+	assert.Equal(t, int64(len(`{"id":1}`)), op.ResponseSize)
+	assert.Greater(t, int64(op.Duration), int64(0))
+}
+
+func TestServerRecordsOperationMetricsWithoutSpan(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	h := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {})
+
+	mh := &serverMetricsHandler{}
+	wh := WrapHandler(h, mock.SpanFromContext, &Options{}, map[string]string{}, mh)
+	ih := &mockHandler{baseHandler: http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		mock.SpanFromContext(r.Context()).(*mock.Span).Noop = true
+		wh.ServeHTTP(rw, r)
+	})}
+
+	r, _ := http.NewRequest("GET", "http://traceable.ai/users", nil)
+	ih.ServeHTTP(httptest.NewRecorder(), r)
+
+	require.Len(t, mh.operations, 1)
+	assert.Equal(t, http.StatusOK, mh.operations[0].StatusCode)
+	assert.Zero(t, mh.operations[0].RequestSize)
+	assert.Zero(t, mh.operations[0].ResponseSize)
+}
+
+func TestServerRecordsPanicsAsInternalServerErrors(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	h := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	mh := &serverMetricsHandler{}
+	ih := &mockHandler{baseHandler: WrapHandler(h, mock.SpanFromContext, &Options{PanicRecovery: sdk.PanicRecoveryRecord}, map[string]string{}, mh)}
+
+	r, _ := http.NewRequest("GET", "http://traceable.ai/users", nil)
+	assert.Panics(t, func() { ih.ServeHTTP(httptest.NewRecorder(), r) })
+
+	require.Len(t, mh.operations, 1)
+	assert.Equal(t, http.StatusInternalServerError, mh.operations[0].StatusCode)
+}
+
+func TestServerKeepsResponseWriterInterfaces(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	h := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		_, ok := rw.(http.Flusher)
+		assert.True(t, ok)
+
+		hj, ok := rw.(http.Hijacker)
+		require.True(t, ok)
+		conn, buf, err := hj.Hijack()
+		require.NoError(t, err)
+		defer conn.Close()
+
+		buf.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 2\r\nConnection: close\r\n\r\nok")
+		buf.Flush()
+	})
+
+	mh := &serverMetricsHandler{}
+	s := httptest.NewServer(&mockHandler{baseHandler: WrapHandler(h, mock.SpanFromContext, &Options{}, map[string]string{}, mh)})
+	defer s.Close()
+
+	res, err := http.Get(s.URL)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", string(body))
+}
+
+var _ sdk.HttpClientMetricsHandler = (*clientMetricsHandler)(nil)
+
+type clientMetricsHandler struct {
+	operations    []sdk.HttpClientOperation
+	responseSizes []int64
+}
+
+func (mh *clientMetricsHandler) RecordHttpClientOperation(_ *http.Request, op sdk.HttpClientOperation) {
+	mh.operations = append(mh.operations, op)
+}
+
+func (mh *clientMetricsHandler) RecordHttpClientResponseSize(_ *http.Request, _ int, size int64) {
+	mh.responseSizes = append(mh.responseSizes, size)
+}
+
+func TestClientRecordsOperationMetrics(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusAccepted)
+		rw.Write([]byte(`{"id":1}`))
+	}))
+	defer srv.Close()
+
+	mh := &clientMetricsHandler{}
+	client := &http.Client{
+		Transport: &mockTransport{
+			baseRoundTripper: WrapTransport(http.DefaultTransport, mock.SpanFromContext, &Options{}, map[string]string{}, mh),
+		},
+	}
+
+	res, err := client.Get(srv.URL)
+	require.NoError(t, err)
+
+	require.Len(t, mh.operations, 1)
+	assert.Equal(t, http.StatusAccepted, mh.operations[0].StatusCode)
+	assert.NoError(t, mh.operations[0].Err)
+	assert.Greater(t, int64(mh.operations[0].Duration), int64(0))
+
+	// the size is recorded once the body is read
+	assert.Empty(t, mh.responseSizes)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, []int64{int64(len(body))}, mh.responseSizes)
+}
+
+func TestClientRecordsFailureMetrics(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	expectedErr := errors.New("roundtrip error")
+	mh := &clientMetricsHandler{}
+	client := &http.Client{
+		Transport: &mockTransport{
+			baseRoundTripper: WrapTransport(failingTransport{expectedErr}, mock.SpanFromContext, &Options{}, map[string]string{}, mh),
+		},
+	}
+
+	_, err := client.Get("http://traceable.ai")
+	require.Error(t, err)
+
+	require.Len(t, mh.operations, 1)
+	assert.Zero(t, mh.operations[0].StatusCode)
+	assert.ErrorIs(t, mh.operations[0].Err, expectedErr)
+	assert.Empty(t, mh.responseSizes)
+}
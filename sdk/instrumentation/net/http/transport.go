@@ -2,11 +2,16 @@ package http // import "github.com/hypertrace/goagent/sdk/instrumentation/net/ht
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
+	"time"
 
 	config "github.com/hypertrace/agent-config/gen/go/v1"
 	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/filter"
+	"github.com/hypertrace/goagent/sdk/filter/result"
 	internalconfig "github.com/hypertrace/goagent/sdk/internal/config"
 	"github.com/hypertrace/goagent/sdk/internal/container"
 )
@@ -18,9 +23,34 @@ type roundTripper struct {
 	defaultAttributes        map[string]string
 	spanFromContextRetriever sdk.SpanFromContext
 	dataCaptureConfig        *config.DataCapture
+	filter                   filter.Filter
+	mh                       sdk.HttpClientMetricsHandler
 }
 
 func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if rt.mh == nil {
+		return rt.roundTrip(req)
+	}
+
+	start := time.Now()
+	res, err := rt.roundTrip(req)
+
+	op := sdk.HttpClientOperation{Duration: time.Since(start), Err: err}
+	if err == nil && res != nil {
+		op.StatusCode = res.StatusCode
+		// the body of protocol switches is also written to, hence it is not wrapped
+		if res.Body != nil && res.Body != http.NoBody && res.StatusCode != http.StatusSwitchingProtocols {
+			res.Body = &meteredResponseBody{ReadCloser: res.Body, req: req, statusCode: res.StatusCode, mh: rt.mh}
+		} else {
+			rt.mh.RecordHttpClientResponseSize(req, res.StatusCode, 0)
+		}
+	}
+	rt.mh.RecordHttpClientOperation(req, op)
+
+	return res, err
+}
+
+func (rt *roundTripper) roundTrip(req *http.Request) (*http.Response, error) {
 	span := rt.spanFromContextRetriever(req.Context())
 	if span.IsNoop() {
 		// isNoop means either the span is not sampled or there was no span
@@ -29,6 +59,9 @@ func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 		// round tripper.
 		return rt.delegate.RoundTrip(req)
 	}
+	// RoundTrippers should not modify the request, hence we use a copy as
+	// filter decorations and body capture could change it.
+	req = req.Clone(req.Context())
 	reqHeadersAccessor := NewHeaderMapAccessor(req.Header)
 
 	for key, value := range rt.defaultAttributes {
@@ -43,6 +76,7 @@ func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 	// is in the recording accept list. Notice in here we rely on the fact that
 	// the content type is not streamable, otherwise we could end up in a very
 	// expensive parsing of a big body in memory.
+	var capturedBody []byte
 	if req.Body != nil && rt.dataCaptureConfig.HttpBody.Request.Value && ShouldRecordBodyOfContentType(reqHeadersAccessor) {
 		body, err := ioutil.ReadAll(req.Body)
 		if err != nil {
@@ -56,6 +90,15 @@ func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 		}
 
 		req.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+		capturedBody = body
+	}
+
+	// single evaluation call to filter after capturing the configured parameters
+	filterResult := filter.EvaluateRequest(req.Context(), rt.filter, span, rt.filterRequest(req, reqHeadersAccessor, capturedBody))
+	if filterResult.Block {
+		return newBlockedResponse(req, filterResult), nil
+	} else if filterResult.Decorations != nil {
+		applyDecorations(req.Header, filterResult.Decorations, span)
 	}
 
 	res, err := rt.delegate.RoundTrip(req)
@@ -88,9 +131,48 @@ func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 	return res, err
 }
 
+// filterRequest builds the request view passed to filters implementing filter.ContextFilter.
+// The peer is the host being called.
+func (rt *roundTripper) filterRequest(req *http.Request, headersAccessor HeaderAccessor, capturedBody []byte) *filter.Request {
+	return filter.NewRequest(req.Method, "", req.URL.Host, headersAccessor, func() ([]byte, error) {
+		if capturedBody != nil {
+			return capturedBody, nil
+		}
+		return peekBody(req, int(rt.dataCaptureConfig.GetBodyMaxProcessingSizeBytes().GetValue()))
+	})
+}
+
+// newBlockedResponse creates the synthetic response returned to the caller when
+// a filter blocks the outgoing request.
+func newBlockedResponse(req *http.Request, filterResult result.FilterResult) *http.Response {
+	statusCode := int(filterResult.ResponseStatusCode)
+	if statusCode == 0 {
+		statusCode = http.StatusForbidden
+	}
+
+	message := filterResult.ResponseMessage
+	if message == "" {
+		message = http.StatusText(statusCode)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+		StatusCode:    statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"text/plain; charset=utf-8"}},
+		Body:          ioutil.NopCloser(strings.NewReader(message)),
+		ContentLength: int64(len(message)),
+		Request:       req,
+	}
+}
+
 // WrapTransport returns a new http.RoundTripper that should be wrapped
-// by an instrumented http.RoundTripper
-func WrapTransport(delegate http.RoundTripper, spanFromContextRetriever sdk.SpanFromContext, spanAttributes map[string]string) http.RoundTripper {
+// by an instrumented http.RoundTripper. The requests are measured when mh
+// is not nil.
+func WrapTransport(delegate http.RoundTripper, spanFromContextRetriever sdk.SpanFromContext, options *Options,
+	spanAttributes map[string]string, mh sdk.HttpClientMetricsHandler) http.RoundTripper {
 	defaultAttributes := make(map[string]string)
 	for k, v := range spanAttributes {
 		defaultAttributes[k] = v
@@ -99,5 +181,10 @@ func WrapTransport(delegate http.RoundTripper, spanFromContextRetriever sdk.Span
 		defaultAttributes["container_id"] = containerID
 	}
 
-	return &roundTripper{delegate, defaultAttributes, spanFromContextRetriever, internalconfig.GetConfig().GetDataCapture()}
+	var f filter.Filter = &filter.NoopFilter{}
+	if options != nil && options.Filter != nil {
+		f = options.Filter
+	}
+
+	return &roundTripper{delegate, defaultAttributes, spanFromContextRetriever, internalconfig.GetConfig().GetDataCapture(), f, mh}
 }
@@ -13,6 +13,9 @@ import (
 	"testing"
 
 	config "github.com/hypertrace/agent-config/gen/go/v1"
+	"github.com/hypertrace/goagent/sdk"
+	"github.com/hypertrace/goagent/sdk/filter"
+	"github.com/hypertrace/goagent/sdk/filter/result"
 	internalconfig "github.com/hypertrace/goagent/sdk/internal/config"
 	"github.com/hypertrace/goagent/sdk/internal/mock"
 	"github.com/stretchr/testify/assert"
@@ -37,7 +40,7 @@ func TestClientRequestIsSuccessfullyTraced(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	rt := WrapTransport(http.DefaultTransport, mock.SpanFromContext, map[string]string{"foo": "bar"}).(*roundTripper)
+	rt := WrapTransport(http.DefaultTransport, mock.SpanFromContext, &Options{}, map[string]string{"foo": "bar"}, nil).(*roundTripper)
 	rt.dataCaptureConfig = &config.DataCapture{
 		HttpHeaders: &config.Message{
 			Request:  config.Bool(false),
@@ -101,7 +104,7 @@ func TestClientRequestHeadersAreCapturedAccordingly(t *testing.T) {
 		}))
 		defer srv.Close()
 
-		rt := WrapTransport(http.DefaultTransport, mock.SpanFromContext, map[string]string{"foo": "bar"}).(*roundTripper)
+		rt := WrapTransport(http.DefaultTransport, mock.SpanFromContext, &Options{}, map[string]string{"foo": "bar"}, nil).(*roundTripper)
 		rt.dataCaptureConfig = &config.DataCapture{
 			HttpHeaders: &config.Message{
 				Request:  config.Bool(tCase.captureHTTPHeadersRequestConfig),
@@ -169,7 +172,7 @@ func TestClientFailureRequestIsSuccessfullyTraced(t *testing.T) {
 	expectedErr := errors.New("roundtrip error")
 	client := &http.Client{
 		Transport: &mockTransport{
-			baseRoundTripper: WrapTransport(failingTransport{expectedErr}, mock.SpanFromContext, map[string]string{}),
+			baseRoundTripper: WrapTransport(failingTransport{expectedErr}, mock.SpanFromContext, &Options{}, map[string]string{}, nil),
 		},
 	}
 
@@ -298,7 +301,7 @@ func TestClientRecordsRequestAndResponseBodyAccordingly(t *testing.T) {
 			}))
 			defer srv.Close()
 
-			rt := WrapTransport(http.DefaultTransport, mock.SpanFromContext, map[string]string{}).(*roundTripper)
+			rt := WrapTransport(http.DefaultTransport, mock.SpanFromContext, &Options{}, map[string]string{}, nil).(*roundTripper)
 			rt.dataCaptureConfig = &config.DataCapture{
 				HttpBody: &config.Message{
 					Request:  config.Bool(tCase.captureHTTPBodyConfig),
@@ -378,3 +381,104 @@ func TestClientRecordsRequestAndResponseBodyAccordingly(t *testing.T) {
 		})
 	}
 }
+
+func TestClientRequestFilter(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	tCases := map[string]struct {
+		filterResult       result.FilterResult
+		expectedStatusCode int
+		expectedStatus     string
+		expectedBody       string
+		expectServerCall   bool
+	}{
+		"no block": {
+			filterResult:       result.FilterResult{},
+			expectedStatusCode: http.StatusAccepted,
+			expectedStatus:     "202 Accepted",
+			expectedBody:       `{"id":123}`,
+			expectServerCall:   true,
+		},
+		"block with default response": {
+			filterResult:       result.FilterResult{Block: true},
+			expectedStatusCode: http.StatusForbidden,
+			expectedStatus:     "403 Forbidden",
+			expectedBody:       "Forbidden",
+		},
+		"block with custom response": {
+			filterResult:       result.FilterResult{Block: true, ResponseStatusCode: 451, ResponseMessage: "host not allowed"},
+			expectedStatusCode: 451,
+			expectedStatus:     "451 Unavailable For Legal Reasons",
+			expectedBody:       "host not allowed",
+		},
+	}
+
+	for name, tCase := range tCases {
+		t.Run(name, func(t *testing.T) {
+			serverCalled := false
+			srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				serverCalled = true
+				rw.WriteHeader(202)
+				rw.Write([]byte(`{"id":123}`))
+			}))
+			defer srv.Close()
+
+			rt := WrapTransport(http.DefaultTransport, mock.SpanFromContext, &Options{
+				Filter: mock.Filter{
+					Evaluator: func(span sdk.Span) result.FilterResult {
+						return tCase.filterResult
+					},
+				},
+			}, map[string]string{}, nil)
+			client := &http.Client{Transport: &mockTransport{baseRoundTripper: rt}}
+
+			req, _ := http.NewRequest("GET", srv.URL, nil)
+			res, err := client.Do(req)
+			assert.NoError(t, err)
+			assert.Equal(t, tCase.expectedStatusCode, res.StatusCode)
+			assert.Equal(t, tCase.expectedStatus, res.Status)
+
+			body, err := io.ReadAll(res.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, tCase.expectedBody, string(body))
+			assert.Equal(t, tCase.expectServerCall, serverCalled)
+		})
+	}
+}
+
+func TestClientRequestFilterDecorations(t *testing.T) {
+	defer internalconfig.ResetConfig()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "injected-value", req.Header.Get("injected-header"))
+		assert.Empty(t, req.Header.Get("authorization"))
+		rw.WriteHeader(202)
+	}))
+	defer srv.Close()
+
+	rt := WrapTransport(http.DefaultTransport, mock.SpanFromContext, &Options{
+		Filter: contextFilter{
+			evaluator: func(ctx context.Context, span sdk.Span, req *filter.Request) result.FilterResult {
+				assert.Equal(t, "GET", req.Method)
+				assert.Equal(t, srv.Listener.Addr().String(), req.Peer)
+				return result.FilterResult{Decorations: &result.Decorations{
+					RequestHeaderInjections: []result.KeyValueString{{Key: "injected-header", Value: "injected-value"}},
+					RequestHeaderRemovals:   []string{"Authorization"},
+				}}
+			},
+		},
+	}, map[string]string{}, nil)
+	tr := &mockTransport{baseRoundTripper: rt}
+	client := &http.Client{Transport: tr}
+
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	req.Header.Set("Authorization", "Bearer abc")
+	res, err := client.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 202, res.StatusCode)
+
+	// the caller's request is not modified
+	assert.Equal(t, "Bearer abc", req.Header.Get("Authorization"))
+	assert.Empty(t, req.Header.Get("injected-header"))
+	assert.Equal(t, "injected-value", tr.spans[0].ReadAttribute("http.request.header.injected-header"))
+}
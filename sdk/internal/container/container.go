@@ -5,43 +5,147 @@ import (
 	"errors"
 	"io"
 	"os"
+	"regexp"
 	"strings"
+	"sync"
 )
 
 const (
-	dockerPrefix   = "/docker/"
-	kubepodsPrefix = "/kubepods/"
+	cgroupPath    = "/proc/self/cgroup"
+	mountInfoPath = "/proc/self/mountinfo"
 )
 
 // ErrNotInContainerEnv is returned when the GetID function is
 // called in a non container environment
 var ErrNotInContainerEnv = errors.New("not in a container environment")
 
+var (
+	// containerIDRegexp matches the container IDs of docker, containerd, CRI-O and podman
+	// as well as the ones of the ECS Fargate tasks, i.e. <task ID>-<number>.
+	containerIDRegexp = regexp.MustCompile(`^([0-9a-f]{64}|[0-9a-f]{32}-[0-9]{10})$`)
+
+	// scopePrefixes are the runtime prefixes of the systemd scopes holding a container,
+	// e.g. cri-containerd-<id>.scope.
+	scopePrefixes = []string{"cri-containerd-", "containerd-", "crio-", "docker-", "libpod-"}
+
+	// runtimeRoots are the top level cgroups the runtimes create the containers under
+	// when they don't use systemd scopes.
+	runtimeRoots = map[string]bool{"docker": true, "kubepods": true, "ecs": true}
+)
+
+// getContainerIDFromReader returns the container ID found in a /proc/self/cgroup file.
+// Each line is made of hierarchy-ID:controller-list:cgroup-path, the container ID being
+// a segment of the path, e.g.
+//   - /docker/<id>
+//   - /kubepods/burstable/pod<uid>/<id>
+//   - /kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod<uid>.slice/cri-containerd-<id>.scope
+//   - /machine.slice/libpod-<id>.scope/container
+//   - /ecs/<task ID>/<id>
 func getContainerIDFromReader(f io.Reader) (string, error) {
 	s := bufio.NewScanner(f)
 
 	for s.Scan() {
-		if err := s.Err(); err != nil {
-			return "", err
+		fields := strings.SplitN(s.Text(), ":", 3)
+		if len(fields) < 3 {
+			continue
 		}
 
-		group := strings.SplitN(s.Text(), ":", 3)[2]
-		if strings.HasPrefix(group, dockerPrefix) {
-			return group[len(dockerPrefix):], nil
-		} else if strings.HasPrefix(group, kubepodsPrefix) {
-			return group[len(kubepodsPrefix):], nil
+		if id, ok := containerIDFromPath(fields[2]); ok {
+			return id, nil
 		}
 	}
+	if err := s.Err(); err != nil {
+		return "", err
+	}
 	return "", ErrNotInContainerEnv
 }
 
-// GetID returns the container ID when in a containerized environment.
-func GetID() (string, error) {
-	f, err := os.Open("/proc/self/cgroup")
+// getContainerIDFromMountInfo returns the container ID found in a /proc/self/mountinfo file.
+// On cgroup v2 hosts with a private cgroup namespace /proc/self/cgroup is just "0::/" so the
+// ID is taken from the files the runtime mounts in the container, e.g. /etc/hostname mounted
+// from /var/lib/docker/containers/<id>/hostname.
+func getContainerIDFromMountInfo(f io.Reader) (string, error) {
+	s := bufio.NewScanner(f)
+
+	for s.Scan() {
+		// ref: /proc/pid/mountinfo section of https://man7.org/linux/man-pages/man5/proc.5.html
+		fields := strings.Fields(s.Text())
+		if len(fields) < 4 {
+			continue
+		}
+
+		segments := strings.Split(fields[3], "/")
+		for i := 0; i < len(segments)-1; i++ {
+			if segments[i] != "containers" && segments[i] != "overlay-containers" {
+				continue
+			}
+			if containerIDRegexp.MatchString(segments[i+1]) {
+				return segments[i+1], nil
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return "", err
+	}
+	return "", ErrNotInContainerEnv
+}
+
+// containerIDFromPath returns the last segment of a cgroup path being a container ID, either
+// in a runtime scope or under a runtime root.
+func containerIDFromPath(path string) (string, bool) {
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	underRuntimeRoot := runtimeRoots[segments[0]]
+	for i := len(segments) - 1; i >= 0; i-- {
+		segment := strings.TrimSuffix(segments[i], ".scope")
+		inScope := false
+		for _, prefix := range scopePrefixes {
+			if strings.HasPrefix(segment, prefix) {
+				segment = segment[len(prefix):]
+				inScope = true
+				break
+			}
+		}
+
+		if (inScope || underRuntimeRoot) && containerIDRegexp.MatchString(segment) {
+			return segment, true
+		}
+	}
+	return "", false
+}
+
+func getIDFromFile(path string, getID func(io.Reader) (string, error)) (string, error) {
+	f, err := os.Open(path)
 	if err != nil {
 		return "", err
 	}
 	defer f.Close()
 
-	return getContainerIDFromReader(f)
+	return getID(f)
+}
+
+func getID() (string, error) {
+	id, err := getIDFromFile(cgroupPath, getContainerIDFromReader)
+	if err == nil {
+		return id, nil
+	}
+
+	if mountInfoID, mountInfoErr := getIDFromFile(mountInfoPath, getContainerIDFromMountInfo); mountInfoErr == nil {
+		return mountInfoID, nil
+	}
+	return "", err
+}
+
+var (
+	once        sync.Once
+	containerID string
+	idErr       error
+)
+
+// GetID returns the container ID when in a containerized environment. The ID is
+// looked up once and cached for the lifetime of the process.
+func GetID() (string, error) {
+	once.Do(func() {
+		containerID, idErr = getID()
+	})
+	return containerID, idErr
 }
@@ -2,6 +2,7 @@ package container
 
 import (
 	"bytes"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -27,3 +28,60 @@ func TestDockerContainerIDCannotBeObtainerInNonContainerisedEnvs(t *testing.T) {
 	1:cpuset:/xyz/ba4024e95abb12affe2b0f56ff86536d0abad7e95b09b591b03e6670dd0b5e5f`))
 	assert.Equal(t, ErrNotInContainerEnv, err)
 }
+
+const testContainerID = "ba4024e95abb12affe2b0f56ff86536d0abad7e95b09b591b03e6670dd0b5e5f"
+
+func TestContainerIDFromCgroupFixtures(t *testing.T) {
+	tCases := map[string]struct {
+		expectedID  string
+		expectedErr error
+	}{
+		"docker.txt":              {expectedID: testContainerID},
+		"kubepods.txt":            {expectedID: testContainerID},
+		"cri-containerd.txt":      {expectedID: testContainerID},
+		"crio.txt":                {expectedID: testContainerID},
+		"systemd-docker.txt":      {expectedID: testContainerID},
+		"podman.txt":              {expectedID: testContainerID},
+		"ecs.txt":                 {expectedID: testContainerID},
+		"ecs-fargate.txt":         {expectedID: "8a1e7a4c0b2f4a2e9d3c5b6a7f8e9d0c-1234567890"},
+		"malformed.txt":           {expectedID: testContainerID},
+		"cgroupv2-namespaced.txt": {expectedErr: ErrNotInContainerEnv},
+		"crio-conmon.txt":         {expectedErr: ErrNotInContainerEnv},
+		"host.txt":                {expectedErr: ErrNotInContainerEnv},
+	}
+
+	for fixture, tCase := range tCases {
+		t.Run(fixture, func(t *testing.T) {
+			id, err := getIDFromFile(filepath.Join("testdata", "cgroup", fixture), getContainerIDFromReader)
+			assert.Equal(t, tCase.expectedErr, err)
+			assert.Equal(t, tCase.expectedID, id)
+		})
+	}
+}
+
+func TestContainerIDFromMountInfoFixtures(t *testing.T) {
+	tCases := map[string]struct {
+		expectedID  string
+		expectedErr error
+	}{
+		"docker.txt":    {expectedID: testContainerID},
+		"podman.txt":    {expectedID: testContainerID},
+		"host.txt":      {expectedErr: ErrNotInContainerEnv},
+		"malformed.txt": {expectedErr: ErrNotInContainerEnv},
+	}
+
+	for fixture, tCase := range tCases {
+		t.Run(fixture, func(t *testing.T) {
+			id, err := getIDFromFile(filepath.Join("testdata", "mountinfo", fixture), getContainerIDFromMountInfo)
+			assert.Equal(t, tCase.expectedErr, err)
+			assert.Equal(t, tCase.expectedID, id)
+		})
+	}
+}
+
+func TestContainerIDDoesNotPanicOnShortLines(t *testing.T) {
+	assert.NotPanics(t, func() {
+		_, err := getContainerIDFromReader(bytes.NewBufferString("0\n1:cpu\n"))
+		assert.Equal(t, ErrNotInContainerEnv, err)
+	})
+}
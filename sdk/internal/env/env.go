@@ -0,0 +1,24 @@
+// Package env reads the sdk settings set through environment variables.
+package env
+
+import (
+	"log"
+	"os"
+	"strconv"
+)
+
+// Bool returns the boolean value of the environment variable key or defaultValue
+// when it is not set. Invalid values are logged and defaultValue is returned.
+func Bool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("invalid value %q for %s, boolean value expected\n", value, key)
+		return defaultValue
+	}
+	return enabled
+}
@@ -0,0 +1,17 @@
+package env
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBool(t *testing.T) {
+	assert.True(t, Bool("HT_TEST_BOOL_ENV", true))
+
+	t.Setenv("HT_TEST_BOOL_ENV", "false")
+	assert.False(t, Bool("HT_TEST_BOOL_ENV", true))
+
+	t.Setenv("HT_TEST_BOOL_ENV", "yes")
+	assert.True(t, Bool("HT_TEST_BOOL_ENV", true))
+}
@@ -48,6 +48,7 @@ type Span struct {
 	Attributes map[string]interface{}
 	Options    sdk.SpanOptions
 	Err        error
+	ErrOptions sdk.ErrorOptions
 	Noop       bool
 	Status     Status
 	spanEvents []spanEvent
@@ -98,8 +99,9 @@ func (s *Span) SetStatus(code sdk.Code, description string) {
 	}
 }
 
-func (s *Span) SetError(err error) {
+func (s *Span) SetError(err error, opts ...sdk.ErrorOption) {
 	s.Err = err
+	s.ErrOptions = sdk.NewErrorOptions(opts...)
 }
 
 func (s *Span) IsNoop() bool {
@@ -113,6 +115,35 @@ func (s *Span) AddEvent(name string, ts time.Time, attributes map[string]interfa
 	s.spanEvents = append(s.spanEvents, spanEvent{name, ts, attributes})
 }
 
+// ReadEvent returns the attributes of the first event recorded with the given name
+func (s *Span) ReadEvent(name string) (map[string]interface{}, bool) {
+	s.mux.Lock() // avoids race conditions
+	defer s.mux.Unlock()
+
+	for _, e := range s.spanEvents {
+		if e.name == name {
+			return e.attributes, true
+		}
+	}
+
+	return nil, false
+}
+
+// ReadEvents returns the attributes of all the events recorded with the given name
+func (s *Span) ReadEvents(name string) []map[string]interface{} {
+	s.mux.Lock() // avoids race conditions
+	defer s.mux.Unlock()
+
+	var events []map[string]interface{}
+	for _, e := range s.spanEvents {
+		if e.name == name {
+			events = append(events, e.attributes)
+		}
+	}
+
+	return events
+}
+
 // This function has no use, it has been added just so that the interface in sdk/span.go remains implemented
 func (s *Span) GetSpanId() string {
 	return ""
@@ -125,7 +156,8 @@ func SpanFromContext(ctx context.Context) sdk.Span {
 }
 
 func StartSpan(ctx context.Context, name string, opts *sdk.SpanOptions) (context.Context, sdk.Span, func()) {
-	s := &Span{Name: name, Options: *opts}
+	s := NewSpan()
+	s.Name, s.Options = name, *opts
 	return ContextWithSpan(ctx, s), s, func() {}
 }
 
@@ -1,9 +1,71 @@
 package sdk // import "github.com/hypertrace/goagent/sdk"
 
 import (
+	"context"
 	"net/http"
+	"time"
 )
 
 type HttpOperationMetricsHandler interface {
 	AddToRequestCount(int64, *http.Request)
 }
+
+// HttpOperation describes a request handled by an HTTP server.
+type HttpOperation struct {
+	StatusCode int
+	Duration   time.Duration
+	// RequestSize and ResponseSize are the sizes in bytes of the request body read by
+	// the handler and of the response body written.
+	RequestSize  int64
+	ResponseSize int64
+}
+
+// HttpServerMetricsHandler is an HttpOperationMetricsHandler also recording the latency,
+// the body sizes and the in-flight requests of HTTP servers.
+type HttpServerMetricsHandler interface {
+	HttpOperationMetricsHandler
+	// AddToActiveRequests adds n, possibly negative, to the number of requests being handled.
+	AddToActiveRequests(int64, *http.Request)
+	RecordHttpOperation(*http.Request, HttpOperation)
+}
+
+// HttpClientOperation describes a request sent by an HTTP client.
+type HttpClientOperation struct {
+	// StatusCode is the status code of the response, 0 when the request failed.
+	StatusCode int
+	// Duration is the time until the response headers were received or the request failed.
+	Duration time.Duration
+	// Err is the error returned by the transport.
+	Err error
+}
+
+// HttpClientMetricsHandler records the metrics of the requests sent by HTTP clients.
+type HttpClientMetricsHandler interface {
+	// RecordHttpClientOperation records a request once the response headers are received
+	// or the request failed.
+	RecordHttpClientOperation(*http.Request, HttpClientOperation)
+	// RecordHttpClientResponseSize records the size in bytes of a response body once it
+	// is read entirely or closed.
+	RecordHttpClientResponseSize(req *http.Request, statusCode int, size int64)
+}
+
+// RpcOperation describes a finished RPC.
+type RpcOperation struct {
+	// FullMethod is the full name of the method, e.g. "/helloworld.Greeter/SayHello".
+	FullMethod string
+	// IsClient tells whether the RPC was sent by a client or handled by a server.
+	IsClient bool
+	// StatusCode is the gRPC status code the RPC finished with.
+	StatusCode int
+	Duration   time.Duration
+	// RequestSize and ResponseSize are the total sizes in bytes of the messages sent
+	// in each direction.
+	RequestSize  int64
+	ResponseSize int64
+}
+
+// RpcOperationMetricsHandler records the metrics of the RPCs handled by servers and
+// sent by clients.
+type RpcOperationMetricsHandler interface {
+	RecordRpcOperation(context.Context, RpcOperation)
+}
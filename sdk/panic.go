@@ -0,0 +1,40 @@
+package sdk // import "github.com/hypertrace/goagent/sdk"
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+// PanicRecovery tells what the server instrumentations do when a handler panics.
+type PanicRecovery int
+
+const (
+	// PanicRecoveryDisabled leaves the panics untouched, the span ending without
+	// any trace of them.
+	PanicRecoveryDisabled PanicRecovery = iota
+	// PanicRecoveryRecord records the panic on the span and panics again.
+	PanicRecoveryRecord
+	// PanicRecoveryRespond records the panic on the span and responds with an internal
+	// error (500 or Internal) instead of panicking again.
+	PanicRecoveryRespond
+)
+
+// RecordPanic records the value recovered from a panic on the span as an exception
+// event with the stack trace and sets the span status to error. It has to be called
+// from the deferred function recovering the panic for the stack trace to point to
+// where the panic happened.
+func RecordPanic(span Span, recovered interface{}, escaped bool) {
+	if span == nil || span.IsNoop() {
+		return
+	}
+
+	message := fmt.Sprint(recovered)
+	span.AddEvent("exception", time.Now(), map[string]interface{}{
+		"exception.type":       fmt.Sprintf("%T", recovered),
+		"exception.message":    message,
+		"exception.stacktrace": string(debug.Stack()),
+		"exception.escaped":    escaped,
+	})
+	span.SetStatus(StatusCodeError, "panic: "+message)
+}
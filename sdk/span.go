@@ -23,8 +23,9 @@ type Span interface {
 	// SetAttribute sets an attribute for the span.
 	SetAttribute(key string, value interface{})
 
-	// SetError sets an error for the span.
-	SetError(err error)
+	// SetError records an error on the span as an exception event with the concrete
+	// type, the wrapped errors and optionally the stack trace of the call site.
+	SetError(err error, opts ...ErrorOption)
 
 	// SetStatus sets the status of the Span in the form of a code and a
 	// description.